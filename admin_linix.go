@@ -102,6 +102,8 @@ func IsElevationRequired(operation string) bool {
 		"start":     true,
 		"stop":      true,
 		"restart":   true,
+
+		"reset-identity": true,
 	}
 
 	return elevationRequiredOps[operation]
@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -21,22 +23,94 @@ const (
 	LogLevelError                 // 错误信息
 )
 
+// parseLogLevel 解析日志级别名称 (debug, info, warn, error)
+func parseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LogLevelDebug, nil
+	case "info", "":
+		return LogLevelInfo, nil
+	case "warn", "warning":
+		return LogLevelWarn, nil
+	case "error":
+		return LogLevelError, nil
+	default:
+		return LogLevelInfo, fmt.Errorf("未知的日志级别: %s", name)
+	}
+}
+
 // AgentService 星尘代理服务核心业务逻辑
 type AgentService struct {
-	ctx      context.Context
-	cancel   context.CancelFunc
-	wg       sync.WaitGroup
-	config   *AgentConfig
-	logger   *log.Logger
-	logFile  *os.File
-	logLevel LogLevel
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+	mu         sync.RWMutex // 保护 config、configPath 和 logLevel
+	config     *AgentConfig // 当前配置，重新加载时整体替换，不原地修改
+	configPath string       // 实际加载的配置文件路径，为空表示使用默认配置
+	logger     *log.Logger
+	logFile    *os.File
+	logLevel   LogLevel
+	identity   *NodeIdentity // 持久化的节点身份，显式配置 node.id 时为 nil
+	nodeInfo   *NodeInfo     // 启动时采集的节点信息
+
+	metricsMu     sync.RWMutex
+	latestMetrics *NodeMetrics      // 最近一次采集的节点指标
+	latestReport  *MetricsAggregate // 最近一个报告周期的指标聚合
+
+	history *metricsHistory // 本地指标历史
+
+	outbox   *outbox         // 离线队列，服务端不可达时缓存报告和事件
+	flushNow chan struct{}   // 连接建立或产生新事件时通知状态报告器补报
+	alerts   map[string]bool // 当前处于告警状态的项目，只在状态变化时产生事件
+
+	stats     *agentStats        // 代理自身的运行统计
+	conn      *connectionTracker // 服务端连接状态
+	endpoints *endpointSelector  // 服务端地址选择与故障切换
+
+	credMu      sync.Mutex
+	credentials *NodeCredentials // 节点密钥，未注册时为 nil
+	nonces      *nonceCache      // 已执行指令的随机数，跨会话保留以拒绝重放
+
+	// 服务端会话
+	serverMu     sync.RWMutex
+	client       *StarClient        // 已登录的客户端，未连接时为 nil
+	pingDelay    time.Duration      // 上一次心跳的往返耗时
+	commandQueue chan ServerCommand // 心跳响应中收到的待执行指令
+	commandSlots chan struct{}      // 限制同时执行的指令数
+	commandWG    sync.WaitGroup     // 执行中的指令
+	connLost     chan struct{}      // 心跳失败，需要重新登录
+
+	// 配置变更通知，由 applyConfig 触发对应组件重启
+	monitorReset  chan struct{}
+	reporterReset chan struct{}
+	serverReset   chan struct{}
+	exporterReset chan struct{}
 }
 
 // AgentConfig 代理配置
 type AgentConfig struct {
 	// 服务端连接配置
-	ServerURL  string `json:"server_url"`
-	ServerPort int    `json:"server_port"`
+	ServerURL     string        `json:"server_url"`
+	ServerPort    int           `json:"server_port"`
+	ServerTimeout time.Duration `json:"server_timeout"` // 单个请求的超时时间
+
+	// 按优先级排列的服务端地址，配置后代替 ServerURL/ServerPort，
+	// 连接在低优先级地址上时每隔 ServerProbeInterval 探测更高优先级的地址
+	ServerEndpoints     []string      `json:"server_endpoints"`
+	ServerProbeInterval time.Duration `json:"server_probe_interval"`
+
+	// 签名时间戳允许的时钟偏差，超出范围的服务端指令被拒绝
+	ServerClockSkew time.Duration `json:"server_clock_skew"`
+
+	// 服务端连接的 TLS 配置，证书文件轮换后自动重新加载
+	ServerCAFile        string   `json:"server_ca_file"`   // CA 证书，设置后只信任该 CA 签发的服务端证书
+	ServerCertFile      string   `json:"server_cert_file"` // 双向认证的客户端证书
+	ServerKeyFile       string   `json:"server_key_file"`
+	ServerPins          []string `json:"server_pins"` // 服务端证书公钥指纹 (SPKI SHA-256)
+	ServerTLSMinVersion string   `json:"server_tls_min_version"`
+
+	// 出站代理地址，为空时使用 HTTPS_PROXY 等环境变量，direct 表示不使用代理
+	Proxy string `json:"proxy"`
 
 	// 节点配置
 	NodeID     string `json:"node_id"`
@@ -47,26 +121,112 @@ type AgentConfig struct {
 	MonitorInterval time.Duration `json:"monitor_interval"`
 	ReportInterval  time.Duration `json:"report_interval"`
 
+	// 本地指标历史保留时长
+	HistoryRetention time.Duration `json:"history_retention"`
+
+	// 系统信息来源目录，容器中运行时可指向挂载的宿主机目录
+	ProcRoot string `json:"proc_root"`
+	SysRoot  string `json:"sys_root"`
+	EtcRoot  string `json:"etc_root"`
+
+	// 状态报告中包含的进程排行数量，0 表示不采集
+	TopProcesses int `json:"top_processes"`
+
 	// 资源限制
 	MaxCPU    float64 `json:"max_cpu"`
 	MaxMemory int64   `json:"max_memory"`
+
+	// 日志配置
+	LogLevel string `json:"log_level"`
+
+	// 离线队列的容量和保留时长，超出时丢弃最旧的消息
+	QueueMaxSize int64         `json:"queue_max_size"`
+	QueueMaxAge  time.Duration `json:"queue_max_age"`
+
+	// exec 指令的本机执行策略文件，文件不存在时禁止执行
+	ExecPolicyFile string `json:"exec_policy_file"`
+
+	// 本地 HTTP 监听，提供 Prometheus /metrics 接口，端口为 0 时不启用
+	ListenHost string `json:"listen_host"`
+	ListenPort int    `json:"listen_port"`
+
+	// 数据目录，保存节点身份等状态文件
+	DataDir string `json:"data_dir"`
 }
 
-// NewAgentService 创建新的代理服务实例
-func NewAgentService() *AgentService {
+// NewAgentService 创建新的代理服务实例，配置加载或校验失败时返回错误
+func NewAgentService() (*AgentService, error) {
+	// 配置有误时拒绝启动，不能回退到默认配置连接默认服务端
+	loaded, err := loadAgentConfig(commandLineConfig)
+	if err != nil {
+		return nil, err
+	}
+	config := loaded.Config
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	service := &AgentService{
-		ctx:      ctx,
-		cancel:   cancel,
-		config:   getDefaultConfig(),
-		logLevel: LogLevelInfo, // 默认信息级别
+		ctx:        ctx,
+		cancel:     cancel,
+		config:     config,
+		configPath: loaded.Path,
+		logLevel:   LogLevelInfo, // 默认信息级别
+
+		monitorReset:  make(chan struct{}, 1),
+		reporterReset: make(chan struct{}, 1),
+		serverReset:   make(chan struct{}, 1),
+		exporterReset: make(chan struct{}, 1),
+
+		stats:     newAgentStats(),
+		conn:      newConnectionTracker(filepath.Join(config.DataDir, connectionFileName)),
+		endpoints: newEndpointSelector(filepath.Join(config.DataDir, endpointFileName)),
+		nonces:    newNonceCache(filepath.Join(config.DataDir, nonceFileName), maxNonces),
+
+		commandQueue: make(chan ServerCommand, 64),
+		commandSlots: make(chan struct{}, maxConcurrentCommands),
+		connLost:     make(chan struct{}, 1),
+		flushNow:     make(chan struct{}, 1),
+		alerts:       make(map[string]bool),
+	}
+	if level, err := parseLogLevel(config.LogLevel); err == nil {
+		service.logLevel = level
 	}
 
 	// 初始化日志
 	service.initLogger()
 
-	return service
+	if loaded.Path != "" {
+		service.logInfo("⚙️ 已加载配置文件: %s", loaded.Path)
+	} else {
+		service.logInfo("⚙️ 未找到配置文件 %s，使用默认配置", ConfigFileName)
+	}
+	for _, warning := range loaded.Warnings {
+		service.logWarn("⚠️ %s", warning)
+	}
+
+	outbox, err := openOutbox(filepath.Join(config.DataDir, outboxDirName), config.QueueMaxSize, config.QueueMaxAge)
+	if err != nil {
+		service.logWarn("⚠️ %v", err)
+	}
+	if count, size := outbox.Len(); count > 0 {
+		service.logInfo("📤 离线队列中有 %d 条待补报的消息 (%s)", count, formatBytes(size))
+	}
+	service.outbox = outbox
+
+	// 未显式配置节点ID时使用持久化的节点身份
+	if config.NodeID == "" {
+		withID := *config
+		withID.NodeID = service.resolveNodeID(config.DataDir)
+		service.config = &withID
+	}
+
+	history, err := openMetricsHistory(config.DataDir, config.HistoryRetention)
+	if err != nil {
+		service.logWarn("⚠️ %v，指标历史只保留在内存中", err)
+	}
+	service.history = history
+
+	return service, nil
 }
 
 // initLogger 初始化日志系统
@@ -123,28 +283,49 @@ func (a *AgentService) initLogger() {
 } // getDefaultConfig 获取默认配置
 func getDefaultConfig() *AgentConfig {
 	return &AgentConfig{
-		ServerURL:       "https://star.newlifex.com",
-		ServerPort:      443,
-		NodeID:          generateNodeID(),
-		NodeName:        getHostname(),
-		NodeRegion:      "default",
-		MonitorInterval: 30 * time.Second,
-		ReportInterval:  60 * time.Second,
-		MaxCPU:          80.0,
-		MaxMemory:       2 * 1024 * 1024 * 1024, // 2GB
+		ServerURL:           "https://star.newlifex.com",
+		ServerPort:          443,
+		ServerTimeout:       15 * time.Second,
+		ServerProbeInterval: 5 * time.Minute,
+		ServerClockSkew:     5 * time.Minute,
+		ServerTLSMinVersion: "1.2",
+		NodeID:              "", // 为空时使用持久化的节点身份
+		NodeName:            getHostname(),
+		NodeRegion:          "default",
+		MonitorInterval:     30 * time.Second,
+		ReportInterval:      60 * time.Second,
+		HistoryRetention:    24 * time.Hour,
+		ProcRoot:            "/proc",
+		SysRoot:             "/sys",
+		EtcRoot:             "/etc",
+		TopProcesses:        10,
+		MaxCPU:              80.0,
+		MaxMemory:           2 * 1024 * 1024 * 1024, // 2GB
+		LogLevel:            "info",
+		QueueMaxSize:        64 * 1024 * 1024, // 64MB
+		QueueMaxAge:         72 * time.Hour,
+		ExecPolicyFile:      filepath.Join(systemConfigDir(), execPolicyFileName),
+		ListenHost:          "127.0.0.1",
+		ListenPort:          0,
+		DataDir:             systemDataDir(),
 	}
 }
 
 // Start 启动代理服务
 func (a *AgentService) Start() error {
+	config := a.getConfig()
 	a.logInfo("🚀 星尘代理服务启动中...")
-	a.logInfo("节点ID: %s", a.config.NodeID)
-	a.logInfo("节点名称: %s", a.config.NodeName)
-	a.logInfo("服务端: %s:%d", a.config.ServerURL, a.config.ServerPort)
-	a.logInfo("监控间隔: %v, 报告间隔: %v", a.config.MonitorInterval, a.config.ReportInterval)
+	a.logInfo("节点ID: %s", config.NodeID)
+	a.logInfo("节点名称: %s", config.NodeName)
+	a.logInfo("服务端: %s", strings.Join(serverEndpoints(config), ", "))
+	a.logInfo("监控间隔: %v, 报告间隔: %v", config.MonitorInterval, config.ReportInterval)
+
+	a.nodeInfo = collectNodeInfo(systemRootFromConfig(config))
+	a.logInfo("主机: %s, 系统: %s, 内核: %s", a.nodeInfo.Hostname, valueOrUnknown(a.nodeInfo.OSName), valueOrUnknown(a.nodeInfo.KernelVersion))
+	a.logInfo("CPU: %s (%d 核), 内存: %s", valueOrUnknown(a.nodeInfo.CPUModel), a.nodeInfo.CPUCores, formatBytes(a.nodeInfo.TotalMemory))
 
 	// 启动各个服务组件
-	a.wg.Add(4)
+	a.wg.Add(6)
 
 	// 1. 节点监控服务
 	go a.runNodeMonitor()
@@ -158,6 +339,13 @@ func (a *AgentService) Start() error {
 	// 4. 状态报告器
 	go a.runStatusReporter()
 
+	// 5. 配置监视器
+	go a.runConfigWatcher()
+
+	// 6. 指标接口
+	go a.runMetricsExporter()
+
+	a.recordEvent(eventInfo, "agent_started", fmt.Sprintf("%s %s", AppName, Version))
 	a.logInfo("✅ 星尘代理服务已启动")
 
 	// 等待所有服务停止
@@ -172,6 +360,7 @@ func (a *AgentService) Stop() {
 	a.logger.Printf("🛑 正在停止星尘代理服务...")
 	a.cancel()
 	a.wg.Wait()
+	a.history.Close()
 
 	// 关闭日志文件
 	if a.logFile != nil {
@@ -182,44 +371,101 @@ func (a *AgentService) Stop() {
 // runNodeMonitor 运行节点监控
 func (a *AgentService) runNodeMonitor() {
 	defer a.wg.Done()
+	a.stats.setComponent(componentMonitor, true)
+	defer a.stats.setComponent(componentMonitor, false)
+
+	config := a.getConfig()
+	interval := config.MonitorInterval
+	root := systemRootFromConfig(config)
+	topProcesses := config.TopProcesses
+	collector := NewMetricsCollector(root, topProcesses)
 
-	ticker := time.NewTicker(a.config.MonitorInterval)
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	a.logger.Printf("📊 节点监控服务已启动 (间隔: %v)", a.config.MonitorInterval)
+	a.logger.Printf("📊 节点监控服务已启动 (间隔: %v)", interval)
 
 	for {
 		select {
 		case <-a.ctx.Done():
 			a.logger.Printf("📊 节点监控服务已停止")
 			return
+		case <-a.monitorReset:
+			config = a.getConfig()
+			if config.MonitorInterval != interval {
+				interval = config.MonitorInterval
+				ticker.Reset(interval)
+				a.logger.Printf("📊 节点监控间隔已更新为 %v", interval)
+			}
+			if newRoot := systemRootFromConfig(config); newRoot != root || config.TopProcesses != topProcesses {
+				root, topProcesses = newRoot, config.TopProcesses
+				collector = NewMetricsCollector(root, topProcesses)
+				a.logger.Printf("📊 指标采集器已更新: %s, %s, 进程排行 %d", root.Proc, root.Sys, topProcesses)
+			}
 		case <-ticker.C:
-			a.collectNodeMetrics()
+			a.collectNodeMetrics(collector)
 		}
 	}
 }
 
 // runServerConnection 运行服务端连接管理
+// 连接失败或断开后按指数退避重连，服务端配置变更时立即重连
 func (a *AgentService) runServerConnection() {
 	defer a.wg.Done()
+	defer a.stats.setComponent(componentServer, false)
+	defer a.conn.set(StateDisconnected, "")
 
 	a.logger.Printf("🔗 服务端连接管理器已启动")
+	retry := newBackoff(reconnectBaseDelay, reconnectMaxDelay)
 
-	// 连接重试逻辑
 	for {
+		// 即将使用最新配置连接，忽略之前的重连通知
 		select {
 		case <-a.ctx.Done():
 			a.logger.Printf("🔗 服务端连接管理器已停止")
 			return
+		case <-a.serverReset:
 		default:
-			if err := a.connectToServer(); err != nil {
-				a.logger.Printf("❌ 连接服务端失败: %v, 5秒后重试", err)
-				time.Sleep(5 * time.Second)
-			} else {
-				a.logger.Printf("✅ 已连接到服务端")
-				// 保持连接，监听服务端指令
-				a.handleServerCommands()
-			}
+		}
+
+		err := a.connectToServer()
+		a.stats.recordConnect(err)
+		endpointDown := err != nil
+		if err == nil {
+			a.logger.Printf("✅ 已登录服务端")
+			// 保持连接，监听服务端指令
+			err = a.handleServerCommands(retry)
+			a.stats.setComponent(componentServer, false)
+			a.setClient(nil)
+			var dialErr *notifyDialError
+			endpointDown = errors.As(err, &dialErr)
+		}
+		if endpointDown && a.ctx.Err() == nil && !a.endpoints.Failed() {
+			// 还有未尝试的服务端地址，立即切换
+			_, next := a.endpoints.Current()
+			a.conn.fail(err, 0)
+			a.logger.Printf("❌ 服务端连接失败: %v, 切换到 %s", err, next)
+			continue
+		}
+		if a.ctx.Err() != nil {
+			continue
+		}
+		if err == nil {
+			// 服务端配置变更，立即重连
+			retry.Reset()
+			continue
+		}
+
+		delay := retry.Next()
+		a.conn.fail(err, delay)
+		a.logger.Printf("❌ 服务端连接失败: %v, %v 后重试", err, delay.Round(time.Millisecond))
+
+		select {
+		case <-a.ctx.Done():
+		case <-a.serverReset:
+			a.logger.Printf("🔗 服务端配置已变更，立即重连")
+			retry.Reset()
+		case <-time.After(delay):
 		}
 	}
 }
@@ -227,6 +473,8 @@ func (a *AgentService) runServerConnection() {
 // runResourceScheduler 运行资源调度器
 func (a *AgentService) runResourceScheduler() {
 	defer a.wg.Done()
+	a.stats.setComponent(componentScheduler, true)
+	defer a.stats.setComponent(componentScheduler, false)
 
 	a.logger.Printf("⚡ 资源调度器已启动")
 
@@ -238,7 +486,7 @@ func (a *AgentService) runResourceScheduler() {
 		default:
 			// 处理调度任务
 			a.processScheduledTasks()
-			time.Sleep(10 * time.Second)
+			sleepContext(a.ctx, 10*time.Second)
 		}
 	}
 }
@@ -246,57 +494,132 @@ func (a *AgentService) runResourceScheduler() {
 // runStatusReporter 运行状态报告器
 func (a *AgentService) runStatusReporter() {
 	defer a.wg.Done()
+	a.stats.setComponent(componentReporter, true)
+	defer a.stats.setComponent(componentReporter, false)
 
-	ticker := time.NewTicker(a.config.ReportInterval)
+	interval := a.getConfig().ReportInterval
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	a.logger.Printf("📡 状态报告器已启动 (间隔: %v)", a.config.ReportInterval)
+	a.logger.Printf("📡 状态报告器已启动 (间隔: %v)", interval)
+
+	// 每次报告汇总上一次报告之后采集的样本
+	windowStart := time.Now()
 
 	for {
 		select {
 		case <-a.ctx.Done():
 			a.logger.Printf("📡 状态报告器已停止")
 			return
-		case <-ticker.C:
-			a.reportNodeStatus()
+		case <-a.reporterReset:
+			interval = a.getConfig().ReportInterval
+			ticker.Reset(interval)
+			a.logger.Printf("📡 状态报告间隔已更新为 %v", interval)
+		case now := <-ticker.C:
+			a.reportNodeStatus(windowStart)
+			windowStart = now
+		case <-a.flushNow:
+			if client := a.getClient(); client != nil {
+				a.flushOutbox(client)
+			}
 		}
 	}
 }
 
 // collectNodeMetrics 收集节点指标
-func (a *AgentService) collectNodeMetrics() {
-	// 模拟收集CPU、内存、磁盘等指标
-	a.logger.Printf("📊 收集节点指标: CPU=25%%, 内存=60%%, 磁盘=45%%")
-}
+func (a *AgentService) collectNodeMetrics(collector *MetricsCollector) {
+	metrics, err := collector.Collect()
+	if err != nil {
+		a.logWarn("⚠️ %v", err)
+	}
 
-// connectToServer 连接到服务端
-func (a *AgentService) connectToServer() error {
-	// 模拟连接逻辑
-	a.logger.Printf("🔗 正在连接服务端 %s:%d...", a.config.ServerURL, a.config.ServerPort)
+	a.metricsMu.Lock()
+	a.latestMetrics = metrics
+	a.metricsMu.Unlock()
 
-	// 模拟连接延迟
-	time.Sleep(2 * time.Second)
+	if err := a.history.Add(sampleFromMetrics(metrics)); err != nil {
+		a.logWarn("⚠️ %v", err)
+	}
 
-	// 模拟连接成功/失败
-	// 这里可以实现真实的HTTP/gRPC/WebSocket连接
-	return nil
+	a.logger.Printf("📊 收集节点指标: %s", metrics.Summary())
+	for _, d := range metrics.DiskIO {
+		a.logDebug("💽 %s: 读 %.1f IOPS %s/s, 写 %.1f IOPS %s/s, 利用率 %.1f%%, await %.1fms", d.Device,
+			d.ReadIOPS, formatBytes(int64(d.ReadBytesRate)), d.WriteIOPS, formatBytes(int64(d.WriteBytesRate)), d.Utilization, d.AwaitMillis)
+	}
+	for _, p := range metrics.Pressure {
+		a.logDebug("⏳ PSI %s: some %.2f/%.2f/%.2f, full %.2f/%.2f/%.2f", p.Resource,
+			p.SomeAvg10, p.SomeAvg60, p.SomeAvg300, p.FullAvg10, p.FullAvg60, p.FullAvg300)
+	}
+	for _, n := range metrics.Network {
+		a.logDebug("📶 %s: ↓%s/s (%.0f pps) ↑%s/s (%.0f pps)", n.Interface,
+			formatBytes(int64(n.RxBytesRate)), n.RxPacketsRate, formatBytes(int64(n.TxBytesRate)), n.TxPacketsRate)
+		if n.RxErrors+n.TxErrors+n.RxDropped+n.TxDropped > 0 {
+			a.logWarn("⚠️ 网卡 %s 本周期出现错误/丢包: 接收错误 %d, 发送错误 %d, 接收丢弃 %d, 发送丢弃 %d",
+				n.Interface, n.RxErrors, n.TxErrors, n.RxDropped, n.TxDropped)
+		}
+	}
+	if s := metrics.Sensors; s != nil {
+		for _, t := range s.Temperatures {
+			a.logDebug("🌡️ %s/%s: %.1f°C (高温 %.0f°C, 临界 %.0f°C)", t.Chip, t.Label, t.Celsius, t.High, t.Critical)
+		}
+		for _, f := range s.Fans {
+			a.logDebug("🌀 %s/%s: %.0f RPM", f.Chip, f.Label, f.RPM)
+		}
+		hot := s.Overheated()
+		for _, t := range hot {
+			a.logWarn("🔥 %s/%s 温度过高: %.1f°C", t.Chip, t.Label, t.Celsius)
+		}
+		remark := ""
+		if len(hot) > 0 {
+			remark = fmt.Sprintf("%s/%s %.1f°C", hot[0].Chip, hot[0].Label, hot[0].Celsius)
+		}
+		a.updateAlert("overheat", len(hot) > 0, remark)
+
+		throttling := s.Throttling()
+		if throttling {
+			a.logWarn("🔥 CPU 正在过热降频: 本周期降频 %d 次, 当前频率 %.0f/%.0f MHz", s.ThrottleEvents, s.CPUFreqMHz, s.CPUMaxFreqMHz)
+		}
+		a.updateAlert("cpu_throttling", throttling, fmt.Sprintf("%.0f/%.0f MHz", s.CPUFreqMHz, s.CPUMaxFreqMHz))
+
+		onBattery, mainsLost := false, false
+		for _, p := range s.PowerSupplies {
+			if (p.Type == "Battery" || p.Type == "UPS") && p.Status == "Discharging" {
+				a.logWarn("🔋 %s 正在放电，剩余电量 %d%%", p.Name, p.Capacity)
+				onBattery = true
+			} else if p.Type == "Mains" && !p.Online {
+				a.logWarn("🔌 %s 外部供电已断开", p.Name)
+				mainsLost = true
+			}
+		}
+		a.updateAlert("power_lost", onBattery || mainsLost, "")
+	}
 }
 
-// handleServerCommands 处理服务端指令
-func (a *AgentService) handleServerCommands() {
-	a.logger.Printf("👂 开始监听服务端指令...")
+// getLatestMetrics 获取最近一次采集的节点指标，尚未采集时返回 nil
+func (a *AgentService) getLatestMetrics() *NodeMetrics {
+	a.metricsMu.RLock()
+	defer a.metricsMu.RUnlock()
+	return a.latestMetrics
+}
 
-	// 模拟保持连接并处理指令
-	for {
-		select {
-		case <-a.ctx.Done():
-			return
-		default:
-			// 模拟接收和处理服务端指令
-			time.Sleep(30 * time.Second)
-			a.logger.Printf("📨 处理服务端指令: 心跳检测")
+// queryProcessesCommand 处理 ps 指令，参数 sort 为 cpu、memory 或 io，limit 为返回数量
+func (a *AgentService) queryProcessesCommand(args commandArgs) ([]ProcessInfo, error) {
+	limit := a.getConfig().TopProcesses
+	if n := args.Int("limit", -1); n != -1 {
+		if n <= 0 {
+			return nil, commandErrorf(codeInvalidArgument, "limit 参数无效: %d", n)
 		}
+		limit = int(n)
 	}
+	if limit <= 0 {
+		limit = 10
+	}
+
+	snapshot, err := queryProcesses(systemRootFromConfig(a.getConfig()), limit, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot.ProcessList(args.String("sort"))
 }
 
 // processScheduledTasks 处理调度任务
@@ -306,41 +629,113 @@ func (a *AgentService) processScheduledTasks() {
 }
 
 // reportNodeStatus 报告节点状态
-func (a *AgentService) reportNodeStatus() {
-	a.logger.Printf("📡 向服务端报告节点状态")
+// 除最新快照外，附带报告窗口内各项指标的最小、最大、平均值和 P95
+func (a *AgentService) reportNodeStatus(since time.Time) {
+	metrics := a.getLatestMetrics()
+	if metrics == nil {
+		a.logger.Printf("📡 尚未采集到节点指标，跳过本次状态报告")
+		return
+	}
+
+	aggregate := aggregateSamples(a.history.Since(since))
+	a.metricsMu.Lock()
+	a.latestReport = aggregate
+	a.metricsMu.Unlock()
+
+	if aggregate != nil {
+		a.logDebug("📡 报告周期聚合: %s", aggregate.Summary())
+	}
+
+	req := buildPingRequest(metrics, aggregate, a.nodeInfo)
+	client := a.getClient()
+	if client == nil {
+		a.logger.Printf("📡 尚未连接服务端，状态报告已加入离线队列: %s", metrics.Summary())
+		a.queueOutbox(outboxReport, req)
+		return
+	}
+	if err := a.sendPing(client, req); err != nil {
+		a.logWarn("⚠️ 状态报告失败，已加入离线队列: %v", err)
+		a.queueOutbox(outboxReport, req)
+		notifyReset(a.connLost)
+		return
+	}
+	a.logger.Printf("📡 已向服务端报告节点状态: %s", metrics.Summary())
+	a.stats.recordReport(time.Now())
+	a.flushOutbox(client)
+	if metrics.Processes != nil {
+		for _, p := range metrics.Processes.ByCPU {
+			a.logDebug("🧮 [%d] %s (%s): CPU %.1f%%, RSS %s, 读 %s/s, 写 %s/s", p.PID, p.Name, p.User,
+				p.CPUPercent, formatBytes(p.RSS), formatBytes(int64(p.ReadBytesRate)), formatBytes(int64(p.WriteBytesRate)))
+		}
+	}
 }
 
 // 辅助函数
-func generateNodeID() string {
-	return fmt.Sprintf("node-%d", time.Now().Unix())
+func getHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "localhost"
+	}
+	return hostname
 }
 
-func getHostname() string {
-	// 简化实现，实际应该获取真实主机名
-	return "localhost"
+// resolveNodeID 获取持久化的节点身份，无法保存时使用本次生成的ID
+func (a *AgentService) resolveNodeID(dataDir string) string {
+	identity, status, err := resolveNodeIdentity(dataDir)
+	switch {
+	case err != nil && identity == nil:
+		a.logError("❌ 读取节点身份失败: %v", err)
+		identity = newNodeIdentity("", "", hardwareFingerprint())
+		a.logWarn("⚠️ 使用临时节点ID %s，重启后可能变化", identity.NodeID)
+	case err != nil:
+		a.logWarn("⚠️ 保存节点身份失败: %v，重启后将重新生成", err)
+	case status == identityCreated:
+		a.logInfo("🆔 已生成节点身份 %s (依据: %s)，保存于 %s", identity.NodeID, strings.Join(identity.Sources, ", "), identityPath(dataDir))
+	case status == identityCloned:
+		a.logWarn("⚠️ 硬件指纹与节点 %s 不符，判定为克隆设备，已生成新的节点身份 %s", identity.ClonedFrom, identity.NodeID)
+	default:
+		a.logDebug("🆔 已加载节点身份 %s", identity.NodeID)
+	}
+
+	a.identity = identity
+	return identity.NodeID
+}
+
+// getConfig 获取当前配置，返回的配置不可修改
+func (a *AgentService) getConfig() *AgentConfig {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.config
+}
+
+// getLogLevel 获取当前日志级别
+func (a *AgentService) getLogLevel() LogLevel {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.logLevel
 }
 
 // 日志方法
 func (a *AgentService) logDebug(format string, v ...interface{}) {
-	if a.logLevel <= LogLevelDebug && a.logger != nil {
+	if a.getLogLevel() <= LogLevelDebug && a.logger != nil {
 		a.logger.Printf("[DEBUG] "+format, v...)
 	}
 }
 
 func (a *AgentService) logInfo(format string, v ...interface{}) {
-	if a.logLevel <= LogLevelInfo && a.logger != nil {
+	if a.getLogLevel() <= LogLevelInfo && a.logger != nil {
 		a.logger.Printf("[INFO] "+format, v...)
 	}
 }
 
 func (a *AgentService) logWarn(format string, v ...interface{}) {
-	if a.logLevel <= LogLevelWarn && a.logger != nil {
+	if a.getLogLevel() <= LogLevelWarn && a.logger != nil {
 		a.logger.Printf("[WARN] "+format, v...)
 	}
 }
 
 func (a *AgentService) logError(format string, v ...interface{}) {
-	if a.logLevel <= LogLevelError && a.logger != nil {
+	if a.getLogLevel() <= LogLevelError && a.logger != nil {
 		a.logger.Printf("[ERROR] "+format, v...)
 	}
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 服务组件名称，用于运行状态统计
+const (
+	componentMonitor   = "monitor"
+	componentServer    = "server"
+	componentScheduler = "scheduler"
+	componentReporter  = "reporter"
+	componentWatcher   = "config_watcher"
+	componentExporter  = "exporter"
+)
+
+// agentStats 代理自身的运行统计
+type agentStats struct {
+	mu              sync.Mutex
+	startTime       time.Time
+	components      map[string]bool // 组件名 -> 是否正常运行
+	connectAttempts uint64          // 连接服务端次数
+	connectFailures uint64          // 连接失败次数
+	reconnects      uint64          // 首次连接成功之后的重新连接次数
+	connected       bool            // 是否曾经连接成功
+	lastReport      time.Time       // 最近一次状态报告时间
+}
+
+// agentStatsSnapshot 运行统计快照
+type agentStatsSnapshot struct {
+	StartTime       time.Time
+	Components      map[string]bool
+	ConnectAttempts uint64
+	ConnectFailures uint64
+	Reconnects      uint64
+	LastReport      time.Time
+}
+
+// newAgentStats 创建运行统计
+func newAgentStats() *agentStats {
+	return &agentStats{startTime: time.Now(), components: make(map[string]bool)}
+}
+
+// setComponent 记录组件运行状态
+func (s *agentStats) setComponent(name string, up bool) {
+	s.mu.Lock()
+	s.components[name] = up
+	s.mu.Unlock()
+}
+
+// clearComponent 移除未启用的组件
+func (s *agentStats) clearComponent(name string) {
+	s.mu.Lock()
+	delete(s.components, name)
+	s.mu.Unlock()
+}
+
+// recordConnect 记录一次服务端连接结果
+func (s *agentStats) recordConnect(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connectAttempts++
+	if err != nil {
+		s.connectFailures++
+		return
+	}
+	if s.connected {
+		s.reconnects++
+	}
+	s.connected = true
+}
+
+// recordReport 记录一次状态报告
+func (s *agentStats) recordReport(t time.Time) {
+	s.mu.Lock()
+	s.lastReport = t
+	s.mu.Unlock()
+}
+
+// snapshot 获取运行统计快照
+func (s *agentStats) snapshot() agentStatsSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	components := make(map[string]bool, len(s.components))
+	for name, up := range s.components {
+		components[name] = up
+	}
+	return agentStatsSnapshot{
+		StartTime:       s.startTime,
+		Components:      components,
+		ConnectAttempts: s.connectAttempts,
+		ConnectFailures: s.connectFailures,
+		Reconnects:      s.reconnects,
+		LastReport:      s.lastReport,
+	}
+}
+
+// ComponentNames 按名称排序的组件列表
+func (s agentStatsSnapshot) ComponentNames() []string {
+	names := make([]string, 0, len(s.Components))
+	for name := range s.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 指令执行参数
+const (
+	defaultCommandTimeout = 30 * time.Second // 处理器未指定超时时的默认值
+	maxConcurrentCommands = 4                // 同时执行的指令数
+)
+
+// 指令结果中的错误码
+const (
+	codeUnsupported     = "unsupported"      // 不支持的指令
+	codeInvalidArgument = "invalid_argument" // 参数不符合定义
+	codeExpired         = "expired"          // 指令送达时已过期
+	codeTimeout         = "timeout"          // 执行超时
+	codeCancelled       = "cancelled"        // 服务停止，执行被取消
+	codeDenied          = "denied"           // 本机策略禁止执行
+	codeExitStatus      = "exit_status"      // 进程以非 0 退出码结束
+	codeFailed          = "failed"           // 其他执行错误
+)
+
+// CommandResult 指令执行结果，序列化后作为 CommandReply.Data 回复服务端
+type CommandResult struct {
+	Success  bool        `json:"success"`
+	Output   interface{} `json:"output,omitempty"`
+	Code     string      `json:"code,omitempty"` // 失败时的错误码
+	Error    string      `json:"error,omitempty"`
+	Duration int64       `json:"duration"` // 执行耗时，毫秒
+}
+
+// commandError 带错误码的指令错误，处理器返回的其他错误按 failed 处理
+type commandError struct {
+	Code string
+	Err  error
+}
+
+func (e *commandError) Error() string { return e.Err.Error() }
+func (e *commandError) Unwrap() error { return e.Err }
+
+// commandErrorf 创建带错误码的指令错误
+func commandErrorf(code, format string, v ...interface{}) error {
+	return &commandError{Code: code, Err: fmt.Errorf(format, v...)}
+}
+
+// argKind 指令参数类型
+type argKind int
+
+const (
+	argString   argKind = iota
+	argInt              // 整数，接受 JSON 数字或数字字符串
+	argBool             // 布尔值，接受 JSON 布尔值或 "true"/"false"
+	argDuration         // 时长，接受 "30s" 等格式或秒数
+	argList             // 字符串数组
+	argMap              // 值为字符串的对象
+)
+
+func (k argKind) String() string {
+	switch k {
+	case argInt:
+		return "int"
+	case argBool:
+		return "bool"
+	case argDuration:
+		return "duration"
+	case argList:
+		return "list"
+	case argMap:
+		return "map"
+	default:
+		return "string"
+	}
+}
+
+// commandArg 指令参数定义
+type commandArg struct {
+	Name     string
+	Kind     argKind
+	Required bool
+}
+
+// commandArgs 按参数定义转换后的参数值
+type commandArgs map[string]interface{}
+
+// String 获取字符串参数，未提供时返回空字符串
+func (a commandArgs) String(name string) string {
+	v, _ := a[name].(string)
+	return v
+}
+
+// Int 获取整数参数，未提供时返回 def
+func (a commandArgs) Int(name string, def int64) int64 {
+	if v, ok := a[name].(int64); ok {
+		return v
+	}
+	return def
+}
+
+// Bool 获取布尔参数，未提供时返回 def
+func (a commandArgs) Bool(name string, def bool) bool {
+	if v, ok := a[name].(bool); ok {
+		return v
+	}
+	return def
+}
+
+// Duration 获取时长参数，未提供时返回 def
+func (a commandArgs) Duration(name string, def time.Duration) time.Duration {
+	if v, ok := a[name].(time.Duration); ok {
+		return v
+	}
+	return def
+}
+
+// List 获取字符串数组参数
+func (a commandArgs) List(name string) []string {
+	v, _ := a[name].([]string)
+	return v
+}
+
+// Map 获取对象参数
+func (a commandArgs) Map(name string) map[string]string {
+	v, _ := a[name].(map[string]string)
+	return v
+}
+
+// commandHandler 指令处理器
+type commandHandler struct {
+	Name     string
+	Args     []commandArg
+	Timeout  time.Duration // 为 0 时使用 defaultCommandTimeout
+	Unsigned bool          // 节点未注册（没有节点密钥）时也允许执行，只用于只读查询
+	Run      func(ctx context.Context, a *AgentService, args commandArgs) (interface{}, error)
+}
+
+// commandHandlers 支持的服务端指令，新增指令在这里注册
+var commandHandlers = []*commandHandler{
+	{
+		Name:     "ps",
+		Args:     []commandArg{{Name: "sort", Kind: argString}, {Name: "limit", Kind: argInt}},
+		Timeout:  10 * time.Second,
+		Unsigned: true,
+		Run: func(ctx context.Context, a *AgentService, args commandArgs) (interface{}, error) {
+			return a.queryProcessesCommand(args)
+		},
+	},
+	{
+		Name: "exec",
+		Args: []commandArg{
+			{Name: "program", Kind: argString, Required: true},
+			{Name: "args", Kind: argList},
+			{Name: "workdir", Kind: argString},
+			{Name: "env", Kind: argMap},
+			{Name: "timeout", Kind: argDuration},
+		},
+		// 实际超时由执行策略控制，这里只兜底
+		Timeout: maxExecTimeout + time.Minute,
+		Run: func(ctx context.Context, a *AgentService, args commandArgs) (interface{}, error) {
+			result, err := a.execCommand(ctx, args)
+			if result == nil {
+				return nil, err
+			}
+			return result, err
+		},
+	},
+	{
+		Name: "rotate_secret",
+		Run: func(ctx context.Context, a *AgentService, args commandArgs) (interface{}, error) {
+			if err := a.rotateSecret(ctx, a.getClient()); err != nil {
+				return nil, err
+			}
+			return map[string]string{"result": "节点密钥已轮换"}, nil
+		},
+	},
+}
+
+// commandVerifiedKey 上下文中标记指令已通过签名校验
+type commandVerifiedKey struct{}
+
+// commandVerified 指令是否来自已注册节点且通过了签名校验
+func commandVerified(ctx context.Context) bool {
+	verified, _ := ctx.Value(commandVerifiedKey{}).(bool)
+	return verified
+}
+
+// findCommandHandler 查找指令处理器，不支持的指令返回 nil
+func findCommandHandler(name string) *commandHandler {
+	for _, h := range commandHandlers {
+		if h.Name == name {
+			return h
+		}
+	}
+	return nil
+}
+
+// parseArgs 按参数定义解析指令参数，参数为空时视为空对象
+// 未定义的参数、类型不符或缺少必填参数时返回 invalid_argument 错误
+func (h *commandHandler) parseArgs(argument string) (commandArgs, error) {
+	raw := make(map[string]interface{})
+	if s := strings.TrimSpace(argument); s != "" && s != "null" {
+		if err := json.Unmarshal([]byte(s), &raw); err != nil {
+			return nil, commandErrorf(codeInvalidArgument, "参数必须是 JSON 对象: %v", err)
+		}
+	}
+
+	args := make(commandArgs)
+	for _, def := range h.Args {
+		v, ok := raw[def.Name]
+		delete(raw, def.Name)
+		if !ok || v == nil {
+			if def.Required {
+				return nil, commandErrorf(codeInvalidArgument, "缺少参数 %s", def.Name)
+			}
+			continue
+		}
+		value, err := convertArg(def.Kind, v)
+		if err != nil {
+			return nil, commandErrorf(codeInvalidArgument, "参数 %s 应为 %s: %v", def.Name, def.Kind, err)
+		}
+		args[def.Name] = value
+	}
+
+	if len(raw) > 0 {
+		unknown := make([]string, 0, len(raw))
+		for name := range raw {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return nil, commandErrorf(codeInvalidArgument, "不支持的参数: %s", strings.Join(unknown, ", "))
+	}
+	return args, nil
+}
+
+// convertArg 将 JSON 值转换为参数类型
+func convertArg(kind argKind, v interface{}) (interface{}, error) {
+	switch kind {
+	case argInt:
+		switch v := v.(type) {
+		case float64:
+			if v != math.Trunc(v) {
+				return nil, fmt.Errorf("%v 不是整数", v)
+			}
+			return int64(v), nil
+		case string:
+			return strconv.ParseInt(v, 10, 64)
+		}
+	case argBool:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case string:
+			return strconv.ParseBool(v)
+		}
+	case argDuration:
+		switch v := v.(type) {
+		case float64:
+			return time.Duration(v * float64(time.Second)), nil
+		case string:
+			return parseConfigDuration(v)
+		}
+	case argList:
+		if items, ok := v.([]interface{}); ok {
+			list := make([]string, 0, len(items))
+			for _, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("数组元素 %v 不是字符串", item)
+				}
+				list = append(list, s)
+			}
+			return list, nil
+		}
+	case argMap:
+		if fields, ok := v.(map[string]interface{}); ok {
+			m := make(map[string]string, len(fields))
+			for k, item := range fields {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s 的值不是字符串", k)
+				}
+				m[k] = s
+			}
+			return m, nil
+		}
+	default:
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case float64, bool:
+			return fmt.Sprint(v), nil
+		}
+	}
+	return nil, fmt.Errorf("类型不符 (%T)", v)
+}
+
+// run 在独立的超时内执行处理器
+// 超时或服务停止时立即返回，未响应取消的处理器在后台继续运行至结束，结果被丢弃
+func (h *commandHandler) run(parent context.Context, a *AgentService, args commandArgs) (interface{}, error) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	type result struct {
+		output interface{}
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := h.Run(ctx, a, args)
+		done <- result{output, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil && ctx.Err() != nil {
+			return nil, contextError(ctx, timeout)
+		}
+		return r.output, r.err
+	case <-ctx.Done():
+		return nil, contextError(ctx, timeout)
+	}
+}
+
+// contextError 将上下文结束的原因转换为指令错误
+func contextError(ctx context.Context, timeout time.Duration) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return commandErrorf(codeTimeout, "执行超时 (%v)", timeout)
+	}
+	return commandErrorf(codeCancelled, "服务停止，执行已取消")
+}
+
+// newCommandResult 根据执行结果构造回复内容，失败时处理器返回的输出（如进程的部分输出）一并回复
+func newCommandResult(output interface{}, err error, duration time.Duration) *CommandResult {
+	result := &CommandResult{Success: err == nil, Output: output, Duration: duration.Milliseconds()}
+	if err != nil {
+		result.Code, result.Error = codeFailed, err.Error()
+		var cmdErr *commandError
+		if errors.As(err, &cmdErr) {
+			result.Code = cmdErr.Code
+		}
+	}
+	return result
+}
+
+// Status 对应的指令状态，过期和取消的指令视为取消，其他错误视为失败
+func (r *CommandResult) Status() CommandStatus {
+	switch {
+	case r.Success:
+		return CommandSucceeded
+	case r.Code == codeExpired || r.Code == codeCancelled:
+		return CommandCancelled
+	default:
+		return CommandFailed
+	}
+}
+
+// dispatchCommand 在后台执行指令，同时执行的指令不超过 maxConcurrentCommands 条，
+// 长时间运行的指令不会阻塞指令通道的心跳
+func (a *AgentService) dispatchCommand(cmd ServerCommand) {
+	a.commandWG.Add(1)
+	go func() {
+		defer a.commandWG.Done()
+		select {
+		case a.commandSlots <- struct{}{}:
+		case <-a.ctx.Done():
+			return
+		}
+		defer func() { <-a.commandSlots }()
+		a.handleCommand(cmd)
+	}()
+}
+
+// handleCommand 校验并执行一条服务端指令
+// 参数有效时先回复处理中作为收到确认，执行结束后回复结构化的结果
+func (a *AgentService) handleCommand(cmd ServerCommand) {
+	client := a.getClient()
+	if client == nil {
+		return
+	}
+
+	// 不支持的指令不会执行，无需校验签名，直接回复避免服务端一直等待结果
+	handler := findCommandHandler(cmd.Command)
+	if handler == nil {
+		err := commandErrorf(codeUnsupported, "不支持的指令: %s", cmd.Command)
+		a.logWarn("⚠️ 指令 %s [%d] 未执行: %v", cmd.Command, cmd.ID, err)
+		a.replyCommand(cmd, newCommandResult(nil, err, 0))
+		return
+	}
+
+	// 签名无效或重放的指令不回复，避免覆盖服务端记录的原指令结果
+	// 节点未注册时只允许执行标记为 Unsigned 的只读指令
+	ctx := a.ctx
+	if err := client.VerifyCommand(&cmd, a.nonces, a.getConfig().ServerClockSkew); err == nil {
+		ctx = context.WithValue(ctx, commandVerifiedKey{}, true)
+	} else if !errors.Is(err, errNoSecret) || !handler.Unsigned {
+		a.logWarn("⚠️ 拒绝指令 %s [%d]: %v", cmd.Command, cmd.ID, err)
+		a.recordEvent(eventAlert, "command_rejected", fmt.Sprintf("%s [%d]: %v", cmd.Command, cmd.ID, err))
+		return
+	}
+
+	start := time.Now()
+	var args commandArgs
+	var err error
+	if cmd.Expire > 0 && start.UnixMilli() > cmd.Expire {
+		err = commandErrorf(codeExpired, "指令已过期")
+	} else {
+		args, err = handler.parseArgs(cmd.Argument)
+	}
+	if err != nil {
+		a.logWarn("⚠️ 指令 %s [%d] 未执行: %v", cmd.Command, cmd.ID, err)
+		a.replyCommand(cmd, newCommandResult(nil, err, 0))
+		return
+	}
+
+	a.logInfo("📨 执行服务端指令: %s [%d]", cmd.Command, cmd.ID)
+	a.sendCommandReply(cmd, &CommandReply{ID: cmd.ID, Status: CommandHandling})
+
+	output, err := handler.run(ctx, a, args)
+	result := newCommandResult(output, err, time.Since(start))
+	if err != nil {
+		a.logWarn("⚠️ 指令 %s [%d] 执行失败 (%s): %v", cmd.Command, cmd.ID, result.Code, err)
+	} else {
+		a.logInfo("✅ 指令 %s [%d] 执行完成，耗时 %v", cmd.Command, cmd.ID, time.Since(start).Round(time.Millisecond))
+	}
+	a.replyCommand(cmd, result)
+}
+
+// replyCommand 回复指令执行结果
+func (a *AgentService) replyCommand(cmd ServerCommand, result *CommandResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		result = newCommandResult(nil, fmt.Errorf("序列化执行结果失败: %v", err), time.Duration(result.Duration)*time.Millisecond)
+		data, _ = json.Marshal(result)
+	}
+	a.sendCommandReply(cmd, &CommandReply{ID: cmd.ID, Status: result.Status(), Data: string(data)})
+}
+
+// sendCommandReply 通过当前会话发送指令回复
+// 使用独立的超时，服务停止时被取消的指令仍能回复结果
+func (a *AgentService) sendCommandReply(cmd ServerCommand, reply *CommandReply) {
+	client := a.getClient()
+	if client == nil {
+		a.logWarn("⚠️ 回复指令 %s [%d] 失败: 尚未登录", cmd.Command, cmd.ID)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), a.getConfig().ServerTimeout)
+	defer cancel()
+	if err := client.CommandReply(ctx, reply); err != nil {
+		a.logWarn("⚠️ 回复指令 %s [%d] 失败: %v", cmd.Command, cmd.ID, err)
+	}
+}
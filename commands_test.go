@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// registerTestCommand 注册测试用的指令处理器，测试结束后移除
+func registerTestCommand(t *testing.T, h *commandHandler) {
+	saved := commandHandlers
+	commandHandlers = append(append([]*commandHandler(nil), saved...), h)
+	t.Cleanup(func() { commandHandlers = saved })
+}
+
+// replyResult 解析指令回复中的结构化结果
+func replyResult(t *testing.T, reply CommandReply) CommandResult {
+	t.Helper()
+	var result CommandResult
+	if err := json.Unmarshal([]byte(reply.Data), &result); err != nil {
+		t.Fatalf("reply %d data %q: %v", reply.ID, reply.Data, err)
+	}
+	return result
+}
+
+// connectRegistered 以已注册节点登录，节点密钥为 secret-1
+func connectRegistered(t *testing.T, standIn *starStandIn, a *AgentService) {
+	t.Helper()
+	standIn.mu.Lock()
+	standIn.secret = "secret-1"
+	standIn.mu.Unlock()
+	saveCredentials(a.getConfig().DataDir, &NodeCredentials{NodeID: "node-test", Secret: "secret-1", IssuedAt: time.Now()})
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("connectToServer: %v", err)
+	}
+}
+
+// signTestCommand 模拟服务端使用 secret-1 为指令签名
+func signTestCommand(cmd ServerCommand) ServerCommand {
+	nonce, _ := newNonce()
+	return signCommand("secret-1", cmd, time.Now(), nonce)
+}
+
+func TestCommandDispatch(t *testing.T) {
+	registerTestCommand(t, &commandHandler{
+		Name: "echo",
+		Args: []commandArg{
+			{Name: "text", Kind: argString, Required: true},
+			{Name: "times", Kind: argInt},
+			{Name: "wait", Kind: argDuration},
+			{Name: "tags", Kind: argList},
+		},
+		Timeout: 200 * time.Millisecond,
+		Run: func(ctx context.Context, a *AgentService, args commandArgs) (interface{}, error) {
+			select {
+			case <-time.After(args.Duration("wait", 0)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			return strings.Repeat(args.String("text"), int(args.Int("times", 1))) + strings.Join(args.List("tags"), ","), nil
+		},
+	})
+
+	standIn, server := newStarStandIn(t)
+	a := newTestAgentService(t, server.URL)
+	connectRegistered(t, standIn, a)
+
+	tests := []struct {
+		cmd    ServerCommand
+		status CommandStatus
+		code   string
+		output string
+		acked  bool
+	}{
+		{ServerCommand{ID: 1, Command: "echo", Argument: `{"text":"ab","times":"2","tags":["x","y"]}`}, CommandSucceeded, "", "ababx,y", true},
+		{ServerCommand{ID: 2, Command: "reboot"}, CommandFailed, codeUnsupported, "", false},
+		{ServerCommand{ID: 3, Command: "echo", Argument: `{"times":2}`}, CommandFailed, codeInvalidArgument, "", false},
+		{ServerCommand{ID: 4, Command: "echo", Argument: `{"text":"a","color":"red"}`}, CommandFailed, codeInvalidArgument, "", false},
+		{ServerCommand{ID: 5, Command: "echo", Argument: `{"text":"a","times":1.5}`}, CommandFailed, codeInvalidArgument, "", false},
+		{ServerCommand{ID: 6, Command: "echo", Argument: `{"text":"a","wait":"1s"}`}, CommandFailed, codeTimeout, "", true},
+		{ServerCommand{ID: 7, Command: "echo", Argument: `{"text":"a"}`, Expire: time.Now().Add(-time.Second).UnixMilli()}, CommandCancelled, codeExpired, "", false},
+	}
+	for _, tt := range tests {
+		standIn.mu.Lock()
+		standIn.replies = nil
+		standIn.mu.Unlock()
+		a.handleCommand(signTestCommand(tt.cmd))
+
+		replies := standIn.replies
+		if tt.acked {
+			if len(replies) != 2 || replies[0].Status != CommandHandling {
+				t.Fatalf("command %d: replies = %+v, want ack then result", tt.cmd.ID, replies)
+			}
+			replies = replies[1:]
+		}
+		if len(replies) != 1 || replies[0].ID != tt.cmd.ID || replies[0].Status != tt.status {
+			t.Fatalf("command %d: replies = %+v, want status %d", tt.cmd.ID, replies, tt.status)
+		}
+		result := replyResult(t, replies[0])
+		if result.Success != (tt.code == "") || result.Code != tt.code {
+			t.Errorf("command %d: result = %+v, want code %q", tt.cmd.ID, result, tt.code)
+		}
+		if output, _ := result.Output.(string); output != tt.output {
+			t.Errorf("command %d: output = %q, want %q", tt.cmd.ID, output, tt.output)
+		}
+	}
+}
+
+func TestCommandCancelledOnStop(t *testing.T) {
+	started := make(chan struct{})
+	registerTestCommand(t, &commandHandler{
+		Name:    "block",
+		Timeout: time.Minute,
+		Run: func(ctx context.Context, a *AgentService, args commandArgs) (interface{}, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+
+	standIn, server := newStarStandIn(t)
+	a := newTestAgentService(t, server.URL)
+	connectRegistered(t, standIn, a)
+
+	a.dispatchCommand(signTestCommand(ServerCommand{ID: 1, Command: "block"}))
+	<-started
+	a.cancel()
+	a.commandWG.Wait()
+
+	standIn.mu.Lock()
+	defer standIn.mu.Unlock()
+	if len(standIn.replies) != 2 || standIn.replies[1].Status != CommandCancelled {
+		t.Fatalf("replies = %+v, want ack then cancelled", standIn.replies)
+	}
+	if result := replyResult(t, standIn.replies[1]); result.Code != codeCancelled {
+		t.Fatalf("result = %+v, want code %s", result, codeCancelled)
+	}
+}
@@ -0,0 +1,1021 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigFileName 配置文件名
+const ConfigFileName = "config.toml"
+
+// ConfigError 配置错误，包含出错的文件和行号
+type ConfigError struct {
+	File string // 配置文件路径
+	Line int    // 行号，0 表示与具体行无关
+	Msg  string // 错误描述
+}
+
+func (e *ConfigError) Error() string {
+	switch {
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	case e.File != "":
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	default:
+		return e.Msg
+	}
+}
+
+// ConfigErrors 多个配置错误的集合
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// configEntry 配置文件中的一个键值对
+type configEntry struct {
+	Key   string // 完整键名，如 server.url
+	Value string // 去除引号后的值
+	Line  int    // 所在行号
+}
+
+// configFile 解析后的配置文件
+type configFile struct {
+	Path    string
+	Entries []configEntry
+}
+
+const (
+	// ConfigPathEnv 指定配置文件路径的环境变量
+	ConfigPathEnv = "GOAGENT_CONFIG"
+	// ConfigPathFlag 指定配置文件路径的命令行参数
+	ConfigPathFlag = "config"
+)
+
+// ConfigSource 配置项来源
+type ConfigSource string
+
+const (
+	ConfigSourceDefault ConfigSource = "default" // 内置默认值
+	ConfigSourceFile    ConfigSource = "file"    // 配置文件
+	ConfigSourceEnv     ConfigSource = "env"     // 环境变量
+	ConfigSourceFlag    ConfigSource = "flag"    // 命令行参数
+)
+
+// ConfigOrigin 配置项的具体来源
+type ConfigOrigin struct {
+	Source ConfigSource
+	File   string // 来源为配置文件时的文件路径
+	Line   int    // 来源为配置文件时的行号
+	Name   string // 来源为环境变量或命令行参数时的名称
+}
+
+func (o ConfigOrigin) String() string {
+	switch {
+	case o.Source == ConfigSourceFile:
+		return fmt.Sprintf("%s %s:%d", o.Source, o.File, o.Line)
+	case o.Name != "":
+		return fmt.Sprintf("%s %s", o.Source, o.Name)
+	default:
+		return string(o.Source)
+	}
+}
+
+// LoadedConfig 加载后的有效配置及每个配置项的来源
+type LoadedConfig struct {
+	Config   *AgentConfig
+	Path     string                  // 配置文件路径，为空表示未使用配置文件
+	Origins  map[string]ConfigOrigin // 配置键名 -> 来源
+	Warnings []string                // 不影响加载的问题，如未知的配置项
+}
+
+// configField 配置项与 AgentConfig 字段的映射
+type configField struct {
+	Key  string                               // 配置文件键名
+	Env  string                               // 环境变量名
+	Flag string                               // 命令行参数名（不含 --）
+	Set  func(c *AgentConfig, v string) error // 解析并写入字段
+	Get  func(c *AgentConfig) string          // 格式化字段值
+}
+
+// configFields 支持的配置项列表
+var configFields = []configField{
+	{
+		Key:  "server.url",
+		Env:  "GOAGENT_SERVER_URL",
+		Flag: "server-url",
+		Set: func(c *AgentConfig, v string) error {
+			c.ServerURL = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.ServerURL },
+	},
+	{
+		Key:  "server.port",
+		Env:  "GOAGENT_SERVER_PORT",
+		Flag: "server-port",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.ServerPort, err = strconv.Atoi(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return strconv.Itoa(c.ServerPort) },
+	},
+	{
+		Key:  "server.timeout",
+		Env:  "GOAGENT_SERVER_TIMEOUT",
+		Flag: "server-timeout",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.ServerTimeout, err = parseConfigDuration(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return c.ServerTimeout.String() },
+	},
+	{
+		Key:  "server.endpoints",
+		Env:  "GOAGENT_SERVER_ENDPOINTS",
+		Flag: "server-endpoints",
+		Set: func(c *AgentConfig, v string) error {
+			c.ServerEndpoints = splitConfigList(v)
+			return nil
+		},
+		Get: func(c *AgentConfig) string {
+			if len(c.ServerEndpoints) == 0 {
+				return "(使用 server.url)"
+			}
+			return strings.Join(c.ServerEndpoints, ",")
+		},
+	},
+	{
+		Key:  "server.probe_interval",
+		Env:  "GOAGENT_SERVER_PROBE_INTERVAL",
+		Flag: "server-probe-interval",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.ServerProbeInterval, err = parseConfigDuration(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return c.ServerProbeInterval.String() },
+	},
+	{
+		Key:  "server.clock_skew",
+		Env:  "GOAGENT_SERVER_CLOCK_SKEW",
+		Flag: "server-clock-skew",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.ServerClockSkew, err = parseConfigDuration(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return c.ServerClockSkew.String() },
+	},
+	{
+		Key:  "server.ca_file",
+		Env:  "GOAGENT_SERVER_CA_FILE",
+		Flag: "server-ca-file",
+		Set: func(c *AgentConfig, v string) error {
+			c.ServerCAFile = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.ServerCAFile },
+	},
+	{
+		Key:  "server.cert_file",
+		Env:  "GOAGENT_SERVER_CERT_FILE",
+		Flag: "server-cert-file",
+		Set: func(c *AgentConfig, v string) error {
+			c.ServerCertFile = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.ServerCertFile },
+	},
+	{
+		Key:  "server.key_file",
+		Env:  "GOAGENT_SERVER_KEY_FILE",
+		Flag: "server-key-file",
+		Set: func(c *AgentConfig, v string) error {
+			c.ServerKeyFile = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.ServerKeyFile },
+	},
+	{
+		Key:  "server.pins",
+		Env:  "GOAGENT_SERVER_PINS",
+		Flag: "server-pins",
+		Set: func(c *AgentConfig, v string) error {
+			c.ServerPins = splitConfigList(v)
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return strings.Join(c.ServerPins, ",") },
+	},
+	{
+		Key:  "server.tls_min_version",
+		Env:  "GOAGENT_SERVER_TLS_MIN_VERSION",
+		Flag: "server-tls-min-version",
+		Set: func(c *AgentConfig, v string) error {
+			if _, err := parseTLSVersion(v); err != nil {
+				return err
+			}
+			c.ServerTLSMinVersion = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.ServerTLSMinVersion },
+	},
+	{
+		Key:  "node.id",
+		Env:  "GOAGENT_NODE_ID",
+		Flag: "node-id",
+		Set: func(c *AgentConfig, v string) error {
+			if v != "" {
+				c.NodeID = v
+			}
+			return nil
+		},
+		Get: func(c *AgentConfig) string {
+			if c.NodeID == "" {
+				return "(自动生成并持久化)"
+			}
+			return c.NodeID
+		},
+	},
+	{
+		Key:  "node.name",
+		Env:  "GOAGENT_NODE_NAME",
+		Flag: "node-name",
+		Set: func(c *AgentConfig, v string) error {
+			if v != "" {
+				c.NodeName = v
+			}
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.NodeName },
+	},
+	{
+		Key:  "node.region",
+		Env:  "GOAGENT_NODE_REGION",
+		Flag: "node-region",
+		Set: func(c *AgentConfig, v string) error {
+			c.NodeRegion = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.NodeRegion },
+	},
+	{
+		Key:  "monitor.interval",
+		Env:  "GOAGENT_MONITOR_INTERVAL",
+		Flag: "monitor-interval",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.MonitorInterval, err = parseConfigDuration(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return c.MonitorInterval.String() },
+	},
+	{
+		Key:  "monitor.report_interval",
+		Env:  "GOAGENT_REPORT_INTERVAL",
+		Flag: "report-interval",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.ReportInterval, err = parseConfigDuration(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return c.ReportInterval.String() },
+	},
+	{
+		Key:  "monitor.history_retention",
+		Env:  "GOAGENT_HISTORY_RETENTION",
+		Flag: "history-retention",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.HistoryRetention, err = parseConfigDuration(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return c.HistoryRetention.String() },
+	},
+	{
+		Key:  "limits.max_cpu",
+		Env:  "GOAGENT_MAX_CPU",
+		Flag: "max-cpu",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.MaxCPU, err = strconv.ParseFloat(v, 64)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return strconv.FormatFloat(c.MaxCPU, 'f', -1, 64) },
+	},
+	{
+		Key:  "limits.max_memory",
+		Env:  "GOAGENT_MAX_MEMORY",
+		Flag: "max-memory",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.MaxMemory, err = parseConfigSize(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return formatConfigSize(c.MaxMemory) },
+	},
+	{
+		Key:  "service.log_level",
+		Env:  "GOAGENT_LOG_LEVEL",
+		Flag: "log-level",
+		Set: func(c *AgentConfig, v string) error {
+			if _, err := parseLogLevel(v); err != nil {
+				return err
+			}
+			c.LogLevel = strings.ToLower(v)
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.LogLevel },
+	},
+	{
+		Key:  "monitor.proc_root",
+		Env:  "GOAGENT_PROC_ROOT",
+		Flag: "proc-root",
+		Set: func(c *AgentConfig, v string) error {
+			c.ProcRoot = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.ProcRoot },
+	},
+	{
+		Key:  "monitor.sys_root",
+		Env:  "GOAGENT_SYS_ROOT",
+		Flag: "sys-root",
+		Set: func(c *AgentConfig, v string) error {
+			c.SysRoot = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.SysRoot },
+	},
+	{
+		Key:  "monitor.etc_root",
+		Env:  "GOAGENT_ETC_ROOT",
+		Flag: "etc-root",
+		Set: func(c *AgentConfig, v string) error {
+			c.EtcRoot = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.EtcRoot },
+	},
+	{
+		Key:  "monitor.top_processes",
+		Env:  "GOAGENT_TOP_PROCESSES",
+		Flag: "top-processes",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.TopProcesses, err = strconv.Atoi(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return strconv.Itoa(c.TopProcesses) },
+	},
+	{
+		Key:  "queue.max_size",
+		Env:  "GOAGENT_QUEUE_MAX_SIZE",
+		Flag: "queue-max-size",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.QueueMaxSize, err = parseConfigSize(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return formatConfigSize(c.QueueMaxSize) },
+	},
+	{
+		Key:  "queue.max_age",
+		Env:  "GOAGENT_QUEUE_MAX_AGE",
+		Flag: "queue-max-age",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.QueueMaxAge, err = parseConfigDuration(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string { return c.QueueMaxAge.String() },
+	},
+	{
+		Key:  "exec.policy_file",
+		Env:  "GOAGENT_EXEC_POLICY_FILE",
+		Flag: "exec-policy-file",
+		Set: func(c *AgentConfig, v string) error {
+			c.ExecPolicyFile = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.ExecPolicyFile },
+	},
+	{
+		Key:  "network.host",
+		Env:  "GOAGENT_LISTEN_HOST",
+		Flag: "listen-host",
+		Set: func(c *AgentConfig, v string) error {
+			c.ListenHost = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.ListenHost },
+	},
+	{
+		Key:  "network.port",
+		Env:  "GOAGENT_LISTEN_PORT",
+		Flag: "listen-port",
+		Set: func(c *AgentConfig, v string) (err error) {
+			c.ListenPort, err = strconv.Atoi(v)
+			return err
+		},
+		Get: func(c *AgentConfig) string {
+			if c.ListenPort == 0 {
+				return "0 (不启用)"
+			}
+			return strconv.Itoa(c.ListenPort)
+		},
+	},
+	{
+		Key:  "network.proxy",
+		Env:  "GOAGENT_PROXY",
+		Flag: "proxy",
+		Set: func(c *AgentConfig, v string) error {
+			c.Proxy = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string {
+			if c.Proxy == "" {
+				return "(使用 HTTPS_PROXY 等环境变量)"
+			}
+			return redactProxy(c.Proxy)
+		},
+	},
+	{
+		Key:  "service.data_dir",
+		Env:  "GOAGENT_DATA_DIR",
+		Flag: "data-dir",
+		Set: func(c *AgentConfig, v string) error {
+			c.DataDir = v
+			return nil
+		},
+		Get: func(c *AgentConfig) string { return c.DataDir },
+	},
+}
+
+// findConfigField 按键名查找配置项
+func findConfigField(key string) *configField {
+	for i := range configFields {
+		if configFields[i].Key == key {
+			return &configFields[i]
+		}
+	}
+	return nil
+}
+
+// findConfigFlag 按命令行参数名查找配置项
+func findConfigFlag(name string) *configField {
+	for i := range configFields {
+		if configFields[i].Flag == name {
+			return &configFields[i]
+		}
+	}
+	return nil
+}
+
+// isKnownConfigSection 检查分节是否包含代理支持的配置项
+func isKnownConfigSection(key string) bool {
+	section, _, ok := strings.Cut(key, ".")
+	if !ok {
+		return false
+	}
+	for _, field := range configFields {
+		if strings.HasPrefix(field.Key, section+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// configSearchPaths 配置文件查找顺序：当前目录、可执行文件目录、系统配置目录
+func configSearchPaths() []string {
+	paths := []string{ConfigFileName}
+
+	if exePath, err := os.Executable(); err == nil {
+		paths = append(paths, filepath.Join(filepath.Dir(exePath), ConfigFileName))
+	}
+
+	paths = append(paths, filepath.Join(systemConfigDir(), ConfigFileName))
+	return paths
+}
+
+// findConfigFile 按查找顺序返回第一个存在的配置文件，未找到时返回空字符串
+func findConfigFile() string {
+	for _, path := range configSearchPaths() {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			if absPath, err := filepath.Abs(path); err == nil {
+				return absPath
+			}
+			return path
+		}
+	}
+	return ""
+}
+
+// newLoadedConfig 创建全部使用默认值的配置
+func newLoadedConfig() *LoadedConfig {
+	loaded := &LoadedConfig{
+		Config:  getDefaultConfig(),
+		Origins: make(map[string]ConfigOrigin),
+	}
+	for _, field := range configFields {
+		loaded.Origins[field.Key] = ConfigOrigin{Source: ConfigSourceDefault}
+	}
+	return loaded
+}
+
+// ConfigFlags 命令行中的配置参数
+type ConfigFlags struct {
+	Path   string            // --config 指定的配置文件
+	Values []configFlagValue // 按出现顺序记录的配置参数
+}
+
+// configFlagValue 单个配置参数
+type configFlagValue struct {
+	Flag  string
+	Value string
+}
+
+// commandLineConfig 启动时从命令行解析出的配置参数
+var commandLineConfig = &ConfigFlags{}
+
+// parseConfigFlags 从参数中提取配置参数，返回其余参数
+// 支持 --name value 与 --name=value 两种写法，未知参数原样保留
+func parseConfigFlags(args []string) (*ConfigFlags, []string, error) {
+	flags := &ConfigFlags{}
+	var rest []string
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			rest = append(rest, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(arg[2:], "=")
+		if name != ConfigPathFlag && findConfigFlag(name) == nil {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, nil, fmt.Errorf("参数 --%s 缺少值", name)
+			}
+			i++
+			value = args[i]
+		}
+
+		if name == ConfigPathFlag {
+			flags.Path = value
+		} else {
+			flags.Values = append(flags.Values, configFlagValue{Flag: name, Value: value})
+		}
+	}
+
+	return flags, rest, nil
+}
+
+// Args 还原为命令行参数，用于写入服务启动命令
+func (f *ConfigFlags) Args() []string {
+	var args []string
+	if f.Path != "" {
+		args = append(args, "--"+ConfigPathFlag, f.Path)
+	}
+	for _, v := range f.Values {
+		args = append(args, "--"+v.Flag, v.Value)
+	}
+	return args
+}
+
+// loadAgentConfig 加载并校验代理配置
+// 优先级：命令行参数 > 环境变量 > 配置文件 > 默认值。
+// 配置文件依次取 flags.Path、GOAGENT_CONFIG，均未指定时按查找顺序搜索。
+// 出错时仍返回已加载的部分配置，便于调用方展示。
+func loadAgentConfig(flags *ConfigFlags) (*LoadedConfig, error) {
+	loaded := newLoadedConfig()
+	if flags == nil {
+		flags = &ConfigFlags{}
+	}
+
+	path := flags.Path
+	if path == "" {
+		path = os.Getenv(ConfigPathEnv)
+	}
+	if path == "" {
+		path = findConfigFile()
+	}
+	if path != "" {
+		loaded.Path = path
+		if err := loaded.applyFile(path); err != nil {
+			return loaded, err
+		}
+	}
+
+	if err := loaded.applyEnv(); err != nil {
+		return loaded, err
+	}
+	if err := loaded.applyFlags(flags); err != nil {
+		return loaded, err
+	}
+
+	if err := loaded.Validate(); err != nil {
+		return loaded, err
+	}
+	return loaded, nil
+}
+
+// applyEnv 将 GOAGENT_* 环境变量写入配置，值为空的变量视为未设置
+func (l *LoadedConfig) applyEnv() error {
+	var errs ConfigErrors
+	for _, field := range configFields {
+		value := os.Getenv(field.Env)
+		if value == "" {
+			continue
+		}
+		if err := field.Set(l.Config, value); err != nil {
+			errs = append(errs, &ConfigError{Msg: fmt.Sprintf("环境变量 %s 的值 %q 无效: %v", field.Env, value, err)})
+			continue
+		}
+		l.Origins[field.Key] = ConfigOrigin{Source: ConfigSourceEnv, Name: field.Env}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// applyFlags 将命令行参数写入配置，同一参数出现多次时以最后一次为准
+func (l *LoadedConfig) applyFlags(flags *ConfigFlags) error {
+	var errs ConfigErrors
+	for _, v := range flags.Values {
+		field := findConfigFlag(v.Flag)
+		if field == nil {
+			continue
+		}
+		if err := field.Set(l.Config, v.Value); err != nil {
+			errs = append(errs, &ConfigError{Msg: fmt.Sprintf("参数 --%s 的值 %q 无效: %v", v.Flag, v.Value, err)})
+			continue
+		}
+		l.Origins[field.Key] = ConfigOrigin{Source: ConfigSourceFlag, Name: "--" + v.Flag}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// applyFile 将配置文件中的值写入配置
+func (l *LoadedConfig) applyFile(path string) error {
+	file, err := parseConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	var errs ConfigErrors
+	for _, entry := range file.Entries {
+		field := findConfigField(entry.Key)
+		if field == nil {
+			// 仅提示代理所属分节中的未知键，其他分节留给扩展功能使用
+			if isKnownConfigSection(entry.Key) {
+				l.Warnings = append(l.Warnings, fmt.Sprintf("%s:%d: 未知的配置项 %s", file.Path, entry.Line, entry.Key))
+			}
+			continue
+		}
+		if err := field.Set(l.Config, entry.Value); err != nil {
+			errs = append(errs, &ConfigError{
+				File: file.Path,
+				Line: entry.Line,
+				Msg:  fmt.Sprintf("%s 的值 %q 无效: %v", entry.Key, entry.Value, err),
+			})
+			continue
+		}
+		l.Origins[entry.Key] = ConfigOrigin{Source: ConfigSourceFile, File: file.Path, Line: entry.Line}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate 校验配置取值范围，错误定位到配置项的来源
+func (l *LoadedConfig) Validate() error {
+	var errs ConfigErrors
+	for _, problem := range validateAgentConfig(l.Config) {
+		origin := l.Origins[problem.Key]
+		err := &ConfigError{Msg: fmt.Sprintf("%s: %s", problem.Key, problem.Msg)}
+		if origin.Source == ConfigSourceFile {
+			err.File, err.Line = origin.File, origin.Line
+		} else {
+			err.Msg = fmt.Sprintf("%s (来源: %s)", err.Msg, origin)
+		}
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// configProblem 配置项取值问题
+type configProblem struct {
+	Key string
+	Msg string
+}
+
+// validateAgentConfig 检查配置取值是否合法
+func validateAgentConfig(c *AgentConfig) []configProblem {
+	var problems []configProblem
+	add := func(key, format string, v ...interface{}) {
+		problems = append(problems, configProblem{Key: key, Msg: fmt.Sprintf(format, v...)})
+	}
+
+	if u, err := url.Parse(c.ServerURL); err != nil {
+		add("server.url", "地址格式错误: %v", err)
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		add("server.url", "仅支持 http 或 https 地址: %q", c.ServerURL)
+	} else if u.Host == "" {
+		add("server.url", "地址缺少主机名: %q", c.ServerURL)
+	}
+	if c.ServerPort < 1 || c.ServerPort > 65535 {
+		add("server.port", "端口必须在 1-65535 之间，当前为 %d", c.ServerPort)
+	}
+	if c.ServerTimeout <= 0 {
+		add("server.timeout", "请求超时必须大于 0，当前为 %v", c.ServerTimeout)
+	}
+	for _, endpoint := range c.ServerEndpoints {
+		if u, err := url.Parse(endpoint); err != nil {
+			add("server.endpoints", "地址格式错误: %v", err)
+		} else if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			add("server.endpoints", "无效的服务端地址 %q，应为 http 或 https 地址", endpoint)
+		}
+	}
+	if c.ServerProbeInterval <= 0 {
+		add("server.probe_interval", "探测间隔必须大于 0，当前为 %v", c.ServerProbeInterval)
+	}
+	if c.ServerClockSkew <= 0 {
+		add("server.clock_skew", "允许的时钟偏差必须大于 0，当前为 %v", c.ServerClockSkew)
+	}
+	if c.ServerCAFile != "" {
+		if _, err := os.Stat(c.ServerCAFile); err != nil {
+			add("server.ca_file", "无法读取 CA 证书: %v", err)
+		}
+	}
+	if (c.ServerCertFile == "") != (c.ServerKeyFile == "") {
+		add("server.cert_file", "客户端证书和私钥必须同时配置")
+	} else if c.ServerCertFile != "" {
+		if _, err := os.Stat(c.ServerCertFile); err != nil {
+			add("server.cert_file", "无法读取客户端证书: %v", err)
+		}
+		if _, err := os.Stat(c.ServerKeyFile); err != nil {
+			add("server.key_file", "无法读取客户端私钥: %v", err)
+		}
+	}
+	if _, err := parseSPKIPins(c.ServerPins); err != nil {
+		add("server.pins", "%v", err)
+	}
+	if _, err := parseTLSVersion(c.ServerTLSMinVersion); err != nil {
+		add("server.tls_min_version", "%v", err)
+	}
+	if c.MonitorInterval <= 0 {
+		add("monitor.interval", "监控间隔必须大于 0，当前为 %v", c.MonitorInterval)
+	}
+	if c.ReportInterval <= 0 {
+		add("monitor.report_interval", "报告间隔必须大于 0，当前为 %v", c.ReportInterval)
+	}
+	if c.HistoryRetention < c.ReportInterval {
+		add("monitor.history_retention", "指标历史保留时长不能小于报告间隔 %v，当前为 %v", c.ReportInterval, c.HistoryRetention)
+	}
+	if c.TopProcesses < 0 {
+		add("monitor.top_processes", "进程排行数量不能为负数，当前为 %d", c.TopProcesses)
+	}
+	if c.MaxCPU <= 0 || c.MaxCPU > 100 {
+		add("limits.max_cpu", "CPU 上限必须在 (0, 100] 之间，当前为 %v", c.MaxCPU)
+	}
+	if c.MaxMemory < 0 {
+		add("limits.max_memory", "内存上限不能为负数，当前为 %d", c.MaxMemory)
+	}
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		add("service.log_level", "%v", err)
+	}
+	if c.QueueMaxSize <= 0 {
+		add("queue.max_size", "离线队列容量必须大于 0，当前为 %d", c.QueueMaxSize)
+	}
+	if c.QueueMaxAge <= 0 {
+		add("queue.max_age", "离线队列保留时长必须大于 0，当前为 %v", c.QueueMaxAge)
+	}
+	if c.ExecPolicyFile == "" {
+		add("exec.policy_file", "执行策略文件路径不能为空")
+	}
+	if c.ListenPort < 0 || c.ListenPort > 65535 {
+		add("network.port", "端口必须在 0-65535 之间（0 表示不启用），当前为 %d", c.ListenPort)
+	}
+	if c.Proxy != "" && c.Proxy != proxyDirect {
+		if _, err := parseProxyURL(c.Proxy); err != nil {
+			add("network.proxy", "%v", err)
+		}
+	}
+	if c.DataDir == "" {
+		add("service.data_dir", "数据目录不能为空")
+	}
+
+	return problems
+}
+
+// parseConfigFile 解析 TOML 格式的配置文件
+// 支持 [section] 分节、key = value 键值、# 注释，字符串值可省略引号
+func parseConfigFile(path string) (*configFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, &ConfigError{File: path, Msg: fmt.Sprintf("无法打开配置文件: %v", err)}
+	}
+	defer f.Close()
+
+	file := &configFile{Path: path}
+	seen := make(map[string]int)
+	section := ""
+	lineNo := 0
+
+	var errs ConfigErrors
+	addError := func(format string, v ...interface{}) {
+		errs = append(errs, &ConfigError{File: path, Line: lineNo, Msg: fmt.Sprintf(format, v...)})
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(stripConfigComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		// 分节
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				addError("分节缺少右括号: %s", line)
+				continue
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if !isValidConfigKey(name) {
+				addError("无效的分节名: %s", line)
+				continue
+			}
+			section = name
+			continue
+		}
+
+		// 键值
+		eq := strings.Index(line, "=")
+		if eq < 0 {
+			addError("缺少 '=': %s", line)
+			continue
+		}
+		key := strings.TrimSpace(line[:eq])
+		if !isValidConfigKey(key) {
+			addError("无效的键名: %q", key)
+			continue
+		}
+		value, err := unquoteConfigValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			addError("%s 的值无效: %v", key, err)
+			continue
+		}
+
+		if section != "" {
+			key = section + "." + key
+		}
+		if prev, ok := seen[key]; ok {
+			addError("重复的键 %s（首次定义于第 %d 行）", key, prev)
+			continue
+		}
+		seen[key] = lineNo
+		file.Entries = append(file.Entries, configEntry{Key: key, Value: value, Line: lineNo})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, &ConfigError{File: path, Msg: fmt.Sprintf("读取配置文件失败: %v", err)}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return file, nil
+}
+
+// stripConfigComment 去除行内注释（忽略引号中的 #）
+func stripConfigComment(line string) string {
+	var quote byte
+	escaped := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && c == '\\':
+			escaped = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// unquoteConfigValue 去除值两端的引号
+func unquoteConfigValue(value string) (string, error) {
+	if value == "" {
+		return "", fmt.Errorf("值不能为空")
+	}
+
+	switch value[0] {
+	case '"':
+		return strconv.Unquote(value)
+	case '\'':
+		if len(value) < 2 || value[len(value)-1] != '\'' {
+			return "", fmt.Errorf("字符串缺少结束引号")
+		}
+		return value[1 : len(value)-1], nil
+	default:
+		return value, nil
+	}
+}
+
+// isValidConfigKey 检查键名或分节名是否合法
+func isValidConfigKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, part := range strings.Split(key, ".") {
+		if part == "" {
+			return false
+		}
+		for _, r := range part {
+			if !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseConfigDuration 解析时间间隔，纯数字按秒计算，也支持 30s、5m、2d 等格式
+func parseConfigDuration(v string) (time.Duration, error) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.ParseInt(days, 10, 64); err == nil {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	return time.ParseDuration(v)
+}
+
+// parseConfigSize 解析容量大小，纯数字按字节计算，也支持 KB、MB、GB 后缀
+func parseConfigSize(v string) (int64, error) {
+	units := []struct {
+		suffix string
+		scale  int64
+	}{
+		{"GB", 1024 * 1024 * 1024},
+		{"MB", 1024 * 1024},
+		{"KB", 1024},
+		{"G", 1024 * 1024 * 1024},
+		{"M", 1024 * 1024},
+		{"K", 1024},
+		{"B", 1},
+	}
+
+	upper := strings.ToUpper(strings.TrimSpace(v))
+	for _, unit := range units {
+		if strings.HasSuffix(upper, unit.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(upper, unit.suffix)), 64)
+			if err != nil {
+				return 0, err
+			}
+			return int64(n * float64(unit.scale)), nil
+		}
+	}
+	return strconv.ParseInt(upper, 10, 64)
+}
+
+// formatConfigSize 格式化容量大小，能整除时使用 GB、MB、KB 单位
+func formatConfigSize(n int64) string {
+	switch {
+	case n != 0 && n%(1024*1024*1024) == 0:
+		return fmt.Sprintf("%dGB", n/(1024*1024*1024))
+	case n != 0 && n%(1024*1024) == 0:
+		return fmt.Sprintf("%dMB", n/(1024*1024))
+	case n != 0 && n%1024 == 0:
+		return fmt.Sprintf("%dKB", n/1024)
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+}
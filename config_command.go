@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runConfigCommand 处理 config 子命令，返回进程退出码
+func runConfigCommand(args []string) int {
+	if len(args) == 0 {
+		showConfigHelp()
+		return 1
+	}
+
+	switch args[0] {
+	case "check":
+		return runConfigCheck(args[1:])
+	case "show":
+		return runConfigShow(args[1:])
+	case "help", "-h", "--help":
+		showConfigHelp()
+		return 0
+	default:
+		fmt.Printf("未知的 config 子命令: %s\n", args[0])
+		showConfigHelp()
+		return 1
+	}
+}
+
+// runConfigCheck 校验配置文件，有错误时返回非零退出码
+func runConfigCheck(args []string) int {
+	flags, ok := configFlagsWithPath(args)
+	if !ok {
+		return 1
+	}
+
+	loaded, err := loadAgentConfig(flags)
+	printConfigSource(loaded)
+	for _, warning := range loaded.Warnings {
+		fmt.Printf("⚠️  %s\n", warning)
+	}
+
+	if err != nil {
+		printConfigErrors(err)
+		return 1
+	}
+
+	fmt.Println("✅ 配置检查通过")
+	return 0
+}
+
+// runConfigShow 显示合并后的有效配置及每一项的来源
+func runConfigShow(args []string) int {
+	flags, ok := configFlagsWithPath(args)
+	if !ok {
+		return 1
+	}
+
+	loaded, err := loadAgentConfig(flags)
+	printConfigSource(loaded)
+	fmt.Println()
+
+	fmt.Printf("%-26s %-32s %s\n", "配置项", "值", "来源")
+	for _, field := range configFields {
+		fmt.Printf("%-26s %-32s %s\n", field.Key, field.Get(loaded.Config), loaded.Origins[field.Key])
+	}
+
+	if len(loaded.Warnings) > 0 {
+		fmt.Println()
+		for _, warning := range loaded.Warnings {
+			fmt.Printf("⚠️  %s\n", warning)
+		}
+	}
+
+	if err != nil {
+		fmt.Println()
+		printConfigErrors(err)
+		return 1
+	}
+	return 0
+}
+
+// configFlagsWithPath 合并命令行配置参数与可选的配置文件路径参数
+func configFlagsWithPath(args []string) (*ConfigFlags, bool) {
+	flags := *commandLineConfig
+
+	switch len(args) {
+	case 0:
+	case 1:
+		flags.Path = args[0]
+	default:
+		fmt.Println("❌ 参数过多，最多指定一个配置文件路径")
+		return nil, false
+	}
+
+	if flags.Path != "" {
+		if _, err := os.Stat(flags.Path); err != nil {
+			fmt.Printf("❌ 配置文件不可用: %v\n", err)
+			return nil, false
+		}
+	}
+	return &flags, true
+}
+
+// printConfigSource 显示实际使用的配置文件
+func printConfigSource(loaded *LoadedConfig) {
+	if loaded.Path != "" {
+		fmt.Printf("配置文件: %s\n", loaded.Path)
+	} else {
+		fmt.Printf("配置文件: 未找到 %s，使用默认配置\n", ConfigFileName)
+	}
+}
+
+// printConfigErrors 逐条显示配置错误
+func printConfigErrors(err error) {
+	errs, ok := err.(ConfigErrors)
+	if !ok {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+
+	fmt.Printf("❌ 配置检查失败，共 %d 个错误:\n", len(errs))
+	for _, e := range errs {
+		fmt.Printf("   %v\n", e)
+	}
+}
+
+// showConfigHelp 显示 config 子命令帮助
+func showConfigHelp() {
+	fmt.Printf("用法: %s config <子命令> [配置文件]\n", ExecutableName)
+	fmt.Println()
+	fmt.Println("子命令:")
+	fmt.Println("  check [文件]      校验配置文件，逐条报告错误所在的文件和行号")
+	fmt.Println("  show [文件]       显示合并后的有效配置及每一项的来源")
+	fmt.Println()
+	fmt.Println("未指定文件时依次使用 --config 参数、" + ConfigPathEnv + " 环境变量，")
+	fmt.Println("或按 当前目录 -> 可执行文件目录 -> 系统配置目录 的顺序查找 " + ConfigFileName)
+	fmt.Println()
+	showConfigOverrideHelp()
+}
+
+// showConfigOverrideHelp 显示可覆盖配置的环境变量和命令行参数
+func showConfigOverrideHelp() {
+	fmt.Println("配置覆盖 (优先级: 命令行参数 > 环境变量 > 配置文件 > 默认值):")
+	fmt.Printf("  %-24s %-28s %s\n", "--"+ConfigPathFlag+" <文件>", ConfigPathEnv, "配置文件路径")
+	for _, field := range configFields {
+		fmt.Printf("  %-24s %-28s %s\n", "--"+field.Flag+" <值>", field.Env, field.Key)
+	}
+}
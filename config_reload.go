@@ -0,0 +1,213 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// configWatchInterval 配置文件变更检查间隔
+const configWatchInterval = 5 * time.Second
+
+// configFileState 配置文件状态，用于判断文件是否变更
+type configFileState struct {
+	Path    string
+	ModTime time.Time
+	Size    int64
+}
+
+// runConfigWatcher 运行配置监视器，收到 SIGHUP 或配置文件变更时重新加载配置
+func (a *AgentService) runConfigWatcher() {
+	defer a.wg.Done()
+	a.stats.setComponent(componentWatcher, true)
+	defer a.stats.setComponent(componentWatcher, false)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	state := a.configFileState()
+	a.logger.Printf("⚙️ 配置监视器已启动 (SIGHUP 或配置文件变更时重新加载)")
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			a.logger.Printf("⚙️ 配置监视器已停止")
+			return
+		case <-hup:
+			a.logInfo("⚙️ 收到 SIGHUP，重新加载配置")
+			a.reloadConfig()
+			state = a.configFileState()
+		case <-ticker.C:
+			current := a.configFileState()
+			if current == state {
+				continue
+			}
+			state = current
+			a.logInfo("⚙️ 检测到配置文件变更: %s", current.Path)
+			a.reloadConfig()
+		}
+	}
+}
+
+// configFileState 获取当前生效的配置文件状态
+// 启动时未找到配置文件则按查找顺序检查，以便感知新创建的配置文件
+func (a *AgentService) configFileState() configFileState {
+	a.mu.RLock()
+	path := a.configPath
+	a.mu.RUnlock()
+
+	if path == "" {
+		if commandLineConfig.Path != "" {
+			path = commandLineConfig.Path
+		} else if envPath := os.Getenv(ConfigPathEnv); envPath != "" {
+			path = envPath
+		} else {
+			path = findConfigFile()
+		}
+	}
+	if path == "" {
+		return configFileState{}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return configFileState{Path: path}
+	}
+	return configFileState{Path: path, ModTime: info.ModTime(), Size: info.Size()}
+}
+
+// reloadConfig 重新加载配置，新配置无效时保留当前配置
+func (a *AgentService) reloadConfig() bool {
+	loaded, err := loadAgentConfig(commandLineConfig)
+	if err != nil {
+		a.logError("❌ 新配置无效，继续使用当前配置:\n%v", err)
+		return false
+	}
+	for _, warning := range loaded.Warnings {
+		a.logWarn("⚠️ %s", warning)
+	}
+
+	// 未显式配置节点ID时沿用当前ID，避免重新加载产生新的节点身份
+	old := a.getConfig()
+	if loaded.Origins["node.id"].Source == ConfigSourceDefault {
+		loaded.Config.NodeID = old.NodeID
+	}
+
+	a.applyConfig(loaded.Config, loaded.Path)
+	return true
+}
+
+// applyConfig 替换当前配置，只通知设置发生变化的组件
+func (a *AgentService) applyConfig(config *AgentConfig, path string) {
+	level, _ := parseLogLevel(config.LogLevel)
+
+	a.mu.Lock()
+	old := a.config
+	// 节点身份、离线队列等状态文件已在启动时打开，数据目录变更需要重启服务后生效
+	dataDirChanged := old.DataDir != config.DataDir
+	if dataDirChanged {
+		config.DataDir = old.DataDir
+	}
+	a.config = config
+	a.configPath = path
+	a.logLevel = level
+	a.mu.Unlock()
+
+	if dataDirChanged {
+		a.logWarn("⚠️ 数据目录变更需要重启服务后生效，继续使用 %s", old.DataDir)
+	}
+
+	changed := false
+	if old.MonitorInterval != config.MonitorInterval {
+		a.logInfo("⚙️ 监控间隔: %v -> %v", old.MonitorInterval, config.MonitorInterval)
+		notifyReset(a.monitorReset)
+		changed = true
+	}
+	if systemRootFromConfig(old) != systemRootFromConfig(config) {
+		a.logInfo("⚙️ 系统信息来源目录已变更")
+		notifyReset(a.monitorReset)
+		changed = true
+	}
+	if old.HistoryRetention != config.HistoryRetention {
+		a.logInfo("⚙️ 指标历史保留时长: %v -> %v", old.HistoryRetention, config.HistoryRetention)
+		a.history.SetRetention(config.HistoryRetention)
+		changed = true
+	}
+	if old.TopProcesses != config.TopProcesses {
+		a.logInfo("⚙️ 进程排行数量: %d -> %d", old.TopProcesses, config.TopProcesses)
+		notifyReset(a.monitorReset)
+		changed = true
+	}
+	if old.ReportInterval != config.ReportInterval {
+		a.logInfo("⚙️ 报告间隔: %v -> %v", old.ReportInterval, config.ReportInterval)
+		notifyReset(a.reporterReset)
+		changed = true
+	}
+	if serverSettingsChanged(old, config) {
+		a.logInfo("⚙️ 服务端或节点信息已变更: %s:%d -> %s:%d", old.ServerURL, old.ServerPort, config.ServerURL, config.ServerPort)
+		notifyReset(a.serverReset)
+		changed = true
+	}
+	if old.ListenHost != config.ListenHost || old.ListenPort != config.ListenPort {
+		a.logInfo("⚙️ 指标接口监听地址: %s:%d -> %s:%d", old.ListenHost, old.ListenPort, config.ListenHost, config.ListenPort)
+		notifyReset(a.exporterReset)
+		changed = true
+	}
+	if old.MaxCPU != config.MaxCPU || old.MaxMemory != config.MaxMemory {
+		a.logInfo("⚙️ 资源限制: CPU %v%% -> %v%%, 内存 %s -> %s", old.MaxCPU, config.MaxCPU,
+			formatConfigSize(old.MaxMemory), formatConfigSize(config.MaxMemory))
+		changed = true
+	}
+	if old.LogLevel != config.LogLevel {
+		a.logInfo("⚙️ 日志级别: %s -> %s", old.LogLevel, config.LogLevel)
+		changed = true
+	}
+
+	if old.QueueMaxSize != config.QueueMaxSize || old.QueueMaxAge != config.QueueMaxAge {
+		a.logInfo("⚙️ 离线队列配额: %s/%v -> %s/%v", formatConfigSize(old.QueueMaxSize), old.QueueMaxAge,
+			formatConfigSize(config.QueueMaxSize), config.QueueMaxAge)
+		if dropped := a.outbox.SetQuota(config.QueueMaxSize, config.QueueMaxAge); dropped > 0 {
+			a.logWarn("⚠️ 离线队列超出新配额，丢弃最旧的 %d 条消息", dropped)
+		}
+		changed = true
+	}
+
+	if changed {
+		a.recordEvent(eventInfo, "config_reloaded", path)
+		a.logInfo("✅ 配置已重新加载")
+	} else {
+		a.logInfo("✅ 配置已重新加载，没有需要应用的变更")
+	}
+}
+
+// serverSettingsChanged 检查是否需要重新连接服务端
+func serverSettingsChanged(old, config *AgentConfig) bool {
+	return old.ServerURL != config.ServerURL ||
+		old.ServerPort != config.ServerPort ||
+		old.ServerTimeout != config.ServerTimeout ||
+		strings.Join(old.ServerEndpoints, ",") != strings.Join(config.ServerEndpoints, ",") ||
+		old.ServerProbeInterval != config.ServerProbeInterval ||
+		old.ServerCAFile != config.ServerCAFile ||
+		old.ServerCertFile != config.ServerCertFile ||
+		old.ServerKeyFile != config.ServerKeyFile ||
+		strings.Join(old.ServerPins, ",") != strings.Join(config.ServerPins, ",") ||
+		old.ServerTLSMinVersion != config.ServerTLSMinVersion ||
+		old.Proxy != config.Proxy ||
+		old.NodeID != config.NodeID ||
+		old.NodeName != config.NodeName ||
+		old.NodeRegion != config.NodeRegion
+}
+
+// notifyReset 非阻塞地发送重启通知，已有未处理的通知时合并
+func notifyReset(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
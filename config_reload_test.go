@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// drainReset 检查并清空重启通知
+func drainReset(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestApplyConfigNotifiesChangedComponents(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(c *AgentConfig)
+		monitor  bool
+		reporter bool
+		server   bool
+		exporter bool
+		applied  bool // 是否记录配置已应用的事件
+	}{
+		{name: "unchanged", change: func(c *AgentConfig) {}},
+		{name: "monitor interval", change: func(c *AgentConfig) { c.MonitorInterval = 5 * time.Second }, monitor: true, applied: true},
+		{name: "proc root", change: func(c *AgentConfig) { c.ProcRoot = "/host/proc" }, monitor: true, applied: true},
+		{name: "top processes", change: func(c *AgentConfig) { c.TopProcesses = 3 }, monitor: true, applied: true},
+		{name: "report interval", change: func(c *AgentConfig) { c.ReportInterval = 7 * time.Minute }, reporter: true, applied: true},
+		{name: "server url", change: func(c *AgentConfig) { c.ServerURL = "http://other.test" }, server: true, applied: true},
+		{name: "server endpoints", change: func(c *AgentConfig) { c.ServerEndpoints = []string{"https://a.test", "https://b.test"} }, server: true, applied: true},
+		{name: "server pins", change: func(c *AgentConfig) { c.ServerPins = []string{"sha256/AAAA"} }, server: true, applied: true},
+		{name: "proxy", change: func(c *AgentConfig) { c.Proxy = "direct" }, server: true, applied: true},
+		{name: "node name", change: func(c *AgentConfig) { c.NodeName = "renamed" }, server: true, applied: true},
+		{name: "listen port", change: func(c *AgentConfig) { c.ListenPort = 9100 }, exporter: true, applied: true},
+		{name: "log level", change: func(c *AgentConfig) { c.LogLevel = "debug" }, applied: true},
+		{name: "resource limits", change: func(c *AgentConfig) { c.MaxCPU = 50 }, applied: true},
+		{name: "history retention", change: func(c *AgentConfig) { c.HistoryRetention = 2 * time.Hour }, applied: true},
+		{name: "queue quota", change: func(c *AgentConfig) { c.QueueMaxAge = 2 * time.Hour }, applied: true},
+		{name: "data dir", change: func(c *AgentConfig) { c.DataDir = "/elsewhere" }},
+		// 不需要重启组件的设置在使用时读取，不影响其他组件
+		{name: "exec policy", change: func(c *AgentConfig) { c.ExecPolicyFile = "/etc/other.toml" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestAgentService(t, "http://star.test")
+			a.monitorReset = make(chan struct{}, 1)
+			a.reporterReset = make(chan struct{}, 1)
+			a.exporterReset = make(chan struct{}, 1)
+			old := a.getConfig()
+
+			config := *old
+			tt.change(&config)
+			a.applyConfig(&config, "/etc/goagent/config.toml")
+
+			got := []bool{drainReset(a.monitorReset), drainReset(a.reporterReset), drainReset(a.serverReset), drainReset(a.exporterReset)}
+			want := []bool{tt.monitor, tt.reporter, tt.server, tt.exporter}
+			for i, name := range []string{"monitor", "reporter", "server", "exporter"} {
+				if got[i] != want[i] {
+					t.Errorf("%s reset = %v, want %v", name, got[i], want[i])
+				}
+			}
+			if names := eventNames(t, a.outbox.Peek(10)); (len(names) == 1 && names[0] == "config_reloaded") != tt.applied {
+				t.Errorf("events = %v, want config_reloaded %v", names, tt.applied)
+			}
+			if a.getConfig() != &config || a.configPath != "/etc/goagent/config.toml" {
+				t.Errorf("new config not applied")
+			}
+		})
+	}
+}
+
+func TestApplyConfigKeepsDataDir(t *testing.T) {
+	a := newTestAgentService(t, "http://star.test")
+	var logs bytes.Buffer
+	a.logger = log.New(&logs, "", 0)
+	a.logLevel = LogLevelInfo
+	dataDir := a.getConfig().DataDir
+
+	config := *a.getConfig()
+	config.DataDir = "/elsewhere"
+	config.MonitorInterval = 5 * time.Second
+	a.applyConfig(&config, "")
+
+	// 数据目录需要重启后生效，其他设置照常应用
+	if got := a.getConfig(); got.DataDir != dataDir || got.MonitorInterval != 5*time.Second {
+		t.Fatalf("config after reload: data dir %s, interval %v", got.DataDir, got.MonitorInterval)
+	}
+	if !strings.Contains(logs.String(), "数据目录变更需要重启服务") {
+		t.Fatalf("missing restart warning:\n%s", logs.String())
+	}
+}
+
+func TestServerSettingsChanged(t *testing.T) {
+	base := getDefaultConfig()
+	base.ServerEndpoints = []string{"https://a.test", "https://b.test"}
+
+	tests := []struct {
+		name   string
+		change func(c *AgentConfig)
+		want   bool
+	}{
+		{name: "same", change: func(c *AgentConfig) {}},
+		{name: "same endpoints in new slice", change: func(c *AgentConfig) { c.ServerEndpoints = []string{"https://a.test", "https://b.test"} }},
+		{name: "endpoint order", change: func(c *AgentConfig) { c.ServerEndpoints = []string{"https://b.test", "https://a.test"} }, want: true},
+		{name: "port", change: func(c *AgentConfig) { c.ServerPort++ }, want: true},
+		{name: "timeout", change: func(c *AgentConfig) { c.ServerTimeout = time.Minute }, want: true},
+		{name: "probe interval", change: func(c *AgentConfig) { c.ServerProbeInterval = time.Hour }, want: true},
+		{name: "ca file", change: func(c *AgentConfig) { c.ServerCAFile = "/etc/ca.pem" }, want: true},
+		{name: "tls min version", change: func(c *AgentConfig) { c.ServerTLSMinVersion = "1.3" }, want: true},
+		{name: "node id", change: func(c *AgentConfig) { c.NodeID = "other" }, want: true},
+		{name: "node region", change: func(c *AgentConfig) { c.NodeRegion = "cn-north" }, want: true},
+		// 时钟偏差在校验指令时读取，不需要重新连接
+		{name: "clock skew", change: func(c *AgentConfig) { c.ServerClockSkew = time.Hour }},
+		{name: "monitor interval", change: func(c *AgentConfig) { c.MonitorInterval = time.Second }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := *base
+			tt.change(&config)
+			if got := serverSettingsChanged(base, &config); got != tt.want {
+				t.Errorf("serverSettingsChanged = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+}
+
+// writeConfig 在临时目录中写入配置文件
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ConfigFileName)
+	writeTestFile(t, path, []byte(content))
+	return path
+}
+
+func TestParseConfigFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		entries []configEntry
+		errLine int    // 期望的出错行号，0 表示解析成功
+		errMsg  string // 期望错误中包含的内容
+	}{
+		{
+			name:    "sections, quotes and comments",
+			content: "# 注释\nlog_level = debug\n\n[server]\nurl = \"http://star.test:6600\" # 行内注释\nname = 'a # b'\n[monitor]\ninterval=30\n",
+			entries: []configEntry{
+				{Key: "log_level", Value: "debug", Line: 2},
+				{Key: "server.url", Value: "http://star.test:6600", Line: 5},
+				{Key: "server.name", Value: "a # b", Line: 6},
+				{Key: "monitor.interval", Value: "30", Line: 8},
+			},
+		},
+		{name: "escaped quote", content: `key = "say \"hi\" # not comment"`, entries: []configEntry{{Key: "key", Value: `say "hi" # not comment`, Line: 1}}},
+		{name: "dotted section", content: "[server.tls]\nca = ca.pem\n", entries: []configEntry{{Key: "server.tls.ca", Value: "ca.pem", Line: 2}}},
+		{name: "missing bracket", content: "[server\nurl = x\n", errLine: 1, errMsg: "右括号"},
+		{name: "bad section", content: "[ser ver]\n", errLine: 1, errMsg: "无效的分节名"},
+		{name: "missing equals", content: "\n\nurl http://x\n", errLine: 3, errMsg: "缺少 '='"},
+		{name: "bad key", content: "a b = 1\n", errLine: 1, errMsg: "无效的键名"},
+		{name: "empty value", content: "[server]\nurl =\n", errLine: 2, errMsg: "值不能为空"},
+		{name: "unterminated string", content: "url = 'http://x\n", errLine: 1, errMsg: "结束引号"},
+		{name: "duplicate key", content: "[server]\nport = 1\n[server]\nport = 2\n", errLine: 4, errMsg: "首次定义于第 2 行"},
+	}
+	for _, tt := range tests {
+		path := writeConfig(t, tt.content)
+		file, err := parseConfigFile(path)
+		if tt.errLine == 0 {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			if len(file.Entries) != len(tt.entries) {
+				t.Errorf("%s: entries = %+v, want %+v", tt.name, file.Entries, tt.entries)
+				continue
+			}
+			for i, e := range file.Entries {
+				if e != tt.entries[i] {
+					t.Errorf("%s: entry %d = %+v, want %+v", tt.name, i, e, tt.entries[i])
+				}
+			}
+			continue
+		}
+
+		var errs ConfigErrors
+		if !errors.As(err, &errs) || len(errs) == 0 {
+			t.Errorf("%s: err = %v, want ConfigErrors", tt.name, err)
+			continue
+		}
+		if errs[0].File != path || errs[0].Line != tt.errLine || !strings.Contains(errs[0].Msg, tt.errMsg) {
+			t.Errorf("%s: err = %v, want line %d containing %q", tt.name, errs[0], tt.errLine, tt.errMsg)
+		}
+	}
+
+	if _, err := parseConfigFile(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Error("missing file parsed")
+	}
+}
+
+func TestConfigValidationErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    int    // 错误定位的行号
+		want    string // 错误中包含的内容
+	}{
+		{"negative interval", "[monitor]\ninterval = -5\n", 2, "monitor.interval: 监控间隔必须大于 0"},
+		{"zero report interval", "[monitor]\nreport_interval = 0\n", 2, "monitor.report_interval"},
+		{"malformed url", "[server]\nurl = \"star.test:6600\"\n", 2, "server.url"},
+		{"url without host", "[server]\nurl = \"http://\"\n", 2, "地址缺少主机名"},
+		{"port out of range", "[server]\nport = 70000\n", 2, "端口必须在 1-65535 之间"},
+		{"unparsable port", "[server]\nport = abc\n", 2, "server.port 的值 \"abc\" 无效"},
+		{"bad duration", "[monitor]\ninterval = soon\n", 2, "monitor.interval 的值 \"soon\" 无效"},
+		{"cpu limit", "[limits]\nmax_cpu = 150\n", 2, "limits.max_cpu"},
+		{"log level", "[service]\nlog_level = verbose\n", 2, "service.log_level"},
+		{"bad endpoint", "[server]\nendpoints = \"http://a.test, ftp://b.test\"\n", 2, "ftp://b.test"},
+		{"cert without key", "[server]\ncert_file = client.pem\n", 2, "客户端证书和私钥必须同时配置"},
+	}
+	for _, tt := range tests {
+		path := writeConfig(t, tt.content)
+		_, err := loadAgentConfig(&ConfigFlags{Path: path})
+		var errs ConfigErrors
+		if !errors.As(err, &errs) || len(errs) == 0 {
+			t.Errorf("%s: err = %v, want ConfigErrors", tt.name, err)
+			continue
+		}
+		if errs[0].File != path || errs[0].Line != tt.line || !strings.Contains(errs[0].Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %s:%d containing %q", tt.name, errs[0], path, tt.line, tt.want)
+		}
+	}
+
+	// 所有问题一并报告，而不是只报告第一个
+	path := writeConfig(t, "[monitor]\ninterval = 0\nreport_interval = 0\n[server]\nport = 0\n")
+	_, err := loadAgentConfig(&ConfigFlags{Path: path})
+	var errs ConfigErrors
+	if !errors.As(err, &errs) || len(errs) != 3 {
+		t.Errorf("multiple problems: err = %v, want 3 errors", err)
+	}
+
+	// 未知键只给出警告
+	path = writeConfig(t, "[monitor]\nintervall = 30\n[plugins]\nfoo = bar\n")
+	loaded, err := loadAgentConfig(&ConfigFlags{Path: path})
+	if err != nil || len(loaded.Warnings) != 1 || !strings.Contains(loaded.Warnings[0], "monitor.intervall") {
+		t.Errorf("unknown keys: err = %v, warnings = %v", err, loaded.Warnings)
+	}
+}
+
+func TestParseConfigValues(t *testing.T) {
+	durations := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"30", 30 * time.Second},
+		{"5m", 5 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{"2d", 48 * time.Hour},
+		{"-5", -5 * time.Second},
+	}
+	for _, tt := range durations {
+		if got, err := parseConfigDuration(tt.in); err != nil || got != tt.want {
+			t.Errorf("parseConfigDuration(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "soon", "2days", "1.5d"} {
+		if _, err := parseConfigDuration(in); err == nil {
+			t.Errorf("parseConfigDuration(%q) succeeded", in)
+		}
+	}
+
+	sizes := []struct {
+		in   string
+		want int64
+	}{
+		{"1024", 1024},
+		{"64KB", 64 * 1024},
+		{"1.5MB", 3 * 512 * 1024},
+		{"2g", 2 << 30},
+		{"100 B", 100},
+	}
+	for _, tt := range sizes {
+		if got, err := parseConfigSize(tt.in); err != nil || got != tt.want {
+			t.Errorf("parseConfigSize(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+		if tt.want%1024 == 0 {
+			if back, _ := parseConfigSize(formatConfigSize(tt.want)); back != tt.want {
+				t.Errorf("formatConfigSize(%d) = %q does not round-trip", tt.want, formatConfigSize(tt.want))
+			}
+		}
+	}
+	if _, err := parseConfigSize("lots"); err == nil {
+		t.Error("parseConfigSize(lots) succeeded")
+	}
+}
+
+func TestConfigLayering(t *testing.T) {
+	path := writeConfig(t, "[server]\nurl = \"http://file.test\"\nport = 6601\ntimeout = 11\n[monitor]\ninterval = 12\n")
+	t.Setenv(ConfigPathEnv, "")
+	t.Setenv("GOAGENT_SERVER_PORT", "6602")
+	t.Setenv("GOAGENT_SERVER_TIMEOUT", "21")
+	t.Setenv("GOAGENT_REPORT_INTERVAL", "") // 空值视为未设置
+
+	flags, rest, err := parseConfigFlags([]string{"run", "--config", path, "--server-timeout=31", "--server-port", "6603", "--unknown", "--server-port", "6604"})
+	if err != nil {
+		t.Fatalf("parseConfigFlags: %v", err)
+	}
+	if strings.Join(rest, " ") != "run --unknown" {
+		t.Fatalf("rest = %v", rest)
+	}
+	loaded, err := loadAgentConfig(flags)
+	if err != nil {
+		t.Fatalf("loadAgentConfig: %v", err)
+	}
+
+	defaults := getDefaultConfig()
+	tests := []struct {
+		key    string
+		got    interface{}
+		want   interface{}
+		origin string
+	}{
+		{"server.url", loaded.Config.ServerURL, "http://file.test", "file " + path + ":2"},
+		{"server.port", loaded.Config.ServerPort, 6604, "flag --server-port"}, // 同一参数以最后一次为准
+		{"server.timeout", loaded.Config.ServerTimeout, 31 * time.Second, "flag --server-timeout"},
+		{"monitor.interval", loaded.Config.MonitorInterval, 12 * time.Second, "file " + path + ":6"},
+		{"monitor.report_interval", loaded.Config.ReportInterval, defaults.ReportInterval, "default"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.key, tt.got, tt.want)
+		}
+		if origin := loaded.Origins[tt.key].String(); origin != tt.origin {
+			t.Errorf("%s origin = %q, want %q", tt.key, origin, tt.origin)
+		}
+	}
+
+	// 没有命令行参数时环境变量覆盖配置文件
+	t.Setenv(ConfigPathEnv, path)
+	loaded, err = loadAgentConfig(nil)
+	if err != nil {
+		t.Fatalf("loadAgentConfig(env): %v", err)
+	}
+	if loaded.Config.ServerPort != 6602 || loaded.Origins["server.port"].String() != "env GOAGENT_SERVER_PORT" || loaded.Path != path {
+		t.Errorf("env layer: port = %d from %v, path %q", loaded.Config.ServerPort, loaded.Origins["server.port"], loaded.Path)
+	}
+
+	// 来源不是配置文件的校验错误标明来源
+	t.Setenv("GOAGENT_SERVER_PORT", "0")
+	_, err = loadAgentConfig(nil)
+	if err == nil || !strings.Contains(err.Error(), "来源: env GOAGENT_SERVER_PORT") {
+		t.Errorf("env validation error = %v", err)
+	}
+	t.Setenv("GOAGENT_SERVER_PORT", "abc")
+	if _, err = loadAgentConfig(nil); err == nil || !strings.Contains(err.Error(), "GOAGENT_SERVER_PORT") {
+		t.Errorf("invalid env value error = %v", err)
+	}
+
+	if _, _, err := parseConfigFlags([]string{"--server-port"}); err == nil {
+		t.Error("flag without value parsed")
+	}
+	if args := flags.Args(); strings.Join(args, " ") != "--config "+path+" --server-timeout 31 --server-port 6603 --server-port 6604" {
+		t.Errorf("Args() = %v", args)
+	}
+}
+
+func TestConfigFieldsComplete(t *testing.T) {
+	// 每个配置项都能通过文件、环境变量和命令行参数设置，名称不能重复
+	envs, flags := make(map[string]bool), make(map[string]bool)
+	for _, field := range configFields {
+		if field.Env == "" || field.Flag == "" || field.Set == nil || field.Get == nil {
+			t.Errorf("%s: incomplete field", field.Key)
+		}
+		if envs[field.Env] || flags[field.Flag] {
+			t.Errorf("%s: duplicate env %s or flag %s", field.Key, field.Env, field.Flag)
+		}
+		envs[field.Env], flags[field.Flag] = true, true
+		if findConfigField(field.Key) == nil || findConfigFlag(field.Flag) == nil || !isKnownConfigSection(field.Key) {
+			t.Errorf("%s: lookup failed", field.Key)
+		}
+	}
+}
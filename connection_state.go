@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// connectionFileName 连接状态文件名，服务运行时写入数据目录，供 status 命令读取
+const connectionFileName = "connection.json"
+
+// 重连退避参数：第 n 次失败后等待 [0, min(reconnectMaxDelay, reconnectBaseDelay*2^n)) 内的随机时长
+const (
+	reconnectBaseDelay = time.Second
+	reconnectMaxDelay  = 5 * time.Minute
+)
+
+// ConnState 服务端连接状态
+type ConnState string
+
+const (
+	StateDisconnected   ConnState = "disconnected"   // 未连接
+	StateConnecting     ConnState = "connecting"     // 正在连接
+	StateAuthenticating ConnState = "authenticating" // 正在登录
+	StateConnected      ConnState = "connected"      // 已连接，指令通道已建立
+	StateBackoff        ConnState = "backoff"        // 连接失败，等待重试
+)
+
+// Label 状态的中文名称
+func (s ConnState) Label() string {
+	switch s {
+	case StateDisconnected:
+		return "未连接"
+	case StateConnecting:
+		return "正在连接"
+	case StateAuthenticating:
+		return "正在登录"
+	case StateConnected:
+		return "已连接"
+	case StateBackoff:
+		return "等待重试"
+	default:
+		return string(s)
+	}
+}
+
+// ConnectionStatus 服务端连接状态快照
+type ConnectionStatus struct {
+	State         ConnState `json:"state"`
+	Since         time.Time `json:"since"` // 进入当前状态的时间
+	Server        string    `json:"server"`
+	Failures      int       `json:"failures"` // 连续失败次数，连接成功后清零
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorTime time.Time `json:"last_error_time,omitzero"`
+	NextRetry     time.Time `json:"next_retry,omitzero"`
+	PID           int       `json:"pid"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// connectionTracker 记录连接状态变化，并写入状态文件
+type connectionTracker struct {
+	mu     sync.Mutex
+	path   string
+	status ConnectionStatus
+}
+
+// newConnectionTracker 创建连接状态记录，path 为空时不写文件
+func newConnectionTracker(path string) *connectionTracker {
+	now := time.Now()
+	return &connectionTracker{
+		path:   path,
+		status: ConnectionStatus{State: StateDisconnected, Since: now, PID: os.Getpid(), UpdatedAt: now},
+	}
+}
+
+// set 切换连接状态
+func (t *connectionTracker) set(state ConnState, server string) {
+	t.update(func(s *ConnectionStatus) {
+		if s.State != state {
+			s.State, s.Since = state, time.Now()
+		}
+		if server != "" {
+			s.Server = server
+		}
+		if state == StateConnected {
+			s.Failures = 0
+		}
+		if state != StateBackoff {
+			s.NextRetry = time.Time{}
+		}
+	})
+}
+
+// fail 记录一次连接失败，进入退避状态
+func (t *connectionTracker) fail(err error, retryAfter time.Duration) {
+	t.update(func(s *ConnectionStatus) {
+		now := time.Now()
+		s.State, s.Since = StateBackoff, now
+		s.Failures++
+		s.LastError, s.LastErrorTime = err.Error(), now
+		s.NextRetry = now.Add(retryAfter)
+	})
+}
+
+// Status 获取当前连接状态
+func (t *connectionTracker) Status() ConnectionStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.status
+}
+
+// update 修改状态并写入状态文件，写入失败不影响连接
+func (t *connectionTracker) update(fn func(s *ConnectionStatus)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fn(&t.status)
+	t.status.UpdatedAt = time.Now()
+	if t.path == "" {
+		return
+	}
+	if data, err := json.MarshalIndent(t.status, "", "  "); err == nil {
+		writeStateFile(t.path, data, 0644)
+	}
+}
+
+// backoff 带上限的指数退避，使用全抖动 (full jitter) 避免大量节点在服务端恢复后同时重连
+type backoff struct {
+	base, max time.Duration
+	attempt   int
+	rand      *rand.Rand
+}
+
+// newBackoff 创建退避计算器
+func newBackoff(base, max time.Duration) *backoff {
+	return &backoff{base: base, max: max, rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Next 获取下一次重试前的等待时长，并增加失败次数
+func (b *backoff) Next() time.Duration {
+	limit := b.max
+	if b.attempt < 30 {
+		if d := b.base << b.attempt; d > 0 && d < b.max {
+			limit = d
+		}
+	}
+	b.attempt++
+	return time.Duration(b.rand.Int63n(int64(limit)) + 1)
+}
+
+// Reset 连接成功后重置失败次数
+func (b *backoff) Reset() {
+	b.attempt = 0
+}
+
+// sleepContext 等待指定时长，ctx 取消时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// showConnectionStatus 显示服务写入的服务端连接状态
+func showConnectionStatus() {
+	loaded, err := loadAgentConfig(commandLineConfig)
+	if err != nil {
+		return
+	}
+
+	path := filepath.Join(loaded.Config.DataDir, connectionFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var s ConnectionStatus
+	if err := json.Unmarshal(data, &s); err != nil {
+		fmt.Printf("⚠️  连接状态文件无法解析: %v\n", err)
+		return
+	}
+
+	const layout = "2006-01-02 15:04:05"
+	fmt.Println()
+	fmt.Println("服务端连接:")
+	fmt.Printf("   状态: %s (%s)，自 %s\n", s.State.Label(), s.State, s.Since.Format(layout))
+	if s.Server != "" {
+		fmt.Printf("   服务端: %s\n", s.Server)
+	}
+	if s.Failures > 0 {
+		fmt.Printf("   连续失败: %d 次\n", s.Failures)
+	}
+	if s.LastError != "" {
+		fmt.Printf("   最近错误: %s (%s)\n", s.LastError, s.LastErrorTime.Format(layout))
+	}
+	if s.State == StateBackoff && !s.NextRetry.IsZero() {
+		fmt.Printf("   下次重试: %s\n", s.NextRetry.Format(layout))
+	}
+	fmt.Printf("   更新时间: %s (进程 %d)\n", s.UpdatedAt.Format(layout), s.PID)
+	showCredentialStatus(loaded.Config.DataDir)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackoffFullJitter(t *testing.T) {
+	b := newBackoff(time.Second, 10*time.Second)
+	limits := []time.Duration{1, 2, 4, 8, 10, 10, 10}
+	for i, limit := range limits {
+		limit *= time.Second
+		if d := b.Next(); d <= 0 || d > limit {
+			t.Fatalf("attempt %d: delay %v outside (0, %v]", i, d, limit)
+		}
+	}
+
+	b.Reset()
+	if d := b.Next(); d > time.Second {
+		t.Fatalf("after Reset: delay %v > 1s", d)
+	}
+}
+
+func TestBackoffSpreadsRetries(t *testing.T) {
+	// 全抖动下同一轮重试的等待时长应当分散，而不是集中在上限附近
+	seen := make(map[time.Duration]bool)
+	for i := 0; i < 50; i++ {
+		b := newBackoff(time.Second, time.Minute)
+		b.rand.Seed(int64(i))
+		for j := 0; j < 5; j++ {
+			b.Next()
+		}
+		seen[b.Next().Round(time.Second)] = true
+	}
+	if len(seen) < 10 {
+		t.Fatalf("only %d distinct delays out of 50 agents", len(seen))
+	}
+}
+
+func TestSleepContextCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if sleepContext(ctx, time.Minute) {
+		t.Fatal("sleepContext returned true after cancel")
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("sleepContext ignored cancellation")
+	}
+}
+
+func TestConnectionTrackerStates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), connectionFileName)
+	tracker := newConnectionTracker(path)
+
+	tracker.set(StateConnecting, "https://star.example.com")
+	tracker.fail(errors.New("connection refused"), time.Minute)
+	tracker.fail(errors.New("connection refused"), time.Minute)
+
+	s := tracker.Status()
+	if s.State != StateBackoff || s.Failures != 2 || s.LastError != "connection refused" || s.NextRetry.IsZero() {
+		t.Fatalf("status after failures = %+v", s)
+	}
+
+	tracker.set(StateConnected, "")
+	s = tracker.Status()
+	if s.State != StateConnected || s.Failures != 0 || !s.NextRetry.IsZero() || s.Server != "https://star.example.com" {
+		t.Fatalf("status after connect = %+v", s)
+	}
+	// 最近一次错误保留，便于排查间歇性故障
+	if s.LastError == "" {
+		t.Fatal("last error cleared after connect")
+	}
+}
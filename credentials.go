@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// credentialsFileName 节点密钥文件名，权限为 0600，只有运行代理的用户可以读取
+const credentialsFileName = "credentials.json"
+
+// NodeCredentials 通过注册码换取的节点密钥
+type NodeCredentials struct {
+	NodeID        string    `json:"node_id"`
+	Secret        string    `json:"secret"`
+	PendingSecret string    `json:"pending_secret,omitempty"` // 轮换中尚未确认服务端已接受的新密钥
+	IssuedAt      time.Time `json:"issued_at"`
+	RotateAt      time.Time `json:"rotate_at,omitzero"` // 服务端要求的下次轮换时间
+	Server        string    `json:"server"`             // 注册时使用的服务端
+}
+
+// credentialsPath 获取节点密钥文件路径
+func credentialsPath(dataDir string) string {
+	return filepath.Join(dataDir, credentialsFileName)
+}
+
+// loadCredentials 读取节点密钥，文件权限过宽时收紧为 0600
+func loadCredentials(dataDir string) (*NodeCredentials, error) {
+	path := credentialsPath(dataDir)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		os.Chmod(path, 0600)
+	}
+
+	var creds NodeCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return nil, fmt.Errorf("解析节点密钥文件失败: %v", err)
+	}
+	if creds.Secret == "" {
+		return nil, fmt.Errorf("节点密钥文件 %s 中缺少 secret", path)
+	}
+	return &creds, nil
+}
+
+// saveCredentials 保存节点密钥
+func saveCredentials(dataDir string, creds *NodeCredentials) error {
+	data, err := json.MarshalIndent(creds, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(credentialsPath(dataDir), data, 0600)
+}
+
+// generateSecret 生成 256 位随机密钥
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// unixMilliTime 将 Unix 毫秒转换为时间，0 表示未设置
+func unixMilliTime(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// enrollNode 使用注册码换取节点密钥，按优先级依次尝试服务端地址
+// 注册码无效或已过期等业务错误不再尝试其他地址
+func enrollNode(ctx context.Context, config *AgentConfig, nodeID, code string, info *NodeInfo) (*NodeCredentials, error) {
+	req := &EnrollRequest{
+		EnrollCode:  code,
+		Code:        nodeID,
+		ProductCode: ProductCode,
+		Node:        buildLoginNodeInfo(info, config),
+	}
+
+	var lastErr error
+	for _, endpoint := range serverEndpoints(config) {
+		client, err := newServerClient(config, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Enroll(ctx, req)
+		client.Close()
+		if err != nil {
+			var apiErr *ApiError
+			if errors.As(err, &apiErr) || errors.Is(err, ErrUnauthorized) {
+				return nil, fmt.Errorf("注册码无效或已过期: %v", err)
+			}
+			lastErr = fmt.Errorf("%s: %v", endpoint, err)
+			continue
+		}
+		if resp.Secret == "" {
+			return nil, fmt.Errorf("注册响应缺少节点密钥")
+		}
+		return &NodeCredentials{
+			NodeID:   nodeID,
+			Secret:   resp.Secret,
+			IssuedAt: time.Now(),
+			RotateAt: unixMilliTime(resp.SecretRotate),
+			Server:   endpoint,
+		}, nil
+	}
+	return nil, lastErr
+}
+
+// runEnrollCommand 处理 enroll 命令：enroll --code XXXX [--force]
+func runEnrollCommand(args []string) int {
+	var code string
+	force := false
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--code" && i+1 < len(args):
+			i++
+			code = args[i]
+		case strings.HasPrefix(arg, "--code="):
+			code = strings.TrimPrefix(arg, "--code=")
+		case arg == "--force":
+			force = true
+		default:
+			fmt.Printf("未知参数: %s\n", arg)
+			fmt.Println("用法: enroll --code <注册码> [--force]")
+			return 2
+		}
+	}
+	if code == "" {
+		fmt.Println("用法: enroll --code <注册码> [--force]")
+		return 2
+	}
+
+	loaded, err := loadAgentConfig(commandLineConfig)
+	if err != nil {
+		printConfigErrors(err)
+		return 1
+	}
+	config := loaded.Config
+
+	if creds, err := loadCredentials(config.DataDir); err == nil && !force {
+		fmt.Printf("⚠️  节点 %s 已于 %s 注册，如需重新注册请加 --force\n", creds.NodeID, creds.IssuedAt.Format("2006-01-02 15:04:05"))
+		return 1
+	}
+
+	nodeID := config.NodeID
+	if nodeID == "" {
+		identity, _, err := resolveNodeIdentity(config.DataDir)
+		if err != nil {
+			fmt.Printf("❌ 读取节点身份失败: %v\n", err)
+			return 1
+		}
+		nodeID = identity.NodeID
+	}
+
+	fmt.Printf("🔑 正在注册节点 %s...\n", nodeID)
+	ctx, cancel := context.WithTimeout(context.Background(), config.ServerTimeout*time.Duration(len(serverEndpoints(config))))
+	defer cancel()
+	creds, err := enrollNode(ctx, config, nodeID, code, collectNodeInfo(systemRootFromConfig(config)))
+	if err != nil {
+		fmt.Printf("❌ 注册失败: %v\n", err)
+		return 1
+	}
+	if err := saveCredentials(config.DataDir, creds); err != nil {
+		fmt.Printf("❌ 保存节点密钥失败: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("✅ 注册成功，服务端: %s\n", creds.Server)
+	fmt.Printf("   密钥文件: %s (仅当前用户可读)\n", credentialsPath(config.DataDir))
+	if !creds.RotateAt.IsZero() {
+		fmt.Printf("   下次轮换: %s\n", creds.RotateAt.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Println("💡 如服务正在运行，请重启服务使节点密钥生效")
+	return 0
+}
+
+// loadNodeCredentials 读取与当前节点ID匹配的节点密钥，未注册时返回 nil
+func (a *AgentService) loadNodeCredentials(config *AgentConfig) *NodeCredentials {
+	creds, err := loadCredentials(config.DataDir)
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		a.logWarn("⚠️ %v", err)
+		return nil
+	case creds.NodeID != config.NodeID:
+		a.logWarn("⚠️ 节点密钥属于节点 %s，与当前节点ID %s 不符，请重新注册", creds.NodeID, config.NodeID)
+		return nil
+	}
+	return creds
+}
+
+// checkSecretRotation 记录服务端要求的轮换时间，到期时轮换节点密钥
+func (a *AgentService) checkSecretRotation(client *StarClient, rotateAt int64) {
+	a.credMu.Lock()
+	creds := a.credentials
+	if creds == nil || rotateAt <= 0 {
+		a.credMu.Unlock()
+		return
+	}
+	if at := unixMilliTime(rotateAt); !at.Equal(creds.RotateAt) {
+		creds.RotateAt = at
+		if err := saveCredentials(a.getConfig().DataDir, creds); err != nil {
+			a.logWarn("⚠️ 保存节点密钥失败: %v", err)
+		}
+	}
+	due := !time.Now().Before(creds.RotateAt)
+	a.credMu.Unlock()
+
+	if due {
+		if err := a.rotateSecret(a.ctx, client); err != nil {
+			a.logWarn("⚠️ 轮换节点密钥失败: %v", err)
+		}
+	}
+}
+
+// rotateSecret 轮换节点密钥
+// 新密钥先作为待确认密钥写入文件，再提交给服务端；服务端确认后才替换当前密钥。
+// 提交结果未知（如超时）时保留待确认密钥，下次轮换重新提交同一个密钥，登录时两个密钥都会尝试。
+// 提交期间不持有 credMu，避免网络请求阻塞登录和指令处理；ctx 取消时放弃提交
+func (a *AgentService) rotateSecret(ctx context.Context, client *StarClient) error {
+	if client == nil {
+		return fmt.Errorf("尚未登录服务端，无法轮换节点密钥")
+	}
+
+	a.credMu.Lock()
+	creds := a.credentials
+	if creds == nil {
+		a.credMu.Unlock()
+		return fmt.Errorf("节点尚未注册，没有可轮换的密钥")
+	}
+	dataDir := a.getConfig().DataDir
+	if creds.PendingSecret == "" {
+		secret, err := generateSecret()
+		if err != nil {
+			a.credMu.Unlock()
+			return err
+		}
+		creds.PendingSecret = secret
+		if err := saveCredentials(dataDir, creds); err != nil {
+			creds.PendingSecret = ""
+			a.credMu.Unlock()
+			return err
+		}
+	}
+	pending := creds.PendingSecret
+	a.credMu.Unlock()
+
+	resp, err := client.RotateSecret(ctx, &RotateSecretRequest{Secret: pending})
+	if err != nil {
+		return err
+	}
+
+	a.credMu.Lock()
+	defer a.credMu.Unlock()
+	creds = a.credentials
+	switch {
+	case creds != nil && creds.Secret == pending:
+		return nil // 同时进行的另一次轮换已经确认
+	case creds == nil || creds.PendingSecret != pending:
+		return fmt.Errorf("轮换期间节点密钥被修改，放弃本次轮换结果")
+	}
+	creds.Secret, creds.PendingSecret = pending, ""
+	creds.IssuedAt = time.Now()
+	creds.RotateAt = unixMilliTime(resp.SecretRotate)
+	client.SetSecret(creds.NodeID, creds.Secret)
+	if err := saveCredentials(dataDir, creds); err != nil {
+		return err
+	}
+
+	a.logInfo("🔑 节点密钥已轮换")
+	a.recordEvent(eventInfo, "secret_rotated", "")
+	return nil
+}
+
+// showCredentialStatus 显示节点注册状态
+func showCredentialStatus(dataDir string) {
+	const layout = "2006-01-02 15:04:05"
+	creds, err := loadCredentials(dataDir)
+	switch {
+	case os.IsNotExist(err):
+		fmt.Println("   节点密钥: 未注册 (使用 enroll --code <注册码> 注册)")
+	case err != nil:
+		fmt.Printf("   节点密钥: %v\n", err)
+	default:
+		fmt.Printf("   节点密钥: 已注册 (节点 %s，签发于 %s)\n", creds.NodeID, creds.IssuedAt.Format(layout))
+		if !creds.RotateAt.IsZero() {
+			fmt.Printf("   下次轮换: %s\n", creds.RotateAt.Format(layout))
+		}
+		if creds.PendingSecret != "" {
+			fmt.Println("   ⚠️ 有一次密钥轮换尚未得到服务端确认")
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestEnrollNode(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	standIn.enrollCode = "ABCD-1234"
+	config := getDefaultConfig()
+	config.ServerURL = server.URL
+	ctx := context.Background()
+	info := &NodeInfo{Hostname: "test"}
+
+	if _, err := enrollNode(ctx, config, "node-test", "WRONG", info); err == nil {
+		t.Fatal("enroll with wrong code succeeded")
+	}
+	creds, err := enrollNode(ctx, config, "node-test", "ABCD-1234", info)
+	if err != nil {
+		t.Fatalf("enrollNode: %v", err)
+	}
+	if creds.Secret != "secret-node-test" || creds.NodeID != "node-test" || creds.Server != server.URL {
+		t.Fatalf("credentials = %+v", creds)
+	}
+	// 注册码只能使用一次
+	if _, err := enrollNode(ctx, config, "node-test", "ABCD-1234", info); err == nil {
+		t.Fatal("enroll code reused")
+	}
+
+	dataDir := t.TempDir()
+	if err := saveCredentials(dataDir, creds); err != nil {
+		t.Fatalf("saveCredentials: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		stat, _ := os.Stat(credentialsPath(dataDir))
+		if perm := stat.Mode().Perm(); perm != 0600 {
+			t.Fatalf("credentials file mode = %o, want 600", perm)
+		}
+		os.Chmod(credentialsPath(dataDir), 0644)
+	}
+	loaded, err := loadCredentials(dataDir)
+	if err != nil || loaded.Secret != creds.Secret {
+		t.Fatalf("loadCredentials = %+v, %v", loaded, err)
+	}
+	if runtime.GOOS != "windows" {
+		stat, _ := os.Stat(credentialsPath(dataDir))
+		if perm := stat.Mode().Perm(); perm != 0600 {
+			t.Fatalf("credentials file mode after load = %o, want 600", perm)
+		}
+	}
+}
+
+func TestSecretRotation(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	standIn.secret = "secret-1"
+	standIn.rotateAt = time.Now().Add(-time.Minute).UnixMilli()
+	a := newTestAgentService(t, server.URL)
+	dataDir := a.getConfig().DataDir
+	saveCredentials(dataDir, &NodeCredentials{NodeID: "node-test", Secret: "secret-1", IssuedAt: time.Now()})
+
+	// 轮换时间已到，登录后立即轮换
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("connectToServer: %v", err)
+	}
+	if len(standIn.rotations) != 1 {
+		t.Fatalf("rotations = %v, want 1", standIn.rotations)
+	}
+	creds, _ := loadCredentials(dataDir)
+	if creds.Secret != standIn.rotations[0] || creds.PendingSecret != "" || !creds.RotateAt.After(time.Now()) {
+		t.Fatalf("credentials after rotation = %+v", creds)
+	}
+
+	// 未到轮换时间的心跳不会轮换
+	a.reportNodeStatus(time.Now())
+	if len(standIn.rotations) != 1 {
+		t.Fatalf("rotations after ping = %v, want 1", standIn.rotations)
+	}
+
+	// 未登录时无法轮换
+	if err := a.rotateSecret(context.Background(), nil); err == nil {
+		t.Fatal("rotateSecret without client succeeded")
+	}
+
+	// 指令被取消（如服务停止）时放弃提交，新密钥保留为待确认密钥
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.rotateSecret(cancelled, a.getClient()); err == nil || len(standIn.rotations) != 1 {
+		t.Fatalf("cancelled rotateSecret: err = %v, rotations = %v", err, standIn.rotations)
+	}
+
+	// 提交新密钥期间不持有 credMu
+	standIn.mu.Lock()
+	standIn.delay = 300 * time.Millisecond
+	standIn.mu.Unlock()
+	done := make(chan error, 1)
+	go func() { done <- a.rotateSecret(context.Background(), a.getClient()) }()
+	time.Sleep(50 * time.Millisecond)
+	locked := make(chan struct{})
+	go func() {
+		a.credMu.Lock()
+		a.credMu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-done:
+		t.Fatal("credMu held while submitting the new secret")
+	}
+	if err := <-done; err != nil || len(standIn.rotations) != 2 {
+		t.Fatalf("rotateSecret: err = %v, rotations = %v", err, standIn.rotations)
+	}
+	standIn.mu.Lock()
+	standIn.delay = 0
+	standIn.mu.Unlock()
+
+	// 服务端接受了新密钥但节点没有收到确认，重新登录时使用待确认密钥
+	standIn.mu.Lock()
+	standIn.secret = "secret-3"
+	standIn.mu.Unlock()
+	creds.PendingSecret = "secret-3"
+	saveCredentials(dataDir, creds)
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("connectToServer with pending secret: %v", err)
+	}
+	creds, _ = loadCredentials(dataDir)
+	if creds.Secret != "secret-3" || creds.PendingSecret != "" {
+		t.Fatalf("credentials after pending fallback = %+v", creds)
+	}
+}
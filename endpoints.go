@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// endpointFileName 记录最近一次连接成功的服务端地址，重启后优先连接该地址
+const endpointFileName = "endpoint.json"
+
+// savedEndpoint 最近一次连接成功的服务端地址
+type savedEndpoint struct {
+	URL  string    `json:"url"`
+	Time time.Time `json:"time"`
+}
+
+// serverEndpoints 按优先级排列的服务端地址，未配置 server.endpoints 时使用 server.url 和 server.port
+func serverEndpoints(c *AgentConfig) []string {
+	if len(c.ServerEndpoints) == 0 {
+		return []string{serverBaseURL(c)}
+	}
+	endpoints := make([]string, 0, len(c.ServerEndpoints))
+	for _, endpoint := range c.ServerEndpoints {
+		endpoints = append(endpoints, strings.TrimRight(endpoint, "/"))
+	}
+	return endpoints
+}
+
+// endpointSelector 按优先级选择服务端地址
+// 列表顺序即优先级。当前地址连接失败后依次切换到下一个地址，所有地址都失败一轮后才退避等待；
+// 连接在低优先级地址上时，由指令通道定期探测更高优先级的地址，恢复后切回
+type endpointSelector struct {
+	mu        sync.Mutex
+	path      string // 为空时不保存
+	endpoints []string
+	current   int
+	failed    int    // 本轮连续失败的地址数
+	lastGood  string // 最近一次连接成功的地址
+	loaded    bool
+}
+
+// newEndpointSelector 创建地址选择器，path 为保存最近可用地址的文件
+func newEndpointSelector(path string) *endpointSelector {
+	return &endpointSelector{path: path}
+}
+
+// Update 更新地址列表，列表变化时从最近可用的地址开始，不在列表中时从优先级最高的地址开始
+func (s *endpointSelector) Update(endpoints []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loaded {
+		s.loaded = true
+		if data, err := os.ReadFile(s.path); err == nil {
+			var saved savedEndpoint
+			if json.Unmarshal(data, &saved) == nil {
+				s.lastGood = saved.URL
+			}
+		}
+	} else if strings.Join(endpoints, ",") == strings.Join(s.endpoints, ",") {
+		return
+	}
+
+	s.endpoints = endpoints
+	s.current, s.failed = 0, 0
+	for i, endpoint := range endpoints {
+		if endpoint == s.lastGood {
+			s.current = i
+		}
+	}
+}
+
+// Current 当前使用的地址及其优先级序号（0 为最高）
+func (s *endpointSelector) Current() (int, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.endpoints) == 0 {
+		return 0, ""
+	}
+	return s.current, s.endpoints[s.current]
+}
+
+// Succeeded 当前地址连接成功（指令通道已建立），返回之前最近可用的地址
+func (s *endpointSelector) Succeeded() (previous string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = 0
+	endpoint := s.endpoints[s.current]
+	previous = s.lastGood
+	if endpoint != s.lastGood {
+		s.lastGood = endpoint
+		if s.path != "" {
+			if data, err := json.MarshalIndent(savedEndpoint{URL: endpoint, Time: time.Now()}, "", "  "); err == nil {
+				writeStateFile(s.path, data, 0644)
+			}
+		}
+	}
+	return previous
+}
+
+// Failed 当前地址连接失败，切换到下一个地址
+// 本轮所有地址都已失败时返回 true，调用方应退避等待后再重试
+func (s *endpointSelector) Failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed++
+	s.current = (s.current + 1) % len(s.endpoints)
+	if s.failed >= len(s.endpoints) {
+		s.failed = 0
+		return true
+	}
+	return false
+}
+
+// Preferred 优先级高于当前地址的地址，按优先级排列
+func (s *endpointSelector) Preferred() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.endpoints[:s.current]...)
+}
+
+// SwitchTo 切换到指定地址，地址不在列表中时忽略
+func (s *endpointSelector) SwitchTo(endpoint string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, e := range s.endpoints {
+		if e == endpoint {
+			s.current, s.failed = i, 0
+		}
+	}
+}
+
+// endpointConnected 指令通道建立后记录当前地址可用
+// 只登录成功的地址仍计入本轮失败，否则所有地址都无法建立指令通道时会不经退避地反复登录
+func (a *AgentService) endpointConnected() {
+	_, endpoint := a.endpoints.Current()
+	if previous := a.endpoints.Succeeded(); previous != "" && previous != endpoint {
+		a.logInfo("🔀 服务端已切换: %s -> %s", previous, endpoint)
+		a.recordEvent(eventInfo, "server_switched", previous+" -> "+endpoint)
+	}
+}
+
+// probePreferredEndpoint 探测优先级更高的地址，返回第一个可用的地址，均不可用时返回空字符串
+func (a *AgentService) probePreferredEndpoint() string {
+	config := a.getConfig()
+	for _, endpoint := range a.endpoints.Preferred() {
+		client, err := a.newStarClient(config, endpoint)
+		if err != nil {
+			return ""
+		}
+		ctx, cancel := context.WithTimeout(a.ctx, config.ServerTimeout)
+		err = client.Probe(ctx)
+		cancel()
+		client.Close()
+		if err == nil {
+			return endpoint
+		}
+		a.logDebug("🔍 服务端 %s 仍不可用: %v", endpoint, err)
+	}
+	return ""
+}
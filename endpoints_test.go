@@ -0,0 +1,187 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEndpointSelectorFailover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), endpointFileName)
+	endpoints := []string{"https://primary", "https://dr", "https://backup"}
+
+	s := newEndpointSelector(path)
+	s.Update(endpoints)
+	for i, want := range []struct {
+		cycleDone bool
+		next      string
+	}{{false, "https://dr"}, {false, "https://backup"}, {true, "https://primary"}} {
+		if got := s.Failed(); got != want.cycleDone {
+			t.Fatalf("Failed #%d = %v, want %v", i, got, want.cycleDone)
+		}
+		if _, current := s.Current(); current != want.next {
+			t.Fatalf("after Failed #%d current = %s, want %s", i, current, want.next)
+		}
+	}
+
+	s.Failed()
+	if previous := s.Succeeded(); previous != "" {
+		t.Fatalf("Succeeded previous = %q, want empty", previous)
+	}
+
+	// 重启后从最近可用的地址开始，并把更高优先级的地址作为探测对象
+	restarted := newEndpointSelector(path)
+	restarted.Update(endpoints)
+	if index, current := restarted.Current(); index != 1 || current != "https://dr" {
+		t.Fatalf("restarted current = %d %s, want 1 https://dr", index, current)
+	}
+	if preferred := restarted.Preferred(); len(preferred) != 1 || preferred[0] != "https://primary" {
+		t.Fatalf("Preferred = %v, want [https://primary]", preferred)
+	}
+
+	// 地址列表变化后最近可用的地址已不在列表中，从优先级最高的地址开始
+	restarted.Update([]string{"https://primary2", "https://backup"})
+	if index, _ := restarted.Current(); index != 0 {
+		t.Fatalf("after Update current index = %d, want 0", index)
+	}
+}
+
+func TestServerFailoverAndFailback(t *testing.T) {
+	_, primary := newStarStandIn(t)
+	_, dr := newStarStandIn(t)
+
+	// 主服务端故障时所有请求返回 503
+	var primaryDown atomic.Bool
+	primaryDown.Store(true)
+	handler := primary.Config.Handler
+	primary.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if primaryDown.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	a := newTestAgentService(t, "")
+	a.config.ServerEndpoints = []string{primary.URL, dr.URL}
+	a.endpoints = newEndpointSelector(filepath.Join(t.TempDir(), endpointFileName))
+
+	if err := a.connectToServer(); err == nil {
+		t.Fatal("connected to failed primary")
+	}
+	if a.endpoints.Failed() {
+		t.Fatal("cycle finished before trying the DR server")
+	}
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("failover to DR: %v", err)
+	}
+	a.endpointConnected() // 指令通道建立后才记录地址可用
+	if _, current := a.endpoints.Current(); current != dr.URL {
+		t.Fatalf("current = %s, want DR %s", current, dr.URL)
+	}
+
+	if endpoint := a.probePreferredEndpoint(); endpoint != "" {
+		t.Fatalf("probe returned %s while primary is down", endpoint)
+	}
+	primaryDown.Store(false)
+	endpoint := a.probePreferredEndpoint()
+	if endpoint != primary.URL {
+		t.Fatalf("probe = %q, want primary %s", endpoint, primary.URL)
+	}
+
+	a.endpoints.SwitchTo(endpoint)
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("failback to primary: %v", err)
+	}
+	a.endpointConnected()
+	items := a.outbox.Peek(10)
+	if len(items) != 1 || items[0].Kind != outboxEvent {
+		t.Fatalf("expected one server_switched event, got %+v", items)
+	}
+}
+
+func TestNotifyDialFailureFailsOver(t *testing.T) {
+	_, primary := newStarStandIn(t)
+	dr, drServer := newStarStandIn(t)
+
+	// 主服务端登录正常，但指令通道无法建立（如反向代理未转发 WebSocket）
+	var dials atomic.Int32
+	handler := primary.Config.Handler
+	primary.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/node/notify" {
+			dials.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	a := newTestAgentService(t, "")
+	a.config.ServerEndpoints = []string{primary.URL, drServer.URL}
+	a.endpoints = newEndpointSelector(filepath.Join(t.TempDir(), endpointFileName))
+	a.wg.Add(1)
+	go a.runServerConnection()
+	defer a.wg.Wait()
+	defer a.cancel()
+
+	// 指令通道建立失败计入主服务端的可用性，立即切换到灾备服务端，不等待退避
+	select {
+	case <-dr.notify:
+	case <-time.After(2 * time.Second):
+		t.Fatal("did not fail over to the DR server after the command channel failed")
+	}
+	if dials.Load() != 1 {
+		t.Fatalf("command channel dials on primary = %d, want 1", dials.Load())
+	}
+	if _, current := a.endpoints.Current(); current != drServer.URL {
+		t.Fatalf("current = %s, want DR %s", current, drServer.URL)
+	}
+}
+
+func TestNotifyDialFailureOnAllEndpointsBacksOff(t *testing.T) {
+	// 所有服务端登录正常，但指令通道都无法建立
+	var standIns []*starStandIn
+	var servers []*httptest.Server
+	for i := 0; i < 2; i++ {
+		standIn, server := newStarStandIn(t)
+		handler := server.Config.Handler
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/node/notify" {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			handler.ServeHTTP(w, r)
+		})
+		standIns, servers = append(standIns, standIn), append(servers, server)
+	}
+
+	a := newTestAgentService(t, "")
+	a.config.ServerEndpoints = []string{servers[0].URL, servers[1].URL}
+	a.endpoints = newEndpointSelector(filepath.Join(t.TempDir(), endpointFileName))
+	a.wg.Add(1)
+	go a.runServerConnection()
+	time.Sleep(time.Second)
+	a.cancel()
+	a.wg.Wait()
+
+	// 每轮尝试所有地址后退避等待，1 秒内最多只有几轮
+	var logins int
+	for i, standIn := range standIns {
+		standIn.mu.Lock()
+		// 停止时正在进行的登录没有建立会话，无需注销
+		if n := len(standIn.logins); n == 0 || standIn.logouts < n-1 {
+			t.Errorf("server %d: %d logins, %d logouts", i, n, standIn.logouts)
+		}
+		logins += len(standIn.logins)
+		standIn.mu.Unlock()
+	}
+	if logins > 10 {
+		t.Fatalf("%d logins in 1s, want backoff after each round", logins)
+	}
+	if status := a.conn.Status(); status.Failures < 2 {
+		t.Fatalf("connection failures = %d, want at least one full round", status.Failures)
+	}
+}
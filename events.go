@@ -0,0 +1,28 @@
+package main
+
+import "time"
+
+// 节点事件类型
+const (
+	eventInfo  = "info"
+	eventAlert = "alert"
+)
+
+// recordEvent 记录节点事件，事件先写入离线队列再由状态报告器发送，服务端不可达时不会丢失
+func (a *AgentService) recordEvent(kind, name, remark string) {
+	a.queueOutbox(outboxEvent, NodeEvent{Time: time.Now().UnixMilli(), Type: kind, Name: name, Remark: remark})
+	notifyReset(a.flushNow)
+}
+
+// updateAlert 更新告警状态，只在告警出现和解除时记录事件，避免每个监控周期重复上报
+func (a *AgentService) updateAlert(name string, active bool, remark string) {
+	if a.alerts[name] == active {
+		return
+	}
+	a.alerts[name] = active
+	if active {
+		a.recordEvent(eventAlert, name, remark)
+	} else {
+		a.recordEvent(eventInfo, name+"_recovered", remark)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 默认执行超时，不超过策略中的 max_timeout
+const defaultExecTimeout = time.Minute
+
+// execWaitDelay 进程被终止或退出后，等待子进程释放输出管道的最长时间
+const execWaitDelay = 2 * time.Second
+
+// execBaseEnv 从代理自身环境中传给被执行程序的变量，其余变量（如节点密钥路径、代理设置）不传递
+var execBaseEnv = []string{"PATH", "LANG"}
+
+// ExecResult exec 指令的执行结果
+type ExecResult struct {
+	Program         string `json:"program"`  // 实际执行的程序完整路径
+	ExitCode        int    `json:"exitCode"` // 被终止时为 -1
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	StdoutTruncated bool   `json:"stdoutTruncated,omitempty"`
+	StderrTruncated bool   `json:"stderrTruncated,omitempty"`
+	TimedOut        bool   `json:"timedOut,omitempty"`
+}
+
+// cappedBuffer 只保留前 max 字节的输出，超出部分丢弃并标记截断，不会阻塞进程写入
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	max       int64
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.max - int64(b.buf.Len()); remaining < int64(len(p)) {
+		b.truncated = true
+		if remaining > 0 {
+			b.buf.Write(p[:remaining])
+		}
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// execCommand 处理 exec 指令：按本机执行策略运行程序
+// 参数 program 为程序名或路径，args 为参数数组（不经过 shell），workdir 为工作目录，
+// env 为追加的环境变量（须在策略允许列表中），timeout 为超时时间（不超过策略的 max_timeout）
+func (a *AgentService) execCommand(ctx context.Context, args commandArgs) (*ExecResult, error) {
+	// 只执行已注册节点收到的、签名校验通过的指令，不依赖指令分发时的检查
+	a.credMu.Lock()
+	registered := a.credentials != nil
+	a.credMu.Unlock()
+	if !registered || !commandVerified(ctx) {
+		a.recordEvent(eventAlert, "exec_denied", "指令未通过签名校验")
+		return nil, commandErrorf(codeDenied, "exec 指令只接受已注册节点收到的签名指令")
+	}
+
+	policy, err := loadExecPolicy(a.getConfig().ExecPolicyFile)
+	if err != nil {
+		a.recordEvent(eventAlert, "exec_denied", err.Error())
+		return nil, commandErrorf(codeDenied, "%v", err)
+	}
+
+	program := args.String("program")
+	path, err := policy.Resolve(program)
+	if err == nil {
+		err = policy.CheckEnv(args.Map("env"))
+	}
+	if err != nil {
+		a.logWarn("⚠️ 拒绝执行 %s: %v", program, err)
+		a.recordEvent(eventAlert, "exec_denied", err.Error())
+		return nil, err
+	}
+
+	timeout := args.Duration("timeout", min(defaultExecTimeout, policy.MaxTimeout))
+	if timeout <= 0 || timeout > policy.MaxTimeout {
+		return nil, commandErrorf(codeInvalidArgument, "timeout 必须在 0-%v 之间", policy.MaxTimeout)
+	}
+	workdir := args.String("workdir")
+	if workdir != "" {
+		if !filepath.IsAbs(workdir) {
+			return nil, commandErrorf(codeInvalidArgument, "工作目录必须是绝对路径: %s", workdir)
+		}
+		if info, err := os.Stat(workdir); err != nil || !info.IsDir() {
+			return nil, commandErrorf(codeInvalidArgument, "工作目录不存在: %s", workdir)
+		}
+	}
+
+	a.logInfo("🛠️ 执行 %s %s", path, strings.Join(args.List("args"), " "))
+	argv := append([]string{program}, args.List("args")...)
+	return runExec(ctx, path, argv, workdir, args.Map("env"), timeout, policy.MaxOutput)
+}
+
+// runExec 运行程序并收集输出
+// 程序及其子进程放在独立的进程组（Windows 上为作业对象）中，超时或取消时整组强制终止
+// path 为通过策略检查的实际路径；argv[0] 为请求的程序名，busybox 等多调用程序据此选择功能
+func runExec(ctx context.Context, path string, argv []string, workdir string, env map[string]string, timeout time.Duration, maxOutput int64) (*ExecResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout := &cappedBuffer{max: maxOutput}
+	stderr := &cappedBuffer{max: maxOutput}
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Args = argv
+	cmd.Dir = workdir
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.WaitDelay = execWaitDelay
+	cmd.Env = []string{}
+	for _, k := range execBaseEnv {
+		if v, ok := os.LookupEnv(k); ok {
+			cmd.Env = append(cmd.Env, k+"="+v)
+		}
+	}
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	tree := &processTree{}
+	tree.prepare(cmd)
+	cmd.Cancel = tree.kill
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动 %s 失败: %v", path, err)
+	}
+	defer tree.release()
+	if err := tree.attach(cmd); err != nil {
+		tree.kill()
+		cmd.Wait()
+		return nil, fmt.Errorf("创建进程组失败: %v", err)
+	}
+	err := cmd.Wait()
+
+	result := &ExecResult{
+		Program:         path,
+		ExitCode:        cmd.ProcessState.ExitCode(),
+		Stdout:          stdout.buf.String(),
+		Stderr:          stderr.buf.String(),
+		StdoutTruncated: stdout.truncated,
+		StderrTruncated: stderr.truncated,
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		result.TimedOut = true
+		return result, commandErrorf(codeTimeout, "执行超时 (%v)，已终止进程组", timeout)
+	case ctx.Err() != nil:
+		return result, commandErrorf(codeCancelled, "服务停止，已终止进程组")
+	case result.ExitCode != 0:
+		return result, commandErrorf(codeExitStatus, "进程退出码 %d", result.ExitCode)
+	case err != nil && !errors.Is(err, exec.ErrWaitDelay):
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// execPolicyFileName exec 指令执行策略的默认文件名，位于系统配置目录
+const execPolicyFileName = "exec-policy.toml"
+
+// exec 指令的上限，策略文件中的设置不能超过这些值
+const (
+	maxExecTimeout = time.Hour
+	maxExecOutput  = 16 * 1024 * 1024
+)
+
+// execPolicy 本机执行策略，只从本地文件读取，服务端无法修改
+// 程序路径按通配符匹配，禁止列表优先于允许列表；允许列表为空时禁止所有程序
+type execPolicy struct {
+	Path       string
+	Allow      []string      // 允许执行的程序
+	Deny       []string      // 禁止执行的程序
+	Env        []string      // 允许服务端设置的环境变量名
+	MaxTimeout time.Duration // 单次执行的最长时间
+	MaxOutput  int64         // stdout、stderr 各自保留的最大字节数
+}
+
+// loadExecPolicy 读取执行策略文件，每次执行前重新读取，修改后立即生效
+// 非 Windows 系统上文件或所在目录不属于 root 或运行代理的用户、可被其他用户写入时拒绝加载
+func loadExecPolicy(path string) (*execPolicy, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("本机未配置执行策略 %s，禁止执行", path)
+		}
+		return nil, err
+	}
+	if err := checkPolicyFile(path, info); err != nil {
+		return nil, err
+	}
+
+	file, err := parseConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &execPolicy{Path: path, MaxTimeout: 5 * time.Minute, MaxOutput: 64 * 1024}
+	for _, entry := range file.Entries {
+		var err error
+		switch entry.Key {
+		case "allow":
+			policy.Allow = splitConfigList(entry.Value)
+		case "deny":
+			policy.Deny = splitConfigList(entry.Value)
+		case "env":
+			policy.Env = splitConfigList(entry.Value)
+		case "max_timeout":
+			if policy.MaxTimeout, err = parseConfigDuration(entry.Value); err == nil && (policy.MaxTimeout <= 0 || policy.MaxTimeout > maxExecTimeout) {
+				err = fmt.Errorf("必须在 0-%v 之间", maxExecTimeout)
+			}
+		case "max_output":
+			if policy.MaxOutput, err = parseConfigSize(entry.Value); err == nil && (policy.MaxOutput <= 0 || policy.MaxOutput > maxExecOutput) {
+				err = fmt.Errorf("必须在 0-%s 之间", formatConfigSize(maxExecOutput))
+			}
+		default:
+			err = fmt.Errorf("未知的配置项")
+		}
+		if err != nil {
+			return nil, &ConfigError{File: path, Line: entry.Line, Msg: fmt.Sprintf("%s: %v", entry.Key, err)}
+		}
+	}
+	for _, pattern := range append(append([]string(nil), policy.Allow...), policy.Deny...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, &ConfigError{File: path, Msg: fmt.Sprintf("无效的程序匹配规则 %q: %v", pattern, err)}
+		}
+	}
+	return policy, nil
+}
+
+// matchProgram 检查程序路径是否匹配规则列表，Windows 上不区分大小写
+func matchProgram(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if runtime.GOOS == "windows" {
+			pattern, path = strings.ToLower(pattern), strings.ToLower(path)
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve 查找程序并按策略检查，返回解析符号链接后的实际路径
+// 查找到的路径和实际路径任一命中禁止列表即拒绝，避免通过允许目录中的符号链接执行被禁止的程序；
+// 执行时使用检查过的实际路径，检查之后替换符号链接也不会改变执行的程序
+func (p *execPolicy) Resolve(program string) (string, error) {
+	path, err := exec.LookPath(program)
+	if err != nil {
+		return "", fmt.Errorf("找不到程序 %s: %v", program, err)
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	if matchProgram(p.Deny, path) || matchProgram(p.Deny, real) {
+		return "", commandErrorf(codeDenied, "程序 %s 在执行策略的禁止列表中", path)
+	}
+	if !matchProgram(p.Allow, path) && !matchProgram(p.Allow, real) {
+		return "", commandErrorf(codeDenied, "程序 %s 不在执行策略的允许列表中", path)
+	}
+	return real, nil
+}
+
+// CheckEnv 检查服务端设置的环境变量是否都在允许列表中
+func (p *execPolicy) CheckEnv(env map[string]string) error {
+	for name := range env {
+		allowed := false
+		for _, e := range p.Env {
+			allowed = allowed || e == name || (runtime.GOOS == "windows" && strings.EqualFold(e, name))
+		}
+		if !allowed {
+			return commandErrorf(codeDenied, "执行策略不允许设置环境变量 %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// checkPolicyFile 检查执行策略文件及其所在目录只能由 root 或运行代理的用户修改
+// 文件或目录属于其他用户、可被组或其他用户写入时，策略可能被替换，拒绝使用
+func checkPolicyFile(path string, info os.FileInfo) error {
+	if err := checkPolicyOwner(path, info); err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	dirInfo, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	return checkPolicyOwner(dir, dirInfo)
+}
+
+// checkPolicyOwner 检查属主为 root 或当前用户，且不能被组或其他用户写入
+func checkPolicyOwner(path string, info os.FileInfo) error {
+	if info.Mode().Perm()&0022 != 0 {
+		return fmt.Errorf("执行策略 %s 可被其他用户修改 (%v)，拒绝使用", path, info.Mode().Perm())
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("无法获取 %s 的属主", path)
+	}
+	if uid := int(stat.Uid); uid != 0 && uid != os.Getuid() {
+		return fmt.Errorf("执行策略 %s 的属主 (uid %d) 不是 root 或运行代理的用户，拒绝使用", path, uid)
+	}
+	return nil
+}
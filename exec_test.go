@@ -0,0 +1,195 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeExecPolicy 在临时目录中创建两个脚本和执行策略：允许 bin 目录下的程序，禁止 denied.sh
+// bin/alias.sh 是指向 denied.sh 的符号链接
+func writeExecPolicy(t *testing.T, extra string) (dir, policyPath string) {
+	t.Helper()
+	dir = t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	os.Mkdir(bin, 0755)
+	for _, name := range []string{"ok.sh", "denied.sh"} {
+		writeTestFile(t, filepath.Join(bin, name), []byte("#!/bin/sh\necho \"$@\" \"$GOAGENT_TEST\"\n"))
+		os.Chmod(filepath.Join(bin, name), 0755)
+	}
+	os.Symlink(filepath.Join(bin, "denied.sh"), filepath.Join(bin, "alias.sh"))
+
+	policyPath = filepath.Join(dir, execPolicyFileName)
+	content := fmt.Sprintf("allow = %q\ndeny = %q\nenv = \"GOAGENT_TEST\"\n%s",
+		filepath.Join(bin, "*"), filepath.Join(bin, "denied.sh"), extra)
+	writeTestFile(t, policyPath, []byte(content))
+	os.Chmod(policyPath, 0644)
+	return dir, policyPath
+}
+
+func TestExecPolicy(t *testing.T) {
+	dir, path := writeExecPolicy(t, "max_timeout = \"10s\"\n")
+	policy, err := loadExecPolicy(path)
+	if err != nil {
+		t.Fatalf("loadExecPolicy: %v", err)
+	}
+	if policy.MaxTimeout != 10*time.Second || policy.MaxOutput != 64*1024 {
+		t.Fatalf("policy = %+v", policy)
+	}
+
+	bin := filepath.Join(dir, "bin")
+	real, _ := filepath.EvalSymlinks(filepath.Join(bin, "ok.sh"))
+	if got, err := policy.Resolve(filepath.Join(bin, "ok.sh")); err != nil || got != real {
+		t.Fatalf("Resolve(ok.sh) = %q, %v", got, err)
+	}
+	// 返回检查过的实际路径，之后替换符号链接不影响执行的程序
+	os.Symlink(filepath.Join(bin, "ok.sh"), filepath.Join(bin, "link.sh"))
+	if got, err := policy.Resolve(filepath.Join(bin, "link.sh")); err != nil || got != real {
+		t.Fatalf("Resolve(link.sh) = %q, %v, want %s", got, err, real)
+	}
+	for _, program := range []string{filepath.Join(bin, "denied.sh"), filepath.Join(bin, "alias.sh"), "sh"} {
+		var cmdErr *commandError
+		if _, err := policy.Resolve(program); !errors.As(err, &cmdErr) || cmdErr.Code != codeDenied {
+			t.Errorf("Resolve(%s): err = %v, want denied", program, err)
+		}
+	}
+	if err := policy.CheckEnv(map[string]string{"GOAGENT_TEST": "1"}); err != nil {
+		t.Errorf("CheckEnv(allowed): %v", err)
+	}
+	if err := policy.CheckEnv(map[string]string{"LD_PRELOAD": "/tmp/x.so"}); err == nil {
+		t.Error("CheckEnv(LD_PRELOAD) passed")
+	}
+
+	// 可被其他用户写入、格式错误或不存在的策略都拒绝执行
+	os.Chmod(path, 0666)
+	if _, err := loadExecPolicy(path); err == nil {
+		t.Error("world-writable policy loaded")
+	}
+	writeTestFile(t, path, []byte("allow = \"/bin/*\"\nshell = true\n"))
+	os.Chmod(path, 0644)
+	if _, err := loadExecPolicy(path); err == nil {
+		t.Error("policy with unknown key loaded")
+	}
+	if _, err := loadExecPolicy(filepath.Join(dir, "missing.toml")); err == nil {
+		t.Error("missing policy loaded")
+	}
+}
+
+func TestExecPolicyOwner(t *testing.T) {
+	dir, path := writeExecPolicy(t, "")
+	if _, err := loadExecPolicy(path); err != nil {
+		t.Fatalf("loadExecPolicy: %v", err)
+	}
+
+	// 所在目录可被其他用户写入时，策略文件可能被替换
+	os.Chmod(dir, 0777)
+	if _, err := loadExecPolicy(path); err == nil || !strings.Contains(err.Error(), dir) {
+		t.Errorf("policy in world-writable directory: err = %v", err)
+	}
+	os.Chmod(dir, 0755)
+
+	if os.Getuid() != 0 {
+		t.Skip("修改属主需要 root 权限")
+	}
+	for _, target := range []string{path, dir} {
+		os.Chown(target, 12345, 12345)
+		if _, err := loadExecPolicy(path); err == nil || !strings.Contains(err.Error(), "uid 12345") {
+			t.Errorf("%s owned by another user: err = %v", target, err)
+		}
+		os.Chown(target, 0, 0)
+	}
+}
+
+func TestRunExec(t *testing.T) {
+	ctx := context.Background()
+	result, err := runExec(ctx, "/bin/sh", []string{"sh", "-c", "echo out; echo err >&2; echo $GOAGENT_TEST; exit 3"}, "",
+		map[string]string{"GOAGENT_TEST": "env-ok"}, 5*time.Second, 1024)
+	var cmdErr *commandError
+	if !errors.As(err, &cmdErr) || cmdErr.Code != codeExitStatus {
+		t.Fatalf("exit 3: err = %v", err)
+	}
+	if result.ExitCode != 3 || result.Stdout != "out\nenv-ok\n" || result.Stderr != "err\n" {
+		t.Fatalf("result = %+v", result)
+	}
+
+	result, err = runExec(ctx, "/bin/sh", []string{"sh", "-c", "head -c 100000 /dev/zero"}, "", nil, 5*time.Second, 1000)
+	if err != nil || len(result.Stdout) != 1000 || !result.StdoutTruncated {
+		t.Fatalf("capped output: len %d truncated %v err %v", len(result.Stdout), result.StdoutTruncated, err)
+	}
+
+	// 只传递 PATH、LANG 和请求中的变量，代理自身的其他环境变量不会泄露给程序
+	t.Setenv("GOAGENT_LEAK", "agent-only")
+	result, err = runExec(ctx, "/bin/sh", []string{"sh", "-c", `echo "$GOAGENT_LEAK|$GOAGENT_TEST|$PATH"`}, "",
+		map[string]string{"GOAGENT_TEST": "env-ok"}, 5*time.Second, 1024)
+	if want := "|env-ok|" + os.Getenv("PATH") + "\n"; err != nil || result.Stdout != want {
+		t.Fatalf("environment: stdout %q, want %q, err %v", result.Stdout, want, err)
+	}
+}
+
+func TestRunExecTimeoutKillsProcessGroup(t *testing.T) {
+	start := time.Now()
+	result, err := runExec(context.Background(), "/bin/sh", []string{"sh", "-c", "sleep 30 & echo $!; wait"}, "", nil, 300*time.Millisecond, 1024)
+	var cmdErr *commandError
+	if !errors.As(err, &cmdErr) || cmdErr.Code != codeTimeout || !result.TimedOut || result.ExitCode != -1 {
+		t.Fatalf("timeout: result = %+v, err = %v", result, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("runExec returned after %v", elapsed)
+	}
+
+	// 后台的 sleep 同属进程组，应一并被终止（可能暂时以僵尸进程存在）
+	pid, _ := strconv.Atoi(strings.TrimSpace(result.Stdout))
+	deadline := time.Now().Add(2 * time.Second)
+	for syscall.Kill(pid, 0) == nil {
+		stat, _ := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+		if fields := strings.Fields(string(stat)); len(fields) > 2 && fields[2] == "Z" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("background process %d survived the timeout", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	dir, path := writeExecPolicy(t, "")
+	standIn, server := newStarStandIn(t)
+	a := newTestAgentService(t, server.URL)
+	config := *a.getConfig()
+	config.ExecPolicyFile = path
+	a.config = &config
+	connectRegistered(t, standIn, a)
+
+	a.handleCommand(signTestCommand(ServerCommand{ID: 1, Command: "exec",
+		Argument: fmt.Sprintf(`{"program":%q,"args":["hello"],"env":{"GOAGENT_TEST":"world"},"workdir":%q}`, filepath.Join(dir, "bin", "ok.sh"), dir)}))
+	a.handleCommand(signTestCommand(ServerCommand{ID: 2, Command: "exec", Argument: `{"program":"sh","args":["-c","id"]}`}))
+
+	// 策略检查在执行阶段进行，被拒绝的指令同样先回复收到确认
+	if len(standIn.replies) != 4 || standIn.replies[0].Status != CommandHandling {
+		t.Fatalf("replies = %+v", standIn.replies)
+	}
+	result := replyResult(t, standIn.replies[1])
+	output, _ := result.Output.(map[string]interface{})
+	if !result.Success || output["stdout"] != "hello world\n" || output["exitCode"] != float64(0) {
+		t.Fatalf("exec result = %+v", result)
+	}
+	if result := replyResult(t, standIn.replies[3]); result.Success || result.Code != codeDenied || result.Output != nil {
+		t.Fatalf("denied exec result = %+v", result)
+	}
+	// 绕过指令分发直接调用时，未经签名校验的指令同样拒绝
+	args := commandArgs{"program": filepath.Join(dir, "bin", "ok.sh")}
+	var cmdErr *commandError
+	if _, err := a.execCommand(context.Background(), args); !errors.As(err, &cmdErr) || cmdErr.Code != codeDenied {
+		t.Fatalf("unverified exec: err = %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// processTree 执行中的程序及其子进程，放在以程序 PID 为组号的独立进程组中
+type processTree struct {
+	cmd *exec.Cmd
+}
+
+// prepare 启动前设置独立进程组
+func (t *processTree) prepare(cmd *exec.Cmd) {
+	t.cmd = cmd
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// attach 启动后的处理，进程组在启动时已建立
+func (t *processTree) attach(cmd *exec.Cmd) error {
+	return nil
+}
+
+// kill 向整个进程组发送 SIGKILL
+func (t *processTree) kill() error {
+	if t.cmd.Process == nil {
+		return nil
+	}
+	if err := syscall.Kill(-t.cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		if err == syscall.ESRCH {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	return nil
+}
+
+// release 终止程序退出后遗留在进程组中的子进程
+// 组内还有进程时组号不会被复用；组内已无进程时 kill 返回 ESRCH，不影响其他进程
+func (t *processTree) release() {
+	t.kill()
+}
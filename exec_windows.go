@@ -0,0 +1,77 @@
+//go:build windows
+
+package main
+
+import (
+	"os/exec"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// processTree 执行中的程序及其子进程，放在关闭时终止所有进程的作业对象中
+type processTree struct {
+	mu  sync.Mutex
+	cmd *exec.Cmd
+	job windows.Handle
+}
+
+// prepare 启动前的处理，作业对象在启动后关联
+func (t *processTree) prepare(cmd *exec.Cmd) {
+	t.cmd = cmd
+}
+
+// attach 创建作业对象并关联已启动的进程，之后创建的子进程自动加入
+func (t *processTree) attach(cmd *exec.Cmd) error {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return err
+	}
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{}
+	info.BasicLimitInformation.LimitFlags = windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE
+	if _, err := windows.SetInformationJobObject(job, windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info))); err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+	defer windows.CloseHandle(process)
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+
+	t.mu.Lock()
+	t.job = job
+	t.mu.Unlock()
+	return nil
+}
+
+// kill 终止作业对象中的所有进程，尚未关联作业对象时只终止程序本身
+func (t *processTree) kill() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.job != 0 {
+		return windows.TerminateJobObject(t.job, 1)
+	}
+	if t.cmd.Process != nil {
+		return t.cmd.Process.Kill()
+	}
+	return nil
+}
+
+// release 关闭作业对象，程序退出后遗留的子进程随之终止
+func (t *processTree) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.job != 0 {
+		windows.CloseHandle(t.job)
+		t.job = 0
+	}
+}
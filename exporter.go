@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exporterRetryInterval 监听失败（如端口被占用）后的重试间隔
+const exporterRetryInterval = 30 * time.Second
+
+// runMetricsExporter 运行本地 HTTP 监听，以 Prometheus 文本格式提供 /metrics
+// network.port 为 0 时不监听，配置变更时重新监听
+func (a *AgentService) runMetricsExporter() {
+	defer a.wg.Done()
+
+	for {
+		config := a.getConfig()
+		if config.ListenPort == 0 {
+			a.stats.clearComponent(componentExporter)
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-a.exporterReset:
+				continue
+			}
+		}
+
+		addr := net.JoinHostPort(config.ListenHost, strconv.Itoa(config.ListenPort))
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			a.stats.setComponent(componentExporter, false)
+			a.logError("❌ 指标接口监听 %s 失败: %v, %v 后重试", addr, err, exporterRetryInterval)
+			select {
+			case <-a.ctx.Done():
+				return
+			case <-a.exporterReset:
+			case <-time.After(exporterRetryInterval):
+			}
+			continue
+		}
+
+		server := &http.Server{Handler: a.exporterHandler(), ReadHeaderTimeout: 10 * time.Second}
+		go server.Serve(listener)
+		a.stats.setComponent(componentExporter, true)
+		a.logger.Printf("📈 指标接口已启动: http://%s/metrics", addr)
+
+		stopped := false
+		select {
+		case <-a.ctx.Done():
+			stopped = true
+		case <-a.exporterReset:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		server.Shutdown(ctx)
+		cancel()
+		a.stats.setComponent(componentExporter, false)
+
+		if stopped {
+			a.logger.Printf("📈 指标接口已停止")
+			return
+		}
+		a.logInfo("📈 指标接口配置已变更，重新监听")
+	}
+}
+
+// exporterHandler 指标接口的 HTTP 路由
+func (a *AgentService) exporterHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		writePrometheusMetrics(&buf, a.getLatestMetrics(), a.stats.snapshot())
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "%s %s\n\n/metrics  Prometheus 指标\n", AppName, Version)
+	})
+	return mux
+}
+
+// promWriter 生成 Prometheus 文本格式
+// 同名指标的样本必须连续输出，HELP/TYPE 只输出一次
+type promWriter struct {
+	buf *bytes.Buffer
+}
+
+// header 输出指标说明和类型
+func (p *promWriter) header(name, kind, help string) {
+	fmt.Fprintf(p.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample 输出一个样本，labels 为成对的标签名和值
+func (p *promWriter) sample(name string, value float64, labels ...string) {
+	p.buf.WriteString(name)
+	if len(labels) > 0 {
+		p.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.buf.WriteByte(',')
+			}
+			fmt.Fprintf(p.buf, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		p.buf.WriteByte('}')
+	}
+	p.buf.WriteByte(' ')
+	p.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	p.buf.WriteByte('\n')
+}
+
+// gauge 输出只有一个样本的指标
+func (p *promWriter) gauge(name, help string, value float64, labels ...string) {
+	p.header(name, "gauge", help)
+	p.sample(name, value, labels...)
+}
+
+// counter 输出只有一个样本的累计指标
+func (p *promWriter) counter(name, help string, value float64) {
+	p.header(name, "counter", help)
+	p.sample(name, value)
+}
+
+// escapeLabelValue 转义标签值中的反斜杠、双引号和换行
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// boolValue 将布尔值转换为 0/1
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writePrometheusMetrics 输出代理自身运行状态和最近一次采集的节点指标
+func writePrometheusMetrics(buf *bytes.Buffer, m *NodeMetrics, stats agentStatsSnapshot) {
+	p := &promWriter{buf: buf}
+	writeAgentMetrics(p, stats)
+	if m != nil {
+		writeNodeMetrics(p, m)
+	}
+}
+
+// writeAgentMetrics 输出代理自身的运行状态
+func writeAgentMetrics(p *promWriter, stats agentStatsSnapshot) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	p.gauge("goagent_build_info", "代理版本信息", 1, "version", Version, "go_version", runtime.Version())
+	p.gauge("goagent_start_time_seconds", "代理启动时间 (Unix 秒)", float64(stats.StartTime.Unix()))
+	p.gauge("goagent_goroutines", "当前 goroutine 数量", float64(runtime.NumGoroutine()))
+	p.gauge("goagent_memory_heap_bytes", "堆内存占用 (字节)", float64(mem.HeapAlloc))
+	p.gauge("goagent_memory_sys_bytes", "从系统申请的内存 (字节)", float64(mem.Sys))
+	p.counter("goagent_gc_total", "GC 次数", float64(mem.NumGC))
+	p.counter("goagent_server_connect_attempts_total", "连接服务端次数", float64(stats.ConnectAttempts))
+	p.counter("goagent_server_connect_failures_total", "连接服务端失败次数", float64(stats.ConnectFailures))
+	p.counter("goagent_server_reconnects_total", "与服务端重新连接的次数", float64(stats.Reconnects))
+
+	var lastReport float64
+	if !stats.LastReport.IsZero() {
+		lastReport = float64(stats.LastReport.Unix())
+	}
+	p.gauge("goagent_last_report_timestamp_seconds", "最近一次状态报告时间 (Unix 秒)，尚未报告时为 0", lastReport)
+
+	p.header("goagent_component_up", "gauge", "组件运行状态，1 为正常")
+	for _, name := range stats.ComponentNames() {
+		p.sample("goagent_component_up", boolValue(stats.Components[name]), "component", name)
+	}
+}
+
+// writeNodeMetrics 输出节点指标
+func writeNodeMetrics(p *promWriter, m *NodeMetrics) {
+	p.gauge("goagent_node_metrics_timestamp_seconds", "节点指标采集时间 (Unix 秒)", float64(m.Time.Unix()))
+
+	p.header("goagent_node_cpu_usage_percent", "gauge", "CPU 使用率 (百分比)")
+	p.sample("goagent_node_cpu_usage_percent", m.CPUUsage, "mode", "total")
+	p.sample("goagent_node_cpu_usage_percent", m.CPUUser, "mode", "user")
+	p.sample("goagent_node_cpu_usage_percent", m.CPUSystem, "mode", "system")
+	p.sample("goagent_node_cpu_usage_percent", m.CPUIOWait, "mode", "iowait")
+
+	p.gauge("goagent_node_memory_total_bytes", "内存总量 (字节)", float64(m.MemoryTotal))
+	p.gauge("goagent_node_memory_used_bytes", "已用内存 (字节)", float64(m.MemoryUsed))
+	p.gauge("goagent_node_memory_available_bytes", "可用内存 (字节)", float64(m.MemoryAvailable))
+	p.gauge("goagent_node_swap_total_bytes", "交换空间总量 (字节)", float64(m.SwapTotal))
+	p.gauge("goagent_node_swap_used_bytes", "已用交换空间 (字节)", float64(m.SwapUsed))
+
+	p.gauge("goagent_node_load1", "1 分钟平均负载", m.Load1)
+	p.gauge("goagent_node_load5", "5 分钟平均负载", m.Load5)
+	p.gauge("goagent_node_load15", "15 分钟平均负载", m.Load15)
+
+	if len(m.Disks) > 0 {
+		fs := func(name, help string, value func(d DiskUsage) float64) {
+			p.header(name, "gauge", help)
+			for _, d := range m.Disks {
+				p.sample(name, value(d), "mount", d.Mount, "device", d.Device, "fstype", d.FSType)
+			}
+		}
+		fs("goagent_node_filesystem_size_bytes", "文件系统容量 (字节)", func(d DiskUsage) float64 { return float64(d.Total) })
+		fs("goagent_node_filesystem_used_bytes", "文件系统已用空间 (字节)", func(d DiskUsage) float64 { return float64(d.Used) })
+		fs("goagent_node_filesystem_free_bytes", "文件系统可用空间 (字节)", func(d DiskUsage) float64 { return float64(d.Free) })
+	}
+
+	if len(m.Network) > 0 {
+		iface := func(name, help string, value func(n NetworkStats) float64) {
+			p.header(name, "gauge", help)
+			for _, n := range m.Network {
+				p.sample(name, value(n), "interface", n.Interface)
+			}
+		}
+		iface("goagent_node_network_receive_bytes_per_second", "网卡接收速率 (字节/秒)", func(n NetworkStats) float64 { return n.RxBytesRate })
+		iface("goagent_node_network_transmit_bytes_per_second", "网卡发送速率 (字节/秒)", func(n NetworkStats) float64 { return n.TxBytesRate })
+		iface("goagent_node_network_receive_packets_per_second", "网卡接收包速率 (包/秒)", func(n NetworkStats) float64 { return n.RxPacketsRate })
+		iface("goagent_node_network_transmit_packets_per_second", "网卡发送包速率 (包/秒)", func(n NetworkStats) float64 { return n.TxPacketsRate })
+		iface("goagent_node_network_errors", "本监控周期内网卡收发错误数", func(n NetworkStats) float64 { return float64(n.RxErrors + n.TxErrors) })
+		iface("goagent_node_network_dropped", "本监控周期内网卡丢包数", func(n NetworkStats) float64 { return float64(n.RxDropped + n.TxDropped) })
+	}
+
+	if len(m.DiskIO) > 0 {
+		disk := func(name, help string, value func(d DiskIOStats) float64) {
+			p.header(name, "gauge", help)
+			for _, d := range m.DiskIO {
+				p.sample(name, value(d), "device", d.Device)
+			}
+		}
+		disk("goagent_node_disk_read_bytes_per_second", "磁盘读取速率 (字节/秒)", func(d DiskIOStats) float64 { return d.ReadBytesRate })
+		disk("goagent_node_disk_write_bytes_per_second", "磁盘写入速率 (字节/秒)", func(d DiskIOStats) float64 { return d.WriteBytesRate })
+		disk("goagent_node_disk_read_iops", "磁盘读 IOPS", func(d DiskIOStats) float64 { return d.ReadIOPS })
+		disk("goagent_node_disk_write_iops", "磁盘写 IOPS", func(d DiskIOStats) float64 { return d.WriteIOPS })
+		disk("goagent_node_disk_utilization_percent", "磁盘忙碌时间占比 (百分比)", func(d DiskIOStats) float64 { return d.Utilization })
+		disk("goagent_node_disk_await_milliseconds", "平均每次 I/O 耗时 (毫秒)", func(d DiskIOStats) float64 { return d.AwaitMillis })
+	}
+
+	if len(m.Pressure) > 0 {
+		name := "goagent_node_pressure_percent"
+		p.header(name, "gauge", "压力阻塞信息 (PSI)，任务因等待资源而停顿的时间占比")
+		for _, ps := range m.Pressure {
+			p.sample(name, ps.SomeAvg10, "resource", ps.Resource, "kind", "some", "window", "10s")
+			p.sample(name, ps.SomeAvg60, "resource", ps.Resource, "kind", "some", "window", "60s")
+			p.sample(name, ps.SomeAvg300, "resource", ps.Resource, "kind", "some", "window", "300s")
+			p.sample(name, ps.FullAvg10, "resource", ps.Resource, "kind", "full", "window", "10s")
+			p.sample(name, ps.FullAvg60, "resource", ps.Resource, "kind", "full", "window", "60s")
+			p.sample(name, ps.FullAvg300, "resource", ps.Resource, "kind", "full", "window", "300s")
+		}
+	}
+
+	if s := m.Sensors; s != nil {
+		writeSensorMetrics(p, s)
+	}
+
+	if m.Processes != nil {
+		p.gauge("goagent_node_processes", "进程总数", float64(m.Processes.Total))
+	}
+}
+
+// writeSensorMetrics 输出温度、风扇、降频和电源指标
+func writeSensorMetrics(p *promWriter, s *SensorStats) {
+	if len(s.Temperatures) > 0 {
+		p.header("goagent_node_temperature_celsius", "gauge", "传感器温度 (摄氏度)")
+		for _, t := range s.Temperatures {
+			p.sample("goagent_node_temperature_celsius", t.Celsius, "source", t.Source, "chip", t.Chip, "label", t.Label)
+		}
+	}
+	if len(s.Fans) > 0 {
+		p.header("goagent_node_fan_rpm", "gauge", "风扇转速 (RPM)")
+		for _, f := range s.Fans {
+			p.sample("goagent_node_fan_rpm", f.RPM, "chip", f.Chip, "label", f.Label)
+		}
+	}
+	if len(s.Cooling) > 0 {
+		p.header("goagent_node_cooling_state", "gauge", "散热设备当前档位，大于 0 表示正在降温")
+		for _, d := range s.Cooling {
+			p.sample("goagent_node_cooling_state", float64(d.CurState), "device", d.Name, "type", d.Type)
+		}
+	}
+	if s.CPUMaxFreqMHz > 0 {
+		p.gauge("goagent_node_cpu_frequency_mhz", "CPU 当前平均频率 (MHz)", s.CPUFreqMHz)
+		p.gauge("goagent_node_cpu_max_frequency_mhz", "CPU 最高频率 (MHz)", s.CPUMaxFreqMHz)
+	}
+	p.gauge("goagent_node_cpu_throttled", "CPU 是否正在过热降频", boolValue(s.Throttling()))
+	p.gauge("goagent_node_cpu_throttle_events", "本监控周期内的降频次数", float64(s.ThrottleEvents))
+
+	if len(s.PowerSupplies) > 0 {
+		p.header("goagent_node_power_supply_online", "gauge", "电源是否在线")
+		for _, ps := range s.PowerSupplies {
+			p.sample("goagent_node_power_supply_online", boolValue(ps.Online), "name", ps.Name, "type", ps.Type)
+		}
+		p.header("goagent_node_power_supply_capacity_percent", "gauge", "电池或 UPS 剩余电量 (百分比)")
+		for _, ps := range s.PowerSupplies {
+			if ps.Capacity >= 0 {
+				p.sample("goagent_node_power_supply_capacity_percent", float64(ps.Capacity), "name", ps.Name, "type", ps.Type)
+			}
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// promSample 解析出的一个样本
+type promSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+var promNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// parseExposition 按 Prometheus 文本格式解析输出并检查格式：
+// 每个指标先输出 HELP 再输出 TYPE，同名样本连续输出，同一指标不能出现两次
+func parseExposition(t *testing.T, text string) []promSample {
+	t.Helper()
+	if !strings.HasSuffix(text, "\n") {
+		t.Fatalf("output does not end with a newline")
+	}
+
+	var samples []promSample
+	families := make(map[string]bool)
+	current, pendingHelp := "", ""
+	for i, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		fail := func(format string, args ...interface{}) {
+			t.Helper()
+			t.Fatalf("line %d %q: %s", i+1, line, fmt.Sprintf(format, args...))
+		}
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+			name, help, _ := strings.Cut(strings.TrimPrefix(line, "# HELP "), " ")
+			if !promNamePattern.MatchString(name) || help == "" || strings.Contains(help, "\n") {
+				fail("invalid HELP")
+			}
+			if families[name] {
+				fail("metric %s repeated", name)
+			}
+			families[name], pendingHelp = true, name
+		case strings.HasPrefix(line, "# TYPE "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# TYPE "))
+			if len(fields) != 2 || fields[0] != pendingHelp || (fields[1] != "gauge" && fields[1] != "counter") {
+				fail("TYPE does not follow HELP of the same metric")
+			}
+			current, pendingHelp = fields[0], ""
+		default:
+			s, err := parsePromSample(line)
+			if err != nil {
+				fail("%v", err)
+			}
+			if s.Name != current || pendingHelp != "" {
+				fail("sample outside metric %s", current)
+			}
+			samples = append(samples, s)
+		}
+	}
+	return samples
+}
+
+// parsePromSample 解析一行样本，还原转义的标签值
+func parsePromSample(line string) (promSample, error) {
+	s := promSample{Labels: make(map[string]string)}
+	end := strings.IndexAny(line, "{ ")
+	if end < 0 {
+		return s, fmt.Errorf("missing value")
+	}
+	s.Name, line = line[:end], line[end:]
+	if !promNamePattern.MatchString(s.Name) {
+		return s, fmt.Errorf("invalid metric name %q", s.Name)
+	}
+
+	if strings.HasPrefix(line, "{") {
+		line = line[1:]
+		for !strings.HasPrefix(line, "}") {
+			name, rest, ok := strings.Cut(line, `="`)
+			if !ok || !promNamePattern.MatchString(name) {
+				return s, fmt.Errorf("invalid label in %q", line)
+			}
+			var value strings.Builder
+			i := 0
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\n' {
+					return s, fmt.Errorf("unescaped newline in label %s", name)
+				}
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+					switch rest[i] {
+					case 'n':
+						value.WriteByte('\n')
+					case '\\', '"':
+						value.WriteByte(rest[i])
+					default:
+						return s, fmt.Errorf("invalid escape \\%c in label %s", rest[i], name)
+					}
+					continue
+				}
+				value.WriteByte(rest[i])
+			}
+			if i == len(rest) {
+				return s, fmt.Errorf("unterminated label %s", name)
+			}
+			if _, dup := s.Labels[name]; dup {
+				return s, fmt.Errorf("duplicate label %s", name)
+			}
+			s.Labels[name] = value.String()
+			line = strings.TrimPrefix(rest[i+1:], ",")
+		}
+		line = line[1:]
+	}
+
+	if !strings.HasPrefix(line, " ") {
+		return s, fmt.Errorf("missing value")
+	}
+	value, err := strconv.ParseFloat(line[1:], 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid value %q", line[1:])
+	}
+	s.Value = value
+	return s, nil
+}
+
+// findSample 查找指标名和标签都匹配的样本
+func findSample(samples []promSample, name string, labels ...string) (promSample, bool) {
+	for _, s := range samples {
+		if s.Name != name {
+			continue
+		}
+		match := true
+		for i := 0; i+1 < len(labels); i += 2 {
+			match = match && s.Labels[labels[i]] == labels[i+1]
+		}
+		if match {
+			return s, true
+		}
+	}
+	return promSample{}, false
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"eth0", "eth0"},
+		{`C:\data`, `C:\\data`},
+		{`say "hi"`, `say \"hi\"`},
+		{"line1\nline2", `line1\nline2`},
+		{"\\\"\n", `\\\"\n`},
+		{"温度 传感器", "温度 传感器"},
+	}
+	for _, tt := range tests {
+		if got := escapeLabelValue(tt.in); got != tt.want {
+			t.Errorf("escapeLabelValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPromWriterSample(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  float64
+		labels []string
+		want   string
+	}{
+		{name: "no labels", value: 42, want: "m 42\n"},
+		{name: "fraction", value: 0.125, labels: []string{"a", "b"}, want: "m{a=\"b\"} 0.125\n"},
+		{name: "large value", value: 3.5e12, want: "m 3.5e+12\n"},
+		{name: "special values", value: math.Inf(1), want: "m +Inf\n"},
+		{name: "not a number", value: math.NaN(), want: "m NaN\n"},
+		{name: "escaped labels", value: 1, labels: []string{"mount", `/mnt/"a"\b`, "label", "x\ny"}, want: "m{mount=\"/mnt/\\\"a\\\"\\\\b\",label=\"x\\ny\"} 1\n"},
+		// 标签名和值不成对时忽略最后一个
+		{name: "odd labels", value: 1, labels: []string{"a", "b", "c"}, want: "m{a=\"b\"} 1\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		p := &promWriter{buf: &buf}
+		p.sample("m", tt.value, tt.labels...)
+		if buf.String() != tt.want {
+			t.Errorf("%s: sample = %q, want %q", tt.name, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestWritePrometheusMetrics(t *testing.T) {
+	stats := agentStatsSnapshot{
+		StartTime:       time.Unix(1760000000, 0),
+		Components:      map[string]bool{componentExporter: true, componentWatcher: false},
+		ConnectAttempts: 3,
+		ConnectFailures: 1,
+	}
+	m := &NodeMetrics{
+		Time:     time.Unix(1760000100, 0),
+		CPUUsage: 37.5, CPUUser: 25, CPUSystem: 10, CPUIOWait: 2.5,
+		MemoryTotal: 4 << 30, MemoryUsed: 1 << 30,
+		Load1: 0.52,
+		Disks: []DiskUsage{
+			{Mount: "/", Device: "/dev/root", FSType: "ext4", Total: 32 << 30, Used: 8 << 30, Free: 24 << 30},
+			// 挂载点中的空格、引号、反斜杠和换行都可能出现
+			{Mount: "/media/usb \"disk\"\\\n", Device: "/dev/sda1", FSType: "vfat", Total: 1 << 30},
+		},
+		Network:  []NetworkStats{{Interface: "eth0", RxBytesRate: 1024, TxBytesRate: 512}, {Interface: "wlan0"}},
+		DiskIO:   []DiskIOStats{{Device: "mmcblk0", ReadIOPS: 12, Utilization: 3.5}},
+		Pressure: []PressureStats{{Resource: "io", SomeAvg10: 12.5, FullAvg300: 2.4}},
+		Sensors: &SensorStats{
+			Temperatures:  []TemperatureSensor{{Source: "thermal", Chip: "cpu-thermal", Label: "cpu", Celsius: 48.7}},
+			PowerSupplies: []PowerSupply{{Name: "AC", Type: "Mains", Online: true, Capacity: -1}, {Name: "BAT0", Type: "Battery", Capacity: 87}},
+		},
+		Processes: &ProcessSnapshot{Total: 123},
+	}
+
+	var buf bytes.Buffer
+	writePrometheusMetrics(&buf, m, stats)
+	samples := parseExposition(t, buf.String())
+
+	tests := []struct {
+		name   string
+		labels []string
+		want   float64
+	}{
+		{"goagent_build_info", []string{"version", Version}, 1},
+		{"goagent_start_time_seconds", nil, 1760000000},
+		{"goagent_server_connect_attempts_total", nil, 3},
+		{"goagent_server_connect_failures_total", nil, 1},
+		{"goagent_last_report_timestamp_seconds", nil, 0},
+		{"goagent_component_up", []string{"component", componentExporter}, 1},
+		{"goagent_component_up", []string{"component", componentWatcher}, 0},
+		{"goagent_node_metrics_timestamp_seconds", nil, 1760000100},
+		{"goagent_node_cpu_usage_percent", []string{"mode", "total"}, 37.5},
+		{"goagent_node_cpu_usage_percent", []string{"mode", "iowait"}, 2.5},
+		{"goagent_node_memory_total_bytes", nil, 4 << 30},
+		{"goagent_node_load1", nil, 0.52},
+		{"goagent_node_filesystem_free_bytes", []string{"mount", "/", "device", "/dev/root", "fstype", "ext4"}, 24 << 30},
+		{"goagent_node_filesystem_size_bytes", []string{"mount", "/media/usb \"disk\"\\\n"}, 1 << 30},
+		{"goagent_node_network_receive_bytes_per_second", []string{"interface", "eth0"}, 1024},
+		{"goagent_node_network_transmit_bytes_per_second", []string{"interface", "wlan0"}, 0},
+		{"goagent_node_disk_utilization_percent", []string{"device", "mmcblk0"}, 3.5},
+		{"goagent_node_pressure_percent", []string{"resource", "io", "kind", "some", "window", "10s"}, 12.5},
+		{"goagent_node_pressure_percent", []string{"resource", "io", "kind", "full", "window", "300s"}, 2.4},
+		{"goagent_node_temperature_celsius", []string{"chip", "cpu-thermal", "label", "cpu"}, 48.7},
+		{"goagent_node_power_supply_online", []string{"name", "AC"}, 1},
+		{"goagent_node_power_supply_capacity_percent", []string{"name", "BAT0"}, 87},
+		{"goagent_node_cpu_throttled", nil, 0},
+		{"goagent_node_processes", nil, 123},
+	}
+	for _, tt := range tests {
+		s, ok := findSample(samples, tt.name, tt.labels...)
+		if !ok {
+			t.Errorf("missing %s%v", tt.name, tt.labels)
+		} else if s.Value != tt.want {
+			t.Errorf("%s%v = %v, want %v", tt.name, tt.labels, s.Value, tt.want)
+		}
+	}
+
+	// 电量未知的电源不输出电量样本；没有风扇和频率信息时不输出对应指标
+	if _, ok := findSample(samples, "goagent_node_power_supply_capacity_percent", "name", "AC"); ok {
+		t.Error("capacity reported for a power supply without a battery")
+	}
+	for _, name := range []string{"goagent_node_fan_rpm", "goagent_node_cpu_frequency_mhz"} {
+		if _, ok := findSample(samples, name); ok {
+			t.Errorf("%s reported without data", name)
+		}
+	}
+
+	// 尚未采集节点指标时只输出代理自身的运行状态
+	buf.Reset()
+	writePrometheusMetrics(&buf, nil, stats)
+	for _, s := range parseExposition(t, buf.String()) {
+		if strings.HasPrefix(s.Name, "goagent_node_") {
+			t.Fatalf("node metric %s reported before the first collection", s.Name)
+		}
+	}
+}
+
+func TestExporterHandler(t *testing.T) {
+	a := &AgentService{stats: newAgentStats()}
+	a.latestMetrics = &NodeMetrics{Time: time.Now(), Disks: []DiskUsage{{Mount: `C:\`, Device: `\\?\Volume{1}`, FSType: "NTFS"}}}
+	server := httptest.NewServer(a.exporterHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	samples := parseExposition(t, body.String())
+	if _, ok := findSample(samples, "goagent_node_filesystem_size_bytes", "mount", `C:\`, "device", `\\?\Volume{1}`); !ok {
+		t.Fatalf("windows volume labels not escaped:\n%s", body.String())
+	}
+
+	resp, err = http.Get(server.URL + "/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("/other: status %d", resp.StatusCode)
+	}
+}
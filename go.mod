@@ -2,4 +2,7 @@ module GoAgent
 
 go 1.25
 
-require golang.org/x/sys v0.35.0 // indirect
+require (
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/sys v0.35.0
+)
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// identityFileName 节点身份状态文件名
+const identityFileName = "identity.json"
+
+// NodeIdentity 持久化的节点身份
+type NodeIdentity struct {
+	NodeID      string    `json:"node_id"`
+	Sources     []string  `json:"sources"`               // 参与生成的硬件标识，如 machine-id、product-uuid、mac
+	Fingerprint []string  `json:"fingerprint,omitempty"` // 硬件指纹，网卡、CPU 序列号、磁盘序列号的摘要
+	ClonedFrom  string    `json:"cloned_from,omitempty"` // 检测到克隆时记录原节点ID
+	CreatedAt   time.Time `json:"created_at"`            // 首次生成时间
+}
+
+// identityStatus 节点身份的获取结果
+type identityStatus int
+
+const (
+	identityLoaded  identityStatus = iota // 沿用已保存的身份
+	identityCreated                       // 首次生成身份
+	identityCloned                        // 硬件指纹不符，判定为克隆设备并生成新身份
+)
+
+// machineIdentifier 一项硬件标识
+type machineIdentifier struct {
+	Name  string
+	Value string
+}
+
+// identityPath 获取节点身份状态文件路径
+func identityPath(dataDir string) string {
+	return filepath.Join(dataDir, identityFileName)
+}
+
+// resolveNodeIdentity 读取已保存的节点身份，不存在时根据硬件标识生成并保存
+// 已保存身份的硬件指纹与本机完全不符时，说明状态文件随系统镜像被复制到了另一台设备，
+// 此时生成新的身份并记录原节点ID
+func resolveNodeIdentity(dataDir string) (*NodeIdentity, identityStatus, error) {
+	return matchNodeIdentity(dataDir, hardwareFingerprint())
+}
+
+// matchNodeIdentity 按本机当前的硬件指纹检查已保存的节点身份
+func matchNodeIdentity(dataDir string, fingerprint []string) (*NodeIdentity, identityStatus, error) {
+	identity, err := loadNodeIdentity(dataDir)
+	if os.IsNotExist(err) {
+		identity = newNodeIdentity("", "", fingerprint)
+		return identity, identityCreated, saveNodeIdentity(dataDir, identity)
+	}
+	if err != nil {
+		return nil, identityLoaded, err
+	}
+
+	switch {
+	case len(fingerprint) == 0:
+		// 无法采集硬件指纹，无从判断
+		return identity, identityLoaded, nil
+	case len(identity.Fingerprint) == 0:
+		// 旧版本生成的身份文件，补充硬件指纹
+		identity.Fingerprint = fingerprint
+		return identity, identityLoaded, saveNodeIdentity(dataDir, identity)
+	case !fingerprintOverlaps(identity.Fingerprint, fingerprint):
+		salt, err := randomSalt()
+		if err != nil {
+			return nil, identityLoaded, err
+		}
+		cloned := newNodeIdentity(salt, "clone", fingerprint)
+		cloned.ClonedFrom = identity.NodeID
+		return cloned, identityCloned, saveNodeIdentity(dataDir, cloned)
+	case !equalStrings(identity.Fingerprint, fingerprint):
+		// 部分硬件变化（如更换网卡、插拔 USB 网卡），仍是同一设备，更新指纹
+		identity.Fingerprint = fingerprint
+		return identity, identityLoaded, saveNodeIdentity(dataDir, identity)
+	default:
+		return identity, identityLoaded, nil
+	}
+}
+
+// resetNodeIdentity 丢弃已保存的节点身份并生成新的身份
+// 加入随机盐值，保证新身份与硬件未变时的原身份不同
+func resetNodeIdentity(dataDir string) (*NodeIdentity, error) {
+	if err := os.Remove(identityPath(dataDir)); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("删除节点身份文件失败: %v", err)
+	}
+
+	salt, err := randomSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	identity := newNodeIdentity(salt, "reset", hardwareFingerprint())
+	if err := saveNodeIdentity(dataDir, identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// randomSalt 生成随机盐值
+func randomSalt() (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %v", err)
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// loadNodeIdentity 读取已保存的节点身份
+func loadNodeIdentity(dataDir string) (*NodeIdentity, error) {
+	data, err := os.ReadFile(identityPath(dataDir))
+	if err != nil {
+		return nil, err
+	}
+
+	var identity NodeIdentity
+	if err := json.Unmarshal(data, &identity); err != nil {
+		return nil, fmt.Errorf("解析节点身份文件失败: %v", err)
+	}
+	if identity.NodeID == "" {
+		return nil, fmt.Errorf("节点身份文件 %s 中缺少 node_id", identityPath(dataDir))
+	}
+	return &identity, nil
+}
+
+// saveNodeIdentity 保存节点身份
+func saveNodeIdentity(dataDir string, identity *NodeIdentity) error {
+	data, err := json.MarshalIndent(identity, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStateFile(identityPath(dataDir), data, 0600)
+}
+
+// newNodeIdentity 根据硬件标识生成节点身份，无可用标识时使用随机值
+// salt 非空时加入随机盐值，并将 reason（reset 或 clone）记入 Sources 说明新身份的来由
+// fingerprint 为本机的硬件指纹，随身份保存用于克隆检测
+func newNodeIdentity(salt, reason string, fingerprint []string) *NodeIdentity {
+	identifiers := machineIdentifiers()
+	if mac := primaryMACAddress(); mac != "" {
+		identifiers = append(identifiers, machineIdentifier{Name: "mac", Value: mac})
+	}
+
+	identity := &NodeIdentity{Fingerprint: fingerprint, CreatedAt: time.Now()}
+	hash := sha256.New()
+	for _, id := range identifiers {
+		fmt.Fprintf(hash, "%s=%s\n", id.Name, id.Value)
+		identity.Sources = append(identity.Sources, id.Name)
+	}
+
+	if len(identifiers) == 0 {
+		random := make([]byte, 16)
+		rand.Read(random)
+		hash.Write(random)
+		identity.Sources = append(identity.Sources, "random")
+	}
+	if salt != "" {
+		fmt.Fprintf(hash, "salt=%s\n", salt)
+		identity.Sources = append(identity.Sources, reason)
+	}
+
+	identity.NodeID = "node-" + hex.EncodeToString(hash.Sum(nil))[:16]
+	return identity
+}
+
+// hardwareFingerprint 采集硬件指纹
+// 各组件以 "类型:摘要" 表示并排序，不保存原始序列号
+func hardwareFingerprint() []string {
+	components := hardwareComponents()
+	for _, mac := range physicalMACAddresses() {
+		components = append(components, machineIdentifier{Name: "mac", Value: mac})
+	}
+
+	fingerprint := make([]string, 0, len(components))
+	for _, c := range components {
+		sum := sha256.Sum256([]byte(c.Value))
+		fingerprint = append(fingerprint, c.Name+":"+hex.EncodeToString(sum[:8]))
+	}
+	sort.Strings(fingerprint)
+	return fingerprint
+}
+
+// fingerprintOverlaps 检查两个硬件指纹是否有共同的组件
+func fingerprintOverlaps(a, b []string) bool {
+	set := make(map[string]bool, len(a))
+	for _, c := range a {
+		set[c] = true
+	}
+	for _, c := range b {
+		if set[c] {
+			return true
+		}
+	}
+	return false
+}
+
+// equalStrings 比较两个字符串切片是否相同
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// physicalMACAddresses 获取所有物理网卡的 MAC 地址
+func physicalMACAddresses() []string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var macs []string
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) != 6 || isVirtualInterface(iface.Name) {
+			continue
+		}
+		// 本地管理地址 (第一个字节第 2 位为 1) 通常是随机生成的，不能作为硬件特征
+		if iface.HardwareAddr[0]&0x02 != 0 {
+			continue
+		}
+		macs = append(macs, iface.HardwareAddr.String())
+	}
+	return macs
+}
+
+// primaryMACAddress 获取主网卡 MAC 地址
+// 选择接口序号最小的物理网卡，跳过回环和常见的虚拟网卡
+func primaryMACAddress() string {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return ""
+	}
+
+	sort.Slice(interfaces, func(i, j int) bool { return interfaces[i].Index < interfaces[j].Index })
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) != 6 {
+			continue
+		}
+		if isVirtualInterface(iface.Name) {
+			continue
+		}
+		return iface.HardwareAddr.String()
+	}
+	return ""
+}
+
+// isVirtualInterface 根据名称判断是否为容器、网桥、隧道等虚拟网卡
+func isVirtualInterface(name string) bool {
+	prefixes := []string{"docker", "veth", "br-", "virbr", "vmnet", "vboxnet", "tun", "tap", "wg", "zt", "cni", "flannel"}
+	lower := strings.ToLower(name)
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// runResetIdentity 处理 reset-identity 命令，用于设备重新部署
+func runResetIdentity() int {
+	loaded, err := loadAgentConfig(commandLineConfig)
+	if err != nil {
+		printConfigErrors(err)
+		return 1
+	}
+
+	dataDir := loaded.Config.DataDir
+	if old, err := loadNodeIdentity(dataDir); err == nil {
+		fmt.Printf("原节点ID: %s\n", old.NodeID)
+	}
+
+	identity, err := resetNodeIdentity(dataDir)
+	if err != nil {
+		fmt.Printf("❌ 重置节点身份失败: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("✅ 新节点ID: %s\n", identity.NodeID)
+	fmt.Printf("   身份文件: %s\n", identityPath(dataDir))
+	if loaded.Origins["node.id"].Source != ConfigSourceDefault {
+		fmt.Printf("⚠️  当前配置显式指定了 node.id (%s)，该设置优先于身份文件\n", loaded.Origins["node.id"])
+	}
+	fmt.Println("💡 如服务正在运行，请重启服务使新身份生效")
+	return 0
+}
@@ -0,0 +1,75 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// machineIdentifiers 获取 Linux 硬件标识：machine-id 与 DMI 产品 UUID
+func machineIdentifiers() []machineIdentifier {
+	var ids []machineIdentifier
+
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if value := readTrimmedFile(path); value != "" {
+			ids = append(ids, machineIdentifier{Name: "machine-id", Value: value})
+			break
+		}
+	}
+
+	// 读取 product_uuid 需要 root 权限，ARM 设备通常没有 DMI 信息
+	if value := readTrimmedFile("/sys/class/dmi/id/product_uuid"); value != "" {
+		ids = append(ids, machineIdentifier{Name: "product-uuid", Value: strings.ToLower(value)})
+	}
+
+	return ids
+}
+
+// readTrimmedFile 读取文件内容并去除首尾空白，失败时返回空字符串
+func readTrimmedFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// hardwareComponents 获取用于克隆检测的硬件组件：CPU 序列号与磁盘序列号
+// 这些信息属于硬件本身，不会随系统镜像复制
+func hardwareComponents() []machineIdentifier {
+	var components []machineIdentifier
+
+	// 树莓派等 ARM 设备在 /proc/cpuinfo 中提供 Serial
+	if data, err := os.ReadFile("/proc/cpuinfo"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok || strings.TrimSpace(key) != "Serial" {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if value != "" && strings.Trim(value, "0") != "" {
+				components = append(components, machineIdentifier{Name: "cpu-serial", Value: value})
+			}
+			break
+		}
+	}
+
+	// 磁盘序列号：SATA/SCSI 为 device/serial，SD/eMMC 为 device/serial 或 device/cid，NVMe 为 device/serial
+	blocks, _ := filepath.Glob("/sys/block/*")
+	for _, block := range blocks {
+		name := filepath.Base(block)
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") || strings.HasPrefix(name, "dm-") {
+			continue
+		}
+		for _, file := range []string{"device/serial", "device/cid", "device/wwid"} {
+			if value := readTrimmedFile(filepath.Join(block, file)); value != "" {
+				components = append(components, machineIdentifier{Name: "disk-serial", Value: value})
+				break
+			}
+		}
+	}
+
+	return components
+}
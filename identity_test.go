@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNodeIdentityPersistence(t *testing.T) {
+	dataDir := t.TempDir()
+	fingerprint := []string{"disk-serial:aaaa", "mac:bbbb"}
+
+	created, status, err := matchNodeIdentity(dataDir, fingerprint)
+	if err != nil || status != identityCreated {
+		t.Fatalf("first run: status %v, err %v", status, err)
+	}
+	if !strings.HasPrefix(created.NodeID, "node-") || len(created.NodeID) != len("node-")+16 || !equalStrings(created.Fingerprint, fingerprint) {
+		t.Fatalf("created identity = %+v", created)
+	}
+
+	// 再次启动时沿用已保存的身份
+	loaded, status, err := matchNodeIdentity(dataDir, fingerprint)
+	if err != nil || status != identityLoaded || loaded.NodeID != created.NodeID || !loaded.CreatedAt.Equal(created.CreatedAt) {
+		t.Fatalf("second run: identity %+v, status %v, err %v", loaded, status, err)
+	}
+
+	// 重置后生成与原身份不同的新身份
+	reset, err := resetNodeIdentity(dataDir)
+	if err != nil || reset.NodeID == created.NodeID || reset.Sources[len(reset.Sources)-1] != "reset" {
+		t.Fatalf("reset identity = %+v, err %v", reset, err)
+	}
+	if saved, err := loadNodeIdentity(dataDir); err != nil || saved.NodeID != reset.NodeID {
+		t.Fatalf("saved after reset = %+v, err %v", saved, err)
+	}
+}
+
+func TestNodeIdentityCorruptFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errMsg  string
+	}{
+		{name: "invalid json", content: "{node_id", errMsg: "解析节点身份文件失败"},
+		{name: "missing node id", content: `{"sources":["machine-id"]}`, errMsg: "缺少 node_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			writeTestFile(t, identityPath(dataDir), []byte(tt.content))
+			// 身份文件损坏时报错，不能悄悄生成新身份覆盖原文件
+			if _, _, err := matchNodeIdentity(dataDir, nil); err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+				t.Fatalf("err = %v, want %q", err, tt.errMsg)
+			}
+			if data, _ := os.ReadFile(identityPath(dataDir)); string(data) != tt.content {
+				t.Fatalf("identity file rewritten: %s", data)
+			}
+		})
+	}
+}
+
+func TestNodeIdentityCloneDetection(t *testing.T) {
+	tests := []struct {
+		name        string
+		saved       []string // 身份文件中记录的硬件指纹
+		current     []string // 本机当前的硬件指纹
+		status      identityStatus
+		fingerprint []string // 检查后保存的硬件指纹
+	}{
+		{name: "same hardware", saved: []string{"disk-serial:aaaa", "mac:bbbb"}, current: []string{"disk-serial:aaaa", "mac:bbbb"},
+			status: identityLoaded, fingerprint: []string{"disk-serial:aaaa", "mac:bbbb"}},
+		{name: "nic replaced", saved: []string{"disk-serial:aaaa", "mac:bbbb"}, current: []string{"disk-serial:aaaa", "mac:cccc"},
+			status: identityLoaded, fingerprint: []string{"disk-serial:aaaa", "mac:cccc"}},
+		{name: "usb nic added", saved: []string{"mac:bbbb"}, current: []string{"mac:bbbb", "mac:dddd"},
+			status: identityLoaded, fingerprint: []string{"mac:bbbb", "mac:dddd"}},
+		{name: "fingerprint unavailable", saved: []string{"mac:bbbb"}, current: nil,
+			status: identityLoaded, fingerprint: []string{"mac:bbbb"}},
+		{name: "identity from old version", saved: nil, current: []string{"mac:bbbb"},
+			status: identityLoaded, fingerprint: []string{"mac:bbbb"}},
+		{name: "image copied to another device", saved: []string{"disk-serial:aaaa", "mac:bbbb"}, current: []string{"disk-serial:eeee", "mac:ffff"},
+			status: identityCloned, fingerprint: []string{"disk-serial:eeee", "mac:ffff"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			original := &NodeIdentity{NodeID: "node-0123456789abcdef", Sources: []string{"machine-id"}, Fingerprint: tt.saved}
+			if err := saveNodeIdentity(dataDir, original); err != nil {
+				t.Fatal(err)
+			}
+
+			identity, status, err := matchNodeIdentity(dataDir, tt.current)
+			if err != nil || status != tt.status {
+				t.Fatalf("status = %v, err = %v, want %v", status, err, tt.status)
+			}
+			saved, err := loadNodeIdentity(dataDir)
+			if err != nil || saved.NodeID != identity.NodeID || !equalStrings(saved.Fingerprint, tt.fingerprint) {
+				t.Fatalf("saved identity = %+v, err %v", saved, err)
+			}
+
+			if tt.status == identityCloned {
+				// 克隆设备生成新身份，并记录原节点ID
+				if identity.NodeID == original.NodeID || identity.ClonedFrom != original.NodeID || saved.ClonedFrom != original.NodeID ||
+					identity.Sources[len(identity.Sources)-1] != "clone" {
+					t.Fatalf("cloned identity = %+v", identity)
+				}
+			} else if identity.NodeID != original.NodeID || identity.ClonedFrom != "" {
+				t.Fatalf("identity = %+v, want %s kept", identity, original.NodeID)
+			}
+		})
+	}
+}
+
+func TestFingerprintOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want bool
+	}{
+		{a: []string{"mac:1", "disk-serial:2"}, b: []string{"disk-serial:2"}, want: true},
+		{a: []string{"mac:1"}, b: []string{"mac:2"}},
+		{a: nil, b: []string{"mac:1"}},
+		{a: nil, b: nil},
+	}
+	for _, tt := range tests {
+		if got := fingerprintOverlaps(tt.a, tt.b); got != tt.want {
+			t.Errorf("fingerprintOverlaps(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"strings"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+// machineIdentifiers 获取 Windows 硬件标识：注册表中的 MachineGuid
+func machineIdentifiers() []machineIdentifier {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return nil
+	}
+	defer key.Close()
+
+	value, _, err := key.GetStringValue("MachineGuid")
+	if err != nil || value == "" {
+		return nil
+	}
+	return []machineIdentifier{{Name: "machine-guid", Value: strings.ToLower(value)}}
+}
+
+// hardwareComponents 获取用于克隆检测的硬件组件，Windows 下仅使用网卡 MAC
+func hardwareComponents() []machineIdentifier {
+	return nil
+}
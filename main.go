@@ -45,6 +45,14 @@ func init() {
 }
 
 func main() {
+	// 提取命令行中的配置参数 (--server-url、--report-interval 等)
+	flags, args, err := parseConfigFlags(os.Args[1:])
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		os.Exit(1)
+	}
+	commandLineConfig = flags
+
 	// 检查是否作为 Windows 服务运行
 	if isRunningAsService() {
 		// 作为 Windows 服务运行
@@ -53,8 +61,8 @@ func main() {
 	}
 
 	// 检查命令行参数
-	if len(os.Args) > 1 {
-		operation := os.Args[1]
+	if len(args) > 0 {
+		operation := args[0]
 
 		// 处理带 - 前缀的命令
 		switch operation {
@@ -72,6 +80,8 @@ func main() {
 			operation = "version"
 		case "-h", "--help":
 			operation = "help"
+		case "--config-test":
+			operation = "config-test"
 		}
 
 		// 检查是否需要管理员权限
@@ -138,6 +148,20 @@ func main() {
 		case "version":
 			showVersion()
 			return
+		case "config":
+			os.Exit(runConfigCommand(args[1:]))
+		case "config-test":
+			os.Exit(runConfigCheck(args[1:]))
+		case "reset-identity":
+			os.Exit(runResetIdentity())
+		case "enroll":
+			os.Exit(runEnrollCommand(args[1:]))
+		case "info":
+			os.Exit(runInfoCommand(args[1:]))
+		case "ps":
+			os.Exit(runPsCommand(args[1:]))
+		case "metrics":
+			os.Exit(runMetricsCommand(args[1:]))
 		case "help":
 			showHelp()
 			return
@@ -186,7 +210,12 @@ func startAgentService() {
 	fmt.Println()
 
 	// 创建并启动代理服务
-	agent := NewAgentService()
+	agent, err := NewAgentService()
+	if err != nil {
+		printConfigErrors(err)
+		fmt.Println("❌ 配置有误，代理服务未启动")
+		os.Exit(1)
+	}
 
 	// 创建信号通道来处理优雅关闭
 	sigChan := make(chan os.Signal, 1)
@@ -257,6 +286,9 @@ func showServiceStatus() {
 		}
 	}
 
+	// 显示服务端连接状态（包括以 -run 方式运行时）
+	showConnectionStatus()
+
 	// 显示可用的操作提示
 	fmt.Println()
 	if status == "未安装" {
@@ -291,6 +323,13 @@ func showHelp() {
 	fmt.Println("  run (-run)        模拟运行模式（非服务）")
 	fmt.Println("  version (-v)      显示版本信息")
 	fmt.Println("  check-admin       检查当前权限状态")
+	fmt.Println("  config check      校验配置文件 (--config-test)")
+	fmt.Println("  config show       显示有效配置及各项来源")
+	fmt.Println("  reset-identity    重置节点身份（重新部署设备时使用）")
+	fmt.Println("  enroll --code <注册码>  使用一次性注册码换取节点密钥")
+	fmt.Println("  info [--json]     显示节点信息（主机、系统、CPU、内存、网卡）")
+	fmt.Println("  ps [--sort cpu|memory|io] [-n 数量]  显示资源占用最高的进程")
+	fmt.Println("  metrics [--since 1h] [--field cpu]   查询本地指标历史 (--fields 列出可查询的指标)")
 	fmt.Println("  help (-h)         显示此帮助信息")
 	fmt.Println()
 	fmt.Println("示例:")
@@ -298,6 +337,10 @@ func showHelp() {
 	fmt.Printf("  %s -status       # 查看服务状态\n", ExecutableName)
 	fmt.Printf("  %s start         # 启动服务\n", ExecutableName)
 	fmt.Printf("  %s -run          # 模拟运行模式\n", ExecutableName)
+	fmt.Printf("  %s config check /etc/goagent/config.toml  # 校验配置文件\n", ExecutableName)
+	fmt.Printf("  %s -run --report-interval 30s  # 覆盖配置运行\n", ExecutableName)
+	fmt.Println()
+	showConfigOverrideHelp()
 	fmt.Println()
 	fmt.Println("交互模式:")
 	fmt.Printf("  %s               # 启动交互式菜单\n", ExecutableName)
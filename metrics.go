@@ -0,0 +1,431 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// NodeMetrics 节点指标快照，每个监控周期生成一次
+type NodeMetrics struct {
+	Time time.Time `json:"time"`
+
+	// CPU 使用率（百分比），为两次采集之间的平均值
+	CPUUsage  float64 `json:"cpu_usage"`
+	CPUUser   float64 `json:"cpu_user"`
+	CPUSystem float64 `json:"cpu_system"`
+	CPUIOWait float64 `json:"cpu_iowait"`
+
+	// 内存（字节）
+	MemoryTotal     int64   `json:"memory_total"`
+	MemoryUsed      int64   `json:"memory_used"`
+	MemoryAvailable int64   `json:"memory_available"`
+	MemoryUsage     float64 `json:"memory_usage"` // 百分比
+	SwapTotal       int64   `json:"swap_total"`
+	SwapUsed        int64   `json:"swap_used"`
+
+	// 系统负载，Windows 下为 0
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+
+	// 文件系统使用情况
+	Disks []DiskUsage `json:"disks"`
+
+	// 网卡流量，首次出现的网卡从下一个周期开始统计
+	Network []NetworkStats `json:"network"`
+
+	// 块设备 I/O，首次出现的设备从下一个周期开始统计
+	DiskIO []DiskIOStats `json:"disk_io"`
+
+	// 压力阻塞信息 (PSI)，内核不支持时为空
+	Pressure []PressureStats `json:"pressure,omitempty"`
+
+	// 温度、风扇、降频和电源信息，没有可用传感器时为空
+	Sensors *SensorStats `json:"sensors,omitempty"`
+
+	// 资源占用最高的进程，未启用进程排行时为空
+	Processes *ProcessSnapshot `json:"processes,omitempty"`
+}
+
+// DiskUsage 文件系统使用情况
+type DiskUsage struct {
+	Mount  string  `json:"mount"`
+	Device string  `json:"device"`
+	FSType string  `json:"fs_type"`
+	Total  int64   `json:"total"`
+	Used   int64   `json:"used"`
+	Free   int64   `json:"free"`  // 普通用户可用空间
+	Usage  float64 `json:"usage"` // 百分比
+}
+
+// NetworkStats 网卡在一个监控周期内的流量统计
+type NetworkStats struct {
+	Interface     string  `json:"interface"`
+	RxBytesRate   float64 `json:"rx_bytes_rate"` // 字节/秒
+	TxBytesRate   float64 `json:"tx_bytes_rate"`
+	RxPacketsRate float64 `json:"rx_packets_rate"` // 包/秒
+	TxPacketsRate float64 `json:"tx_packets_rate"`
+	RxErrors      uint64  `json:"rx_errors"` // 本周期新增
+	TxErrors      uint64  `json:"tx_errors"`
+	RxDropped     uint64  `json:"rx_dropped"`
+	TxDropped     uint64  `json:"tx_dropped"`
+	RxBytesTotal  uint64  `json:"rx_bytes_total"` // 累计值
+	TxBytesTotal  uint64  `json:"tx_bytes_total"`
+}
+
+// DiskIOStats 块设备在一个监控周期内的 I/O 统计
+type DiskIOStats struct {
+	Device         string  `json:"device"`
+	ReadIOPS       float64 `json:"read_iops"`
+	WriteIOPS      float64 `json:"write_iops"`
+	ReadBytesRate  float64 `json:"read_bytes_rate"` // 字节/秒
+	WriteBytesRate float64 `json:"write_bytes_rate"`
+	Utilization    float64 `json:"utilization"` // 设备忙碌时间占比（百分比）
+	AwaitMillis    float64 `json:"await_ms"`    // 平均每次 I/O 耗时（毫秒）
+	InFlight       uint64  `json:"in_flight"`   // 当前未完成的 I/O 数
+}
+
+// PressureStats 单项资源的压力阻塞信息，数值为任务因等待该资源而停顿的时间占比（百分比）
+type PressureStats struct {
+	Resource   string  `json:"resource"` // cpu、memory、io
+	SomeAvg10  float64 `json:"some_avg10"`
+	SomeAvg60  float64 `json:"some_avg60"`
+	SomeAvg300 float64 `json:"some_avg300"`
+	FullAvg10  float64 `json:"full_avg10"` // 所有任务同时停顿，cpu 在旧内核上没有 full
+	FullAvg60  float64 `json:"full_avg60"`
+	FullAvg300 float64 `json:"full_avg300"`
+}
+
+// diskCounters 块设备累计计数
+type diskCounters struct {
+	Reads, ReadSectors, ReadMillis    uint64
+	Writes, WriteSectors, WriteMillis uint64
+	InFlight, IOMillis                uint64
+}
+
+// netCounters 网卡累计计数
+type netCounters struct {
+	RxBytes, RxPackets, RxErrors, RxDropped uint64
+	TxBytes, TxPackets, TxErrors, TxDropped uint64
+}
+
+// cpuTimes CPU 累计时间片，用于计算两次采集之间的使用率
+type cpuTimes struct {
+	User, Nice, System, Idle, IOWait, IRQ, SoftIRQ, Steal uint64
+}
+
+func (t cpuTimes) total() uint64 {
+	return t.User + t.Nice + t.System + t.Idle + t.IOWait + t.IRQ + t.SoftIRQ + t.Steal
+}
+
+func (t cpuTimes) idle() uint64 {
+	return t.Idle + t.IOWait
+}
+
+// MetricsCollector 节点指标采集器，保存上一次采集的累计值用于计算差值
+type MetricsCollector struct {
+	root        SystemRoot
+	counterBits int // 内核累计计数的位数，32 位内核上网卡和块设备计数会在 2^32 处回绕
+	prevCPU     cpuTimes
+	hasCPU      bool
+	prevNet     map[string]netCounters
+	netTime     time.Time
+	prevIO      map[string]diskCounters
+	ioTime      time.Time
+
+	prevThrottle uint64
+	hasThrottle  bool
+
+	topProcesses int
+	processes    *processCollector
+}
+
+// NewMetricsCollector 创建指标采集器，并记录一次 CPU 基准值
+// topProcesses 为进程排行数量，0 表示不采集进程
+func NewMetricsCollector(root SystemRoot, topProcesses int) *MetricsCollector {
+	c := &MetricsCollector{root: root, counterBits: kernelCounterBits(), topProcesses: topProcesses}
+	if times, err := readCPUTimes(root); err == nil {
+		c.prevCPU, c.hasCPU = times, true
+	}
+	if counters, err := readNetCounters(root); err == nil {
+		c.prevNet, c.netTime = counters, time.Now()
+	}
+	if counters, err := readDiskCounters(root); err == nil {
+		c.prevIO, c.ioTime = counters, time.Now()
+	}
+	if topProcesses > 0 {
+		c.processes = newProcessCollector(root)
+	}
+	return c
+}
+
+// Collect 采集一次指标快照，单项采集失败不影响其他指标，错误合并返回
+func (c *MetricsCollector) Collect() (*NodeMetrics, error) {
+	m := &NodeMetrics{Time: time.Now()}
+	var errs []error
+
+	if err := c.collectCPU(m); err != nil {
+		errs = append(errs, fmt.Errorf("CPU: %v", err))
+	}
+	if err := collectMemory(c.root, m); err != nil {
+		errs = append(errs, fmt.Errorf("内存: %v", err))
+	}
+	if err := collectLoad(c.root, m); err != nil {
+		errs = append(errs, fmt.Errorf("负载: %v", err))
+	}
+	if disks, err := collectDiskUsage(c.root); err != nil {
+		errs = append(errs, fmt.Errorf("磁盘: %v", err))
+	} else {
+		m.Disks = disks
+	}
+
+	if err := c.collectNetwork(m); err != nil {
+		errs = append(errs, fmt.Errorf("网络: %v", err))
+	}
+	if err := c.collectDiskIO(m); err != nil {
+		errs = append(errs, fmt.Errorf("磁盘 I/O: %v", err))
+	}
+	// 内核不支持 PSI 时静默跳过
+	m.Pressure = readPressure(c.root)
+	// 传感器因硬件而异，缺失时同样跳过
+	c.collectSensors(m)
+
+	if c.processes != nil {
+		if snapshot, err := c.processes.snapshot(c.topProcesses); err != nil {
+			errs = append(errs, fmt.Errorf("进程: %v", err))
+		} else {
+			m.Processes = snapshot
+		}
+	}
+
+	if len(errs) > 0 {
+		return m, fmt.Errorf("部分指标采集失败: %v", errs)
+	}
+	return m, nil
+}
+
+// collectCPU 根据两次累计时间片的差值计算 CPU 使用率
+func (c *MetricsCollector) collectCPU(m *NodeMetrics) error {
+	times, err := readCPUTimes(c.root)
+	if err != nil {
+		return err
+	}
+
+	prev, hasPrev := c.prevCPU, c.hasCPU
+	c.prevCPU, c.hasCPU = times, true
+	if !hasPrev || times.total() <= prev.total() {
+		return nil
+	}
+
+	total := float64(times.total() - prev.total())
+	percent := func(cur, old uint64) float64 {
+		if cur < old {
+			return 0
+		}
+		return float64(cur-old) / total * 100
+	}
+
+	m.CPUUsage = 100 - percent(times.idle(), prev.idle())
+	m.CPUUser = percent(times.User+times.Nice, prev.User+prev.Nice)
+	m.CPUSystem = percent(times.System+times.IRQ+times.SoftIRQ, prev.System+prev.IRQ+prev.SoftIRQ)
+	m.CPUIOWait = percent(times.IOWait, prev.IOWait)
+	return nil
+}
+
+// collectNetwork 根据两次累计计数的差值计算网卡流量
+// 新出现的网卡只记录基准值，消失的网卡丢弃基准值
+func (c *MetricsCollector) collectNetwork(m *NodeMetrics) error {
+	counters, err := readNetCounters(c.root)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	prev, elapsed := c.prevNet, now.Sub(c.netTime).Seconds()
+	c.prevNet, c.netTime = counters, now
+	if elapsed <= 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cur := counters[name]
+		old, ok := prev[name]
+		if !ok {
+			continue
+		}
+		m.Network = append(m.Network, NetworkStats{
+			Interface:     name,
+			RxBytesRate:   float64(c.delta(cur.RxBytes, old.RxBytes)) / elapsed,
+			TxBytesRate:   float64(c.delta(cur.TxBytes, old.TxBytes)) / elapsed,
+			RxPacketsRate: float64(c.delta(cur.RxPackets, old.RxPackets)) / elapsed,
+			TxPacketsRate: float64(c.delta(cur.TxPackets, old.TxPackets)) / elapsed,
+			RxErrors:      c.delta(cur.RxErrors, old.RxErrors),
+			TxErrors:      c.delta(cur.TxErrors, old.TxErrors),
+			RxDropped:     c.delta(cur.RxDropped, old.RxDropped),
+			TxDropped:     c.delta(cur.TxDropped, old.TxDropped),
+			RxBytesTotal:  cur.RxBytes,
+			TxBytesTotal:  cur.TxBytes,
+		})
+	}
+	return nil
+}
+
+// collectDiskIO 根据两次累计计数的差值计算块设备 I/O
+func (c *MetricsCollector) collectDiskIO(m *NodeMetrics) error {
+	counters, err := readDiskCounters(c.root)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	prev, elapsed := c.prevIO, now.Sub(c.ioTime).Seconds()
+	c.prevIO, c.ioTime = counters, now
+	if elapsed <= 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cur := counters[name]
+		old, ok := prev[name]
+		if !ok {
+			continue
+		}
+
+		reads := c.delta(cur.Reads, old.Reads)
+		writes := c.delta(cur.Writes, old.Writes)
+		stats := DiskIOStats{
+			Device:         name,
+			ReadIOPS:       float64(reads) / elapsed,
+			WriteIOPS:      float64(writes) / elapsed,
+			ReadBytesRate:  float64(c.delta(cur.ReadSectors, old.ReadSectors)) * sectorSize / elapsed,
+			WriteBytesRate: float64(c.delta(cur.WriteSectors, old.WriteSectors)) * sectorSize / elapsed,
+			Utilization:    math.Min(float64(c.delta(cur.IOMillis, old.IOMillis))/(elapsed*1000)*100, 100),
+			InFlight:       cur.InFlight,
+		}
+		if reads+writes > 0 {
+			waited := c.delta(cur.ReadMillis, old.ReadMillis) + c.delta(cur.WriteMillis, old.WriteMillis)
+			stats.AwaitMillis = float64(waited) / float64(reads+writes)
+		}
+		m.DiskIO = append(m.DiskIO, stats)
+	}
+	return nil
+}
+
+// sectorSize /proc/diskstats 中扇区数的单位，与设备实际扇区大小无关
+const sectorSize = 512
+
+// counterDelta 计算累计计数的增量
+// 计数变小说明计数器被重置（如网卡重新创建、驱动重新加载），此时以当前值为增量
+func counterDelta(cur, prev uint64) uint64 {
+	if cur >= prev {
+		return cur - prev
+	}
+	return cur
+}
+
+// wrappingDelta 计算 bits 位计数器的增量，只有确知计数器为 32 位时才把变小视为回绕
+func wrappingDelta(cur, prev uint64, bits int) uint64 {
+	if cur < prev && bits == 32 && prev <= math.MaxUint32 {
+		return cur + (math.MaxUint32 - prev) + 1
+	}
+	return counterDelta(cur, prev)
+}
+
+// delta 计算网卡和块设备累计计数的增量，按内核计数的位数处理回绕
+func (c *MetricsCollector) delta(cur, prev uint64) uint64 {
+	return wrappingDelta(cur, prev, c.counterBits)
+}
+
+// BusiestInterface 获取收发速率之和最高的网卡
+func (m *NodeMetrics) BusiestInterface() *NetworkStats {
+	var busiest *NetworkStats
+	for i := range m.Network {
+		n := &m.Network[i]
+		if busiest == nil || n.RxBytesRate+n.TxBytesRate > busiest.RxBytesRate+busiest.TxBytesRate {
+			busiest = n
+		}
+	}
+	return busiest
+}
+
+// BusiestDisk 获取忙碌时间占比最高的块设备
+func (m *NodeMetrics) BusiestDisk() *DiskIOStats {
+	var busiest *DiskIOStats
+	for i := range m.DiskIO {
+		if busiest == nil || m.DiskIO[i].Utilization > busiest.Utilization {
+			busiest = &m.DiskIO[i]
+		}
+	}
+	return busiest
+}
+
+// PressureOf 获取指定资源的压力信息，不支持时返回 nil
+func (m *NodeMetrics) PressureOf(resource string) *PressureStats {
+	for i := range m.Pressure {
+		if m.Pressure[i].Resource == resource {
+			return &m.Pressure[i]
+		}
+	}
+	return nil
+}
+
+// MaxDiskUsage 获取使用率最高的文件系统
+func (m *NodeMetrics) MaxDiskUsage() *DiskUsage {
+	var max *DiskUsage
+	for i := range m.Disks {
+		if max == nil || m.Disks[i].Usage > max.Usage {
+			max = &m.Disks[i]
+		}
+	}
+	return max
+}
+
+// Summary 指标摘要，用于日志输出
+func (m *NodeMetrics) Summary() string {
+	summary := fmt.Sprintf("CPU=%.1f%%, 内存=%.1f%% (%s/%s), 负载=%.2f/%.2f/%.2f",
+		m.CPUUsage, m.MemoryUsage, formatBytes(m.MemoryUsed), formatBytes(m.MemoryTotal), m.Load1, m.Load5, m.Load15)
+	if disk := m.MaxDiskUsage(); disk != nil {
+		summary += fmt.Sprintf(", 磁盘=%.1f%% (%s)", disk.Usage, disk.Mount)
+	}
+	if d := m.BusiestDisk(); d != nil {
+		summary += fmt.Sprintf(", I/O=%s %.0f%% (await %.1fms)", d.Device, d.Utilization, d.AwaitMillis)
+	}
+	if p := m.PressureOf("io"); p != nil {
+		summary += fmt.Sprintf(", PSI io=%.1f%%", p.SomeAvg10)
+	}
+	if n := m.BusiestInterface(); n != nil {
+		summary += fmt.Sprintf(", 网络=%s ↓%s/s ↑%s/s", n.Interface, formatBytes(int64(n.RxBytesRate)), formatBytes(int64(n.TxBytesRate)))
+	}
+	if m.Sensors != nil {
+		if sensors := m.Sensors.Summary(); sensors != "" {
+			summary += ", " + sensors
+		}
+	}
+	if m.Processes != nil && len(m.Processes.ByCPU) > 0 {
+		p := m.Processes.ByCPU[0]
+		summary += fmt.Sprintf(", 进程=%d (最高 %s[%d] %.1f%%)", m.Processes.Total, p.Name, p.PID, p.CPUPercent)
+	}
+	return summary
+}
+
+// usagePercent 计算使用率百分比
+func usagePercent(used, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(used) / float64(total) * 100
+}
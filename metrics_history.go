@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historyFileName 指标历史文件名，保存在数据目录下，每行一个 JSON 样本
+const historyFileName = "metrics-history.jsonl"
+
+// historyMaxSamples 指标历史最多保留的样本数，避免监控间隔过短时文件无限增长
+const historyMaxSamples = 100000
+
+// MetricSample 一次采集的关键指标，用于历史查询和窗口聚合
+type MetricSample struct {
+	Time   int64              `json:"t"` // Unix 秒
+	Values map[string]float64 `json:"v"`
+}
+
+// metricField 可查询的历史指标
+type metricField struct {
+	Name  string
+	Desc  string
+	Unit  string
+	Value func(m *NodeMetrics) (float64, bool)
+}
+
+// metricFields 历史记录中保存的指标，顺序即显示顺序
+var metricFields = []metricField{
+	{"cpu", "CPU 使用率", "%", func(m *NodeMetrics) (float64, bool) { return m.CPUUsage, true }},
+	{"cpu_iowait", "CPU I/O 等待", "%", func(m *NodeMetrics) (float64, bool) { return m.CPUIOWait, true }},
+	{"memory", "内存使用率", "%", func(m *NodeMetrics) (float64, bool) { return m.MemoryUsage, m.MemoryTotal > 0 }},
+	{"swap", "已用交换空间", "B", func(m *NodeMetrics) (float64, bool) { return float64(m.SwapUsed), m.SwapTotal > 0 }},
+	{"load1", "1 分钟负载", "", func(m *NodeMetrics) (float64, bool) { return m.Load1, true }},
+	{"disk", "最高磁盘使用率", "%", func(m *NodeMetrics) (float64, bool) {
+		if d := m.MaxDiskUsage(); d != nil {
+			return d.Usage, true
+		}
+		return 0, false
+	}},
+	{"disk_util", "最忙磁盘利用率", "%", func(m *NodeMetrics) (float64, bool) {
+		if d := m.BusiestDisk(); d != nil {
+			return d.Utilization, true
+		}
+		return 0, false
+	}},
+	{"net_rx", "网络接收速率", "B/s", func(m *NodeMetrics) (float64, bool) {
+		var total float64
+		for _, n := range m.Network {
+			total += n.RxBytesRate
+		}
+		return total, len(m.Network) > 0
+	}},
+	{"net_tx", "网络发送速率", "B/s", func(m *NodeMetrics) (float64, bool) {
+		var total float64
+		for _, n := range m.Network {
+			total += n.TxBytesRate
+		}
+		return total, len(m.Network) > 0
+	}},
+	{"psi_io", "I/O 压力 (some avg10)", "%", func(m *NodeMetrics) (float64, bool) {
+		if p := m.PressureOf("io"); p != nil {
+			return p.SomeAvg10, true
+		}
+		return 0, false
+	}},
+	{"temperature", "最高温度", "°C", func(m *NodeMetrics) (float64, bool) {
+		if m.Sensors != nil {
+			if t := m.Sensors.MaxTemperature(); t != nil {
+				return t.Celsius, true
+			}
+		}
+		return 0, false
+	}},
+}
+
+// findMetricField 按名称查找历史指标
+func findMetricField(name string) *metricField {
+	for i := range metricFields {
+		if metricFields[i].Name == name {
+			return &metricFields[i]
+		}
+	}
+	return nil
+}
+
+// sampleFromMetrics 从指标快照中提取历史样本
+func sampleFromMetrics(m *NodeMetrics) MetricSample {
+	sample := MetricSample{Time: m.Time.Unix(), Values: make(map[string]float64)}
+	for _, field := range metricFields {
+		if v, ok := field.Value(m); ok {
+			sample.Values[field.Name] = math.Round(v*100) / 100
+		}
+	}
+	return sample
+}
+
+// FieldAggregate 单项指标在一个时间窗口内的聚合值
+type FieldAggregate struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Avg   float64 `json:"avg"`
+	P95   float64 `json:"p95"`
+	Count int     `json:"count"`
+}
+
+// MetricsAggregate 一个时间窗口内所有指标的聚合值
+type MetricsAggregate struct {
+	Start   time.Time                 `json:"start"`
+	End     time.Time                 `json:"end"`
+	Samples int                       `json:"samples"`
+	Fields  map[string]FieldAggregate `json:"fields"`
+}
+
+// aggregateSamples 计算样本窗口内每项指标的最小、最大、平均值和 95 分位数
+func aggregateSamples(samples []MetricSample) *MetricsAggregate {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	values := make(map[string][]float64)
+	for _, s := range samples {
+		for name, v := range s.Values {
+			values[name] = append(values[name], v)
+		}
+	}
+
+	agg := &MetricsAggregate{
+		Start:   time.Unix(samples[0].Time, 0),
+		End:     time.Unix(samples[len(samples)-1].Time, 0),
+		Samples: len(samples),
+		Fields:  make(map[string]FieldAggregate, len(values)),
+	}
+	for name, vs := range values {
+		sort.Float64s(vs)
+		var sum float64
+		for _, v := range vs {
+			sum += v
+		}
+		agg.Fields[name] = FieldAggregate{
+			Min:   vs[0],
+			Max:   vs[len(vs)-1],
+			Avg:   math.Round(sum/float64(len(vs))*100) / 100,
+			P95:   percentile(vs, 95),
+			Count: len(vs),
+		}
+	}
+	return agg
+}
+
+// percentile 计算已排序数据的百分位数（最近秩法）
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Summary 生成聚合摘要
+func (a *MetricsAggregate) Summary() string {
+	var parts []string
+	for _, name := range []string{"cpu", "memory", "disk_util"} {
+		if f, ok := a.Fields[name]; ok {
+			parts = append(parts, fmt.Sprintf("%s avg=%.1f max=%.1f p95=%.1f", name, f.Avg, f.Max, f.P95))
+		}
+	}
+	return fmt.Sprintf("%d 个样本, %s", a.Samples, strings.Join(parts, ", "))
+}
+
+// metricsHistory 指标历史环形缓冲区，按保留时长和最大样本数淘汰旧样本
+// 样本追加写入数据目录下的文件，重启后恢复；文件不可写时只保留在内存中
+type metricsHistory struct {
+	mu        sync.Mutex
+	path      string
+	retention time.Duration
+	samples   []MetricSample
+	file      *os.File
+	appended  int // 上次整理文件后追加的样本数
+}
+
+// openMetricsHistory 打开指标历史，加载文件中仍在保留期内的样本
+func openMetricsHistory(dataDir string, retention time.Duration) (*metricsHistory, error) {
+	h := &metricsHistory{path: filepath.Join(dataDir, historyFileName), retention: retention}
+
+	samples, err := readMetricsHistory(h.path)
+	if err != nil && !os.IsNotExist(err) {
+		return h, err
+	}
+	h.samples = samples
+	h.trim(time.Now())
+
+	// 启动时整理一次，去掉过期样本和损坏的行
+	if err := h.compact(); err != nil {
+		return h, err
+	}
+	return h, nil
+}
+
+// readMetricsHistory 读取历史文件，跳过无法解析的行（如写入中断留下的半行）
+func readMetricsHistory(path string) ([]MetricSample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples []MetricSample
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s MetricSample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil || s.Time == 0 {
+			continue
+		}
+		samples = append(samples, s)
+	}
+	return samples, scanner.Err()
+}
+
+// Add 追加一个样本并淘汰过期样本
+func (h *metricsHistory) Add(sample MetricSample) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.samples = append(h.samples, sample)
+	h.trim(time.Unix(sample.Time, 0))
+
+	if h.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	if _, err := h.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("写入指标历史失败: %v", err)
+	}
+
+	// 追加的样本超过缓冲区的 10% 时重写文件，淘汰已过期的行
+	h.appended++
+	if h.appended > len(h.samples)/10+100 {
+		return h.compact()
+	}
+	return nil
+}
+
+// SetRetention 修改保留时长
+func (h *metricsHistory) SetRetention(retention time.Duration) {
+	h.mu.Lock()
+	h.retention = retention
+	h.trim(time.Now())
+	h.mu.Unlock()
+}
+
+// Since 获取指定时间之后（含）的样本
+func (h *metricsHistory) Since(t time.Time) []MetricSample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return samplesSince(h.samples, t)
+}
+
+// Close 关闭历史文件
+func (h *metricsHistory) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file != nil {
+		h.file.Close()
+		h.file = nil
+	}
+}
+
+// trim 淘汰超出保留时长或最大样本数的旧样本
+func (h *metricsHistory) trim(now time.Time) {
+	cutoff := now.Add(-h.retention).Unix()
+	i := sort.Search(len(h.samples), func(i int) bool { return h.samples[i].Time >= cutoff })
+	if n := len(h.samples) - historyMaxSamples; n > i {
+		i = n
+	}
+	if i > 0 {
+		h.samples = append([]MetricSample(nil), h.samples[i:]...)
+	}
+}
+
+// compact 用内存中的样本重写历史文件，然后继续追加写入
+func (h *metricsHistory) compact() error {
+	if h.file != nil {
+		h.file.Close()
+		h.file = nil
+	}
+
+	var buf bytes.Buffer
+	for _, s := range h.samples {
+		line, err := json.Marshal(s)
+		if err != nil {
+			continue
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := writeStateFile(h.path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("保存指标历史失败: %v", err)
+	}
+
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("打开指标历史失败: %v", err)
+	}
+	h.file = f
+	h.appended = 0
+	return nil
+}
+
+// samplesSince 在按时间排序的样本中获取指定时间之后的部分
+func samplesSince(samples []MetricSample, t time.Time) []MetricSample {
+	i := sort.Search(len(samples), func(i int) bool { return samples[i].Time >= t.Unix() })
+	return samples[i:]
+}
+
+// runMetricsCommand 处理 metrics 命令，查询本地指标历史
+func runMetricsCommand(args []string) int {
+	since, step := time.Hour, time.Duration(0)
+	fields := []string{"cpu", "memory", "load1", "disk_util", "net_rx", "net_tx"}
+	jsonOutput := false
+
+	for i := 0; i < len(args); i++ {
+		value := func() (string, bool) {
+			if i+1 >= len(args) {
+				fmt.Printf("❌ 参数 %s 缺少值\n", args[i])
+				return "", false
+			}
+			i++
+			return args[i], true
+		}
+
+		switch args[i] {
+		case "--since":
+			v, ok := value()
+			if !ok {
+				return 1
+			}
+			d, err := parseConfigDuration(v)
+			if err != nil || d <= 0 {
+				fmt.Printf("❌ 时间范围无效: %s (示例: 30m、6h、2d)\n", v)
+				return 1
+			}
+			since = d
+		case "--step":
+			v, ok := value()
+			if !ok {
+				return 1
+			}
+			d, err := parseConfigDuration(v)
+			if err != nil || d < time.Second {
+				fmt.Printf("❌ 统计间隔无效: %s (不能小于 1s)\n", v)
+				return 1
+			}
+			step = d
+		case "--field":
+			v, ok := value()
+			if !ok {
+				return 1
+			}
+			fields = strings.Split(v, ",")
+			for _, name := range fields {
+				if findMetricField(name) == nil {
+					fmt.Printf("❌ 未知的指标: %s\n", name)
+					showMetricFields()
+					return 1
+				}
+			}
+		case "--json":
+			jsonOutput = true
+		case "--fields":
+			showMetricFields()
+			return 0
+		default:
+			fmt.Printf("未知参数: %s\n", args[i])
+			fmt.Printf("用法: %s metrics [--since 1h] [--field cpu,memory] [--step 5m] [--json] [--fields]\n", ExecutableName)
+			return 1
+		}
+	}
+
+	loaded, err := loadAgentConfig(commandLineConfig)
+	if err != nil {
+		printConfigErrors(err)
+		return 1
+	}
+
+	path := filepath.Join(loaded.Config.DataDir, historyFileName)
+	all, err := readMetricsHistory(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			fmt.Printf("暂无指标历史: %s\n", path)
+			return 1
+		}
+		fmt.Printf("❌ 读取指标历史失败: %v\n", err)
+		return 1
+	}
+
+	samples := samplesSince(all, time.Now().Add(-since))
+	if len(samples) == 0 {
+		fmt.Printf("最近 %v 内没有指标记录\n", since)
+		return 1
+	}
+	if step == 0 {
+		// 默认分为 12 段，至少 1 分钟
+		step = (since / 12).Round(time.Minute)
+		if step < time.Minute {
+			step = time.Minute
+		}
+	}
+
+	total := aggregateSamples(samples)
+	buckets := bucketSamples(samples, step)
+
+	if jsonOutput {
+		data, _ := json.MarshalIndent(struct {
+			Total   *MetricsAggregate   `json:"total"`
+			Buckets []*MetricsAggregate `json:"buckets"`
+		}{total, buckets}, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	}
+
+	fmt.Printf("指标历史: %s ~ %s，共 %d 个样本\n", total.Start.Format("2006-01-02 15:04:05"),
+		total.End.Format("2006-01-02 15:04:05"), total.Samples)
+	for _, name := range fields {
+		field := findMetricField(name)
+		f, ok := total.Fields[name]
+		if !ok {
+			fmt.Printf("\n%s (%s): 无数据\n", field.Desc, name)
+			continue
+		}
+
+		fmt.Printf("\n%s (%s): 最小 %s, 最大 %s, 平均 %s, P95 %s\n", field.Desc, name,
+			field.format(f.Min), field.format(f.Max), field.format(f.Avg), field.format(f.P95))
+		fmt.Printf("  %-11s %12s %12s %12s %12s\n", "时间", "最小", "最大", "平均", "P95")
+		for _, b := range buckets {
+			bf, ok := b.Fields[name]
+			if !ok {
+				continue
+			}
+			fmt.Printf("  %-11s %12s %12s %12s %12s\n", b.Start.Format("01-02 15:04"),
+				field.format(bf.Min), field.format(bf.Max), field.format(bf.Avg), field.format(bf.P95))
+		}
+	}
+	return 0
+}
+
+// bucketSamples 按固定间隔分段聚合，样本时间精确到秒，间隔不足 1 秒时按 1 秒分段
+func bucketSamples(samples []MetricSample, step time.Duration) []*MetricsAggregate {
+	var buckets []*MetricsAggregate
+	width := max(int64(step/time.Second), 1)
+	for start := 0; start < len(samples); {
+		bucket := samples[start].Time / width
+		end := start
+		for end < len(samples) && samples[end].Time/width == bucket {
+			end++
+		}
+		agg := aggregateSamples(samples[start:end])
+		agg.Start = time.Unix(bucket*width, 0)
+		buckets = append(buckets, agg)
+		start = end
+	}
+	return buckets
+}
+
+// format 按单位格式化指标值
+func (f *metricField) format(v float64) string {
+	switch f.Unit {
+	case "B":
+		return formatBytes(int64(v))
+	case "B/s":
+		return formatBytes(int64(v)) + "/s"
+	case "":
+		return fmt.Sprintf("%.2f", v)
+	default:
+		return fmt.Sprintf("%.1f%s", v, f.Unit)
+	}
+}
+
+// showMetricFields 显示可查询的指标
+func showMetricFields() {
+	fmt.Println("可查询的指标:")
+	for _, f := range metricFields {
+		fmt.Printf("  %-12s %s\n", f.Name, f.Desc)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucketSamples(t *testing.T) {
+	samples := []MetricSample{
+		{Time: 100, Values: map[string]float64{"cpu": 10}},
+		{Time: 101, Values: map[string]float64{"cpu": 20}},
+		{Time: 160, Values: map[string]float64{"cpu": 30}},
+	}
+	tests := []struct {
+		step  time.Duration
+		count int
+	}{
+		{time.Minute, 2},
+		{time.Second, 3},
+		{500 * time.Millisecond, 3}, // 不足 1 秒按 1 秒分段
+		{time.Hour, 1},
+	}
+	for _, tt := range tests {
+		buckets := bucketSamples(samples, tt.step)
+		if len(buckets) != tt.count {
+			t.Errorf("step %v: %d buckets, want %d", tt.step, len(buckets), tt.count)
+		}
+	}
+
+	if code := runMetricsCommand([]string{"--step", "500ms"}); code != 1 {
+		t.Errorf("metrics --step 500ms: exit code %d, want 1", code)
+	}
+}
+
+func TestBucketSamplesAggregates(t *testing.T) {
+	// 每 10 秒一个样本，按 1 分钟降采样
+	var samples []MetricSample
+	for i := int64(0); i < 12; i++ {
+		samples = append(samples, MetricSample{Time: 1760000080 + i*10, Values: map[string]float64{"cpu": float64(i + 1)}})
+	}
+	// 最后一个样本缺少 cpu，只计入样本数
+	samples = append(samples, MetricSample{Time: 1760000200, Values: map[string]float64{"memory": 50}})
+
+	buckets := bucketSamples(samples, time.Minute)
+	want := []struct {
+		start   int64
+		samples int
+		cpu     FieldAggregate
+	}{
+		// 分段按间隔对齐到整分钟，第一段只有 2 个样本
+		{1760000040, 2, FieldAggregate{Min: 1, Max: 2, Avg: 1.5, P95: 2, Count: 2}},
+		{1760000100, 6, FieldAggregate{Min: 3, Max: 8, Avg: 5.5, P95: 8, Count: 6}},
+		{1760000160, 5, FieldAggregate{Min: 9, Max: 12, Avg: 10.5, P95: 12, Count: 4}},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("%d buckets, want %d", len(buckets), len(want))
+	}
+	for i, w := range want {
+		b := buckets[i]
+		if b.Start.Unix() != w.start || b.Samples != w.samples || b.Fields["cpu"] != w.cpu {
+			t.Errorf("bucket %d: start %d samples %d cpu %+v, want %d %d %+v", i, b.Start.Unix(), b.Samples, b.Fields["cpu"], w.start, w.samples, w.cpu)
+		}
+	}
+	if m := buckets[2].Fields["memory"]; m.Count != 1 || m.Avg != 50 {
+		t.Errorf("memory in last bucket = %+v", m)
+	}
+	if len(bucketSamples(nil, time.Minute)) != 0 {
+		t.Error("buckets for no samples")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		values []float64
+		p      float64
+		want   float64
+	}{
+		{nil, 95, 0},
+		{[]float64{7}, 95, 7},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 95, 10},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 50, 5},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.values, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.values, tt.p, got, tt.want)
+		}
+	}
+}
+
+// historyTimes 获取样本时间，用于比较
+func historyTimes(samples []MetricSample) string {
+	var times []string
+	for _, s := range samples {
+		times = append(times, fmt.Sprint(s.Time))
+	}
+	return strings.Join(times, ",")
+}
+
+func TestMetricsHistoryRetention(t *testing.T) {
+	dataDir := t.TempDir()
+	now := time.Now().Unix()
+	h, err := openMetricsHistory(dataDir, time.Hour)
+	if err != nil {
+		t.Fatalf("openMetricsHistory: %v", err)
+	}
+
+	// 以最新样本的时间为准淘汰超出保留时长的样本
+	for _, age := range []int64{7200, 3700, 3600, 1800, 60, 0} {
+		if err := h.Add(MetricSample{Time: now - age, Values: map[string]float64{"cpu": float64(age)}}); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	want := fmt.Sprintf("%d,%d,%d,%d", now-3600, now-1800, now-60, now)
+	if got := historyTimes(h.Since(time.Unix(0, 0))); got != want {
+		t.Fatalf("samples = %s, want %s", got, want)
+	}
+	if got := historyTimes(h.Since(time.Unix(now-60, 0))); got != fmt.Sprintf("%d,%d", now-60, now) {
+		t.Fatalf("Since(-1m) = %s", got)
+	}
+
+	// 缩短保留时长后立即淘汰
+	h.SetRetention(10 * time.Minute)
+	if got := historyTimes(h.Since(time.Unix(0, 0))); got != fmt.Sprintf("%d,%d", now-60, now) {
+		t.Fatalf("after SetRetention = %s", got)
+	}
+	h.Close()
+
+	// 重启后从文件恢复：文件中仍有追加时写入的过期行和写入中断留下的半行，加载时跳过并整理文件
+	path := filepath.Join(dataDir, historyFileName)
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"t":` + fmt.Sprint(now+1) + `,"v":{"cpu":`)
+	f.Close()
+	h, err = openMetricsHistory(dataDir, 30*time.Minute)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer h.Close()
+	if got := historyTimes(h.Since(time.Unix(0, 0))); got != fmt.Sprintf("%d,%d,%d", now-1800, now-60, now) {
+		t.Fatalf("after reopen = %s", got)
+	}
+	samples, err := readMetricsHistory(path)
+	if err != nil || historyTimes(samples) != fmt.Sprintf("%d,%d,%d", now-1800, now-60, now) {
+		t.Fatalf("compacted file = %s, err %v", historyTimes(samples), err)
+	}
+	if data, _ := os.ReadFile(path); strings.Count(string(data), "\n") != 3 {
+		t.Fatalf("compacted file:\n%s", data)
+	}
+}
+
+func TestMetricsHistoryMaxSamples(t *testing.T) {
+	// 监控间隔很短时按最大样本数淘汰，即使样本仍在保留期内
+	now := time.Now().Unix()
+	h := &metricsHistory{retention: 365 * 24 * time.Hour}
+	for i := int64(0); i < historyMaxSamples+10; i++ {
+		h.samples = append(h.samples, MetricSample{Time: now - historyMaxSamples - 10 + i})
+	}
+	h.trim(time.Unix(now, 0))
+	if len(h.samples) != historyMaxSamples || h.samples[0].Time != now-historyMaxSamples {
+		t.Fatalf("%d samples, oldest %d", len(h.samples), now-h.samples[0].Time)
+	}
+}
@@ -0,0 +1,278 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// pseudoFileSystems 不统计使用率的虚拟文件系统
+var pseudoFileSystems = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true, "ramfs": true,
+	"cgroup": true, "cgroup2": true, "pstore": true, "securityfs": true, "debugfs": true, "tracefs": true,
+	"configfs": true, "fusectl": true, "mqueue": true, "hugetlbfs": true, "bpf": true, "autofs": true,
+	"binfmt_misc": true, "rpc_pipefs": true, "nsfs": true, "squashfs": true, "efivarfs": true,
+	"selinuxfs": true, "fuse.lxcfs": true, "fuse.gvfsd-fuse": true, "overlay": true, "nfsd": true,
+}
+
+// readCPUTimes 读取 /proc/stat 中汇总的 CPU 时间片
+func readCPUTimes(root SystemRoot) (cpuTimes, error) {
+	f, err := os.Open(root.proc("stat"))
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+
+		values := make([]uint64, 8)
+		for i := 1; i < len(fields) && i <= len(values); i++ {
+			values[i-1], _ = strconv.ParseUint(fields[i], 10, 64)
+		}
+		return cpuTimes{
+			User: values[0], Nice: values[1], System: values[2], Idle: values[3],
+			IOWait: values[4], IRQ: values[5], SoftIRQ: values[6], Steal: values[7],
+		}, nil
+	}
+	return cpuTimes{}, fmt.Errorf("%s 中没有 cpu 汇总行", root.proc("stat"))
+}
+
+// collectMemory 从 /proc/meminfo 采集内存使用情况
+func collectMemory(root SystemRoot, m *NodeMetrics) error {
+	meminfo, err := readMemInfo(root)
+	if err != nil {
+		return err
+	}
+
+	m.MemoryTotal = meminfo["MemTotal"]
+	available, ok := meminfo["MemAvailable"]
+	if !ok {
+		// 3.14 之前的内核没有 MemAvailable
+		available = meminfo["MemFree"] + meminfo["Buffers"] + meminfo["Cached"]
+	}
+	m.MemoryAvailable = available
+	m.MemoryUsed = m.MemoryTotal - available
+	m.MemoryUsage = usagePercent(m.MemoryUsed, m.MemoryTotal)
+
+	m.SwapTotal = meminfo["SwapTotal"]
+	m.SwapUsed = meminfo["SwapTotal"] - meminfo["SwapFree"]
+	return nil
+}
+
+// collectLoad 从 /proc/loadavg 采集系统负载
+func collectLoad(root SystemRoot, m *NodeMetrics) error {
+	data, err := os.ReadFile(root.proc("loadavg"))
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return fmt.Errorf("无法解析 loadavg: %q", string(data))
+	}
+	m.Load1, _ = strconv.ParseFloat(fields[0], 64)
+	m.Load5, _ = strconv.ParseFloat(fields[1], 64)
+	m.Load15, _ = strconv.ParseFloat(fields[2], 64)
+	return nil
+}
+
+// collectDiskUsage 统计 /proc/mounts 中各文件系统的使用情况，同一设备只统计一次
+// /proc/mounts 指向读取进程自身的挂载表，挂载点按代理所在的挂载命名空间解析，不拼接 proc_root 等来源目录；
+// 容器中需要统计宿主机磁盘时，把宿主机的文件系统挂载进容器（如 -v /:/host:ro），按容器内的挂载点统计
+func collectDiskUsage(root SystemRoot) ([]DiskUsage, error) {
+	f, err := os.Open(root.proc("mounts"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var disks []DiskUsage
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		device, mount, fsType := fields[0], unescapeMountPath(fields[1]), fields[2]
+		if pseudoFileSystems[fsType] || seen[device] {
+			continue
+		}
+
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(mount, &stat); err != nil || stat.Blocks == 0 {
+			continue
+		}
+		seen[device] = true
+
+		bsize := int64(stat.Bsize)
+		total := int64(stat.Blocks) * bsize
+		used := (int64(stat.Blocks) - int64(stat.Bfree)) * bsize
+		free := int64(stat.Bavail) * bsize
+		disks = append(disks, DiskUsage{
+			Mount:  mount,
+			Device: device,
+			FSType: fsType,
+			Total:  total,
+			Used:   used,
+			Free:   free,
+			Usage:  usagePercent(used, used+free),
+		})
+	}
+	return disks, scanner.Err()
+}
+
+// unescapeMountPath 还原 /proc/mounts 中转义的空白字符 (\040 等)
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if n, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// kernelCounterBits 内核累计计数的位数
+// 32 位内核上 /proc/net/dev 和 /proc/diskstats 的计数为 unsigned long，会在 2^32 处回绕；
+// 容器中同样适用，内核与宿主机共享。32 位程序运行在 64 位内核上时按内核的位数处理
+func kernelCounterBits() int {
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return 64
+	}
+	machine := unix.ByteSliceToString(uts.Machine[:])
+	if strings.Contains(machine, "64") || machine == "s390x" {
+		return 64
+	}
+	return 32
+}
+
+// readNetCounters 读取 /proc/net/dev 中各网卡的累计计数，忽略回环网卡
+func readNetCounters(root SystemRoot) (map[string]netCounters, error) {
+	f, err := os.Open(root.proc("net", "dev"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	counters := make(map[string]netCounters)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 前两行为表头，数据行格式为 "  eth0: rx_bytes rx_packets rx_errs rx_drop ... tx_bytes tx_packets tx_errs tx_drop ..."
+		name, data, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(data)
+		if name == "lo" || len(fields) < 16 {
+			continue
+		}
+
+		values := make([]uint64, 16)
+		for i := range values {
+			values[i], _ = strconv.ParseUint(fields[i], 10, 64)
+		}
+		counters[name] = netCounters{
+			RxBytes: values[0], RxPackets: values[1], RxErrors: values[2], RxDropped: values[3],
+			TxBytes: values[8], TxPackets: values[9], TxErrors: values[10], TxDropped: values[11],
+		}
+	}
+	return counters, scanner.Err()
+}
+
+// readDiskCounters 读取 /proc/diskstats 中整块设备的累计计数
+// 只统计 /sys/block 下存在的设备，忽略分区、loop 和 ram 设备
+func readDiskCounters(root SystemRoot) (map[string]diskCounters, error) {
+	f, err := os.Open(root.proc("diskstats"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, sysErr := os.Stat(root.sys("block"))
+	counters := make(map[string]diskCounters)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// major minor name reads merged sectors ms writes merged sectors ms in_flight io_ms weighted_ms ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 14 {
+			continue
+		}
+		name := fields[2]
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") {
+			continue
+		}
+		if sysErr == nil {
+			if _, err := os.Stat(root.sys("block", name)); err != nil {
+				continue
+			}
+		}
+
+		values := make([]uint64, 11)
+		for i := range values {
+			values[i], _ = strconv.ParseUint(fields[i+3], 10, 64)
+		}
+		counters[name] = diskCounters{
+			Reads: values[0], ReadSectors: values[2], ReadMillis: values[3],
+			Writes: values[4], WriteSectors: values[6], WriteMillis: values[7],
+			InFlight: values[8], IOMillis: values[9],
+		}
+	}
+	return counters, scanner.Err()
+}
+
+// readPressure 读取 /proc/pressure 下的 PSI 数据
+// 4.20 之前的内核没有 PSI，启动参数 psi=0 时读取会失败，均返回空
+func readPressure(root SystemRoot) []PressureStats {
+	var result []PressureStats
+	for _, resource := range []string{"cpu", "memory", "io"} {
+		data, err := os.ReadFile(root.proc("pressure", resource))
+		if err != nil {
+			continue
+		}
+
+		stats := PressureStats{Resource: resource}
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 4 {
+				continue
+			}
+			avg := make(map[string]float64)
+			for _, field := range fields[1:] {
+				if key, value, ok := strings.Cut(field, "="); ok {
+					avg[key], _ = strconv.ParseFloat(value, 64)
+				}
+			}
+			switch fields[0] {
+			case "some":
+				stats.SomeAvg10, stats.SomeAvg60, stats.SomeAvg300 = avg["avg10"], avg["avg60"], avg["avg300"]
+			case "full":
+				stats.FullAvg10, stats.FullAvg60, stats.FullAvg300 = avg["avg10"], avg["avg60"], avg["avg300"]
+			}
+		}
+		result = append(result, stats)
+	}
+	return result
+}
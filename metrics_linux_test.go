@@ -0,0 +1,296 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeNetDev 写入 /proc/net/dev，counters 为网卡名 -> 收、发字节数
+func writeNetDev(t *testing.T, root SystemRoot, counters map[string][2]uint64) {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("Inter-|   Receive                                                |  Transmit\n")
+	b.WriteString(" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n")
+	for name, c := range counters {
+		fmt.Fprintf(&b, "%6s: %d 10 0 0 0 0 0 0 %d 10 0 0 0 0 0 0\n", name, c[0], c[1])
+	}
+	os.MkdirAll(root.proc("net"), 0755)
+	writeTestFile(t, root.proc("net", "dev"), []byte(b.String()))
+}
+
+func TestCollectNetworkCounters(t *testing.T) {
+	dir := t.TempDir()
+	root := SystemRoot{Proc: filepath.Join(dir, "proc"), Sys: filepath.Join(dir, "sys")}
+	writeNetDev(t, root, map[string][2]uint64{"eth0": {1000, 2000}, "eth1": {math.MaxUint32 - 99, 5000}, "lo": {1, 1}})
+	c := NewMetricsCollector(root, 0)
+
+	tests := []struct {
+		name     string
+		bits     int // 内核计数位数
+		counters map[string][2]uint64
+		want     map[string][2]float64 // 网卡 -> 收、发字节数增量
+	}{
+		{
+			"increase and 32-bit wrap", 32,
+			map[string][2]uint64{"eth0": {1500, 2500}, "eth1": {100, 5000}, "lo": {2, 2}},
+			map[string][2]float64{"eth0": {500, 500}, "eth1": {200, 0}},
+		},
+		{
+			// eth1 消失后不再输出，wlan0 首次出现只记录基准值
+			"interface appears and disappears", 64,
+			map[string][2]uint64{"eth0": {1600, 2600}, "wlan0": {70000, 80000}},
+			map[string][2]float64{"eth0": {100, 100}},
+		},
+		{
+			// eth1 重新出现视为新网卡；64 位内核上 wlan0 计数变小是被重置
+			"interface comes back and counter resets", 64,
+			map[string][2]uint64{"eth0": {1600, 2600}, "eth1": {30, 40}, "wlan0": {50, 60}},
+			map[string][2]float64{"eth0": {0, 0}, "wlan0": {50, 60}},
+		},
+	}
+	for _, tt := range tests {
+		writeNetDev(t, root, tt.counters)
+		c.counterBits = tt.bits
+		c.netTime = time.Now().Add(-time.Second) // 增量按 1 秒计算速率
+		m := &NodeMetrics{}
+		if err := c.collectNetwork(m); err != nil {
+			t.Fatalf("%s: collectNetwork: %v", tt.name, err)
+		}
+		got := make(map[string][2]float64)
+		for _, n := range m.Network {
+			got[n.Interface] = [2]float64{math.Round(n.RxBytesRate), math.Round(n.TxBytesRate)}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: rates = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadCPUTimes(t *testing.T) {
+	times, err := readCPUTimes(testdataRoot)
+	if err != nil {
+		t.Fatalf("readCPUTimes: %v", err)
+	}
+	want := cpuTimes{User: 1030000, Nice: 2000, System: 310000, Idle: 8500000, IOWait: 120000, SoftIRQ: 15000}
+	if times != want {
+		t.Fatalf("times = %+v, want %+v", times, want)
+	}
+
+	dir := t.TempDir()
+	root := SystemRoot{Proc: dir}
+	writeTestFile(t, root.proc("stat"), []byte("cpu0 1 2 3 4 5\nbtime 1\n"))
+	if _, err := readCPUTimes(root); err == nil {
+		t.Error("stat without cpu summary parsed")
+	}
+}
+
+func TestCollectCPU(t *testing.T) {
+	root := SystemRoot{Proc: t.TempDir()}
+	c := &MetricsCollector{root: root}
+
+	tests := []struct {
+		name                    string
+		stat                    string
+		usage, user, system, io float64
+	}{
+		{name: "baseline", stat: "cpu  100 0 100 700 100 0 0 0\n"},
+		// 1000 个时间片中 idle 600、iowait 100：使用率 30%，其中用户态 20%、内核态 (含中断) 10%
+		{name: "busy", stat: "cpu  250 50 150 1300 200 25 25 0\n", usage: 30, user: 20, system: 10, io: 10},
+		// 计数回退（如虚拟机迁移）时只更新基准值
+		{name: "counter went back", stat: "cpu  10 0 10 70 10 0 0 0\n"},
+		{name: "after going back", stat: "cpu  60 0 10 120 10 0 0 0\n", usage: 50, user: 50},
+	}
+	for _, tt := range tests {
+		writeTestFile(t, root.proc("stat"), []byte(tt.stat))
+		m := &NodeMetrics{}
+		if err := c.collectCPU(m); err != nil {
+			t.Fatalf("%s: collectCPU: %v", tt.name, err)
+		}
+		got := [4]float64{m.CPUUsage, m.CPUUser, m.CPUSystem, m.CPUIOWait}
+		for i := range got {
+			got[i] = math.Round(got[i]*100) / 100
+		}
+		if want := [4]float64{tt.usage, tt.user, tt.system, tt.io}; got != want {
+			t.Errorf("%s: usage/user/system/iowait = %v, want %v", tt.name, got, want)
+		}
+	}
+}
+
+func TestCollectMemory(t *testing.T) {
+	m := &NodeMetrics{}
+	if err := collectMemory(testdataRoot, m); err != nil {
+		t.Fatalf("collectMemory: %v", err)
+	}
+	if m.MemoryTotal != 3884180*1024 || m.MemoryAvailable != 2811220*1024 || m.MemoryUsed != (3884180-2811220)*1024 {
+		t.Fatalf("memory = %d/%d/%d", m.MemoryTotal, m.MemoryAvailable, m.MemoryUsed)
+	}
+	if math.Abs(m.MemoryUsage-27.62) > 0.01 || m.SwapTotal != 102396*1024 || m.SwapUsed != (102396-81916)*1024 {
+		t.Fatalf("usage %.2f swap %d/%d", m.MemoryUsage, m.SwapUsed, m.SwapTotal)
+	}
+
+	// 旧内核没有 MemAvailable，按 MemFree + Buffers + Cached 估算
+	root := SystemRoot{Proc: t.TempDir()}
+	writeTestFile(t, root.proc("meminfo"), []byte("MemTotal: 1000 kB\nMemFree: 100 kB\nBuffers: 50 kB\nCached: 250 kB\n"))
+	m = &NodeMetrics{}
+	if err := collectMemory(root, m); err != nil || m.MemoryAvailable != 400*1024 || m.MemoryUsage != 60 {
+		t.Fatalf("without MemAvailable: available %d usage %v err %v", m.MemoryAvailable, m.MemoryUsage, err)
+	}
+}
+
+func TestCollectLoad(t *testing.T) {
+	m := &NodeMetrics{}
+	if err := collectLoad(testdataRoot, m); err != nil || m.Load1 != 0.52 || m.Load5 != 0.58 || m.Load15 != 0.59 {
+		t.Fatalf("load = %v %v %v, err %v", m.Load1, m.Load5, m.Load15, err)
+	}
+
+	root := SystemRoot{Proc: t.TempDir()}
+	writeTestFile(t, root.proc("loadavg"), []byte("0.52\n"))
+	if err := collectLoad(root, &NodeMetrics{}); err == nil {
+		t.Error("truncated loadavg parsed")
+	}
+}
+
+func TestCollectDiskUsage(t *testing.T) {
+	// 挂载点按代理自身的挂载命名空间统计：样例中只有 / 在本机存在，
+	// 虚拟文件系统和同一设备的其他挂载点跳过，不存在的挂载点忽略
+	disks, err := collectDiskUsage(testdataRoot)
+	if err != nil {
+		t.Fatalf("collectDiskUsage: %v", err)
+	}
+	if len(disks) != 1 {
+		t.Fatalf("disks = %+v", disks)
+	}
+	d := disks[0]
+	if d.Mount != "/" || d.Device != "/dev/root" || d.FSType != "ext4" || d.Total <= 0 || d.Used+d.Free > d.Total || d.Usage < 0 || d.Usage > 100 {
+		t.Fatalf("disk = %+v", d)
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	tests := map[string]string{
+		"/":                  "/",
+		`/media/usb\040disk`: "/media/usb disk",
+		`/mnt/tab\011here`:   "/mnt/tab\there",
+		`/mnt/back\134slash`: `/mnt/back\slash`,
+		`/mnt/not\escaped`:   `/mnt/not\escaped`,
+		`/mnt/trailing\04`:   `/mnt/trailing\04`,
+	}
+	for in, want := range tests {
+		if got := unescapeMountPath(in); got != want {
+			t.Errorf("unescapeMountPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestReadDiskCounters(t *testing.T) {
+	counters, err := readDiskCounters(testdataRoot)
+	if err != nil {
+		t.Fatalf("readDiskCounters: %v", err)
+	}
+	// 只保留 /sys/block 下的整块设备：分区、loop、ram、zram 和字段不全的行都跳过；
+	// sda 为 4.18 之前内核的 14 列格式
+	want := map[string]diskCounters{
+		"mmcblk0": {Reads: 48230, ReadSectors: 3562018, ReadMillis: 60233, Writes: 91520, WriteSectors: 4101232, WriteMillis: 982140, IOMillis: 331020},
+		"sda":     {Reads: 1200, ReadSectors: 98304, ReadMillis: 2400, Writes: 600, WriteSectors: 40960, WriteMillis: 3600, InFlight: 2, IOMillis: 5000},
+	}
+	if fmt.Sprint(counters) != fmt.Sprint(want) {
+		t.Fatalf("counters = %+v\nwant %+v", counters, want)
+	}
+
+	// 没有 /sys/block 时无法区分分区，除 loop、ram、zram 外全部保留
+	root := SystemRoot{Proc: testdataRoot.Proc, Sys: filepath.Join(t.TempDir(), "missing")}
+	counters, err = readDiskCounters(root)
+	if err != nil {
+		t.Fatalf("readDiskCounters without sysfs: %v", err)
+	}
+	var names []string
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "mmcblk0,mmcblk0p1,mmcblk0p2,sda,sda1" {
+		t.Fatalf("devices without sysfs = %s", got)
+	}
+}
+
+func TestCollectDiskIO(t *testing.T) {
+	dir := t.TempDir()
+	root := SystemRoot{Proc: filepath.Join(dir, "proc"), Sys: filepath.Join(dir, "sys")}
+	os.MkdirAll(filepath.Join(root.sys("block", "sda")), 0755)
+	os.MkdirAll(root.proc(), 0755)
+	c := &MetricsCollector{root: root, counterBits: 64}
+
+	tests := []struct {
+		name      string
+		diskstats string
+		want      []DiskIOStats
+	}{
+		{name: "baseline", diskstats: "8 0 sda 100 0 1000 50 200 0 2000 150 1 300 0\n"},
+		{
+			// 1 秒内读写各 100 次、各 1MB，设备忙碌 500ms，平均每次 I/O 耗时 (100+200)/200 ms
+			name:      "busy",
+			diskstats: "8 0 sda 200 0 3048 150 300 0 4048 350 3 800 0\n",
+			want:      []DiskIOStats{{Device: "sda", ReadIOPS: 100, WriteIOPS: 100, ReadBytesRate: 1 << 20, WriteBytesRate: 1 << 20, Utilization: 50, AwaitMillis: 1.5, InFlight: 3}},
+		},
+		{
+			// 驱动重新加载后计数从 0 开始，按重置处理而不是产生巨大的增量
+			name:      "counters reset",
+			diskstats: "8 0 sda 10 0 2048 10 0 0 0 0 0 100 0\n",
+			want:      []DiskIOStats{{Device: "sda", ReadIOPS: 10, ReadBytesRate: 1 << 20, Utilization: 10, AwaitMillis: 1}},
+		},
+		{name: "idle", diskstats: "8 0 sda 10 0 2048 10 0 0 0 0 0 100 0\n", want: []DiskIOStats{{Device: "sda"}}},
+	}
+	for _, tt := range tests {
+		writeTestFile(t, root.proc("diskstats"), []byte(tt.diskstats))
+		c.ioTime = time.Now().Add(-time.Second) // 增量按 1 秒计算速率
+		m := &NodeMetrics{}
+		if err := c.collectDiskIO(m); err != nil {
+			t.Fatalf("%s: collectDiskIO: %v", tt.name, err)
+		}
+		if len(m.DiskIO) != len(tt.want) {
+			t.Fatalf("%s: disk io = %+v", tt.name, m.DiskIO)
+		}
+		for i, got := range m.DiskIO {
+			want := tt.want[i]
+			// 速率按实际经过的时间计算，允许 1% 的误差
+			near := func(a, b float64) bool { return math.Abs(a-b) <= math.Max(math.Abs(b)*0.01, 0.01) }
+			if got.Device != want.Device || got.InFlight != want.InFlight || got.AwaitMillis != want.AwaitMillis ||
+				!near(got.ReadIOPS, want.ReadIOPS) || !near(got.WriteIOPS, want.WriteIOPS) ||
+				!near(got.ReadBytesRate, want.ReadBytesRate) || !near(got.WriteBytesRate, want.WriteBytesRate) ||
+				!near(got.Utilization, want.Utilization) {
+				t.Errorf("%s: stats = %+v, want %+v", tt.name, got, want)
+			}
+		}
+	}
+}
+
+func TestReadPressure(t *testing.T) {
+	// 旧内核的 cpu 只有 some 行，full 保持为 0
+	want := []PressureStats{
+		{Resource: "cpu", SomeAvg10: 1.53, SomeAvg60: 0.87, SomeAvg300: 0.42},
+		{Resource: "memory", SomeAvg60: 0.12, SomeAvg300: 0.05, FullAvg60: 0.04, FullAvg300: 0.01},
+		{Resource: "io", SomeAvg10: 12.5, SomeAvg60: 8.25, SomeAvg300: 3.1, FullAvg10: 10, FullAvg60: 6.75, FullAvg300: 2.4},
+	}
+	if got := readPressure(testdataRoot); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("pressure = %+v\nwant %+v", got, want)
+	}
+
+	// 内核不支持 PSI 时返回空，单项缺失时只跳过该项
+	root := SystemRoot{Proc: t.TempDir()}
+	if got := readPressure(root); got != nil {
+		t.Fatalf("pressure without psi = %+v", got)
+	}
+	os.MkdirAll(root.proc("pressure"), 0755)
+	writeTestFile(t, root.proc("pressure", "io"), []byte("some avg10=1.00 avg60=2.00 avg300=3.00 total=1\nfull garbage\n"))
+	if got := readPressure(root); len(got) != 1 || got[0] != (PressureStats{Resource: "io", SomeAvg10: 1, SomeAvg60: 2, SomeAvg300: 3}) {
+		t.Fatalf("partial pressure = %+v", got)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCounterDelta(t *testing.T) {
+	tests := []struct {
+		name      string
+		cur, prev uint64
+		bits      int
+		want      uint64
+	}{
+		{"increase", 1500, 1000, 64, 500},
+		{"unchanged", 1000, 1000, 32, 0},
+		{"reset on 64-bit kernel", 500, 1000000, 64, 500},
+		{"reset after 64-bit counter passed 2^32", 500, math.MaxUint32 + 1000, 64, 500},
+		{"32-bit wrap", 99, math.MaxUint32 - 100, 32, 200},
+		{"32-bit wrap from max", 0, math.MaxUint32, 32, 1},
+		{"value above 2^32 on 32-bit kernel is a reset", 10, math.MaxUint32 + 1, 32, 10},
+	}
+	for _, tt := range tests {
+		if got := wrappingDelta(tt.cur, tt.prev, tt.bits); got != tt.want {
+			t.Errorf("%s: wrappingDelta(%d, %d, %d) = %d, want %d", tt.name, tt.cur, tt.prev, tt.bits, got, tt.want)
+		}
+	}
+
+	if got := counterDelta(500, 1000000); got != 500 {
+		t.Errorf("counterDelta(500, 1000000) = %d, want 500", got)
+	}
+}
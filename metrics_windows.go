@@ -0,0 +1,151 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	procGetSystemTimes      = kernel32.NewProc("GetSystemTimes")
+	procGetLogicalDrives    = kernel32.NewProc("GetLogicalDrives")
+	procGetDriveTypeW       = kernel32.NewProc("GetDriveTypeW")
+	procGetDiskFreeSpaceExW = kernel32.NewProc("GetDiskFreeSpaceExW")
+)
+
+// DRIVE_FIXED 本地固定磁盘
+const driveFixed = 3
+
+// readCPUTimes 通过 GetSystemTimes 读取 CPU 时间片
+// 内核时间包含空闲时间，需要扣除
+func readCPUTimes(root SystemRoot) (cpuTimes, error) {
+	var idle, kernel, user syscall.Filetime
+	ret, _, err := procGetSystemTimes.Call(
+		uintptr(unsafe.Pointer(&idle)),
+		uintptr(unsafe.Pointer(&kernel)),
+		uintptr(unsafe.Pointer(&user)))
+	if ret == 0 {
+		return cpuTimes{}, fmt.Errorf("GetSystemTimes 失败: %v", err)
+	}
+
+	toTicks := func(ft syscall.Filetime) uint64 {
+		return uint64(ft.HighDateTime)<<32 | uint64(ft.LowDateTime)
+	}
+	return cpuTimes{
+		User:   toTicks(user),
+		System: toTicks(kernel) - toTicks(idle),
+		Idle:   toTicks(idle),
+	}, nil
+}
+
+// collectMemory 通过 GlobalMemoryStatusEx 采集内存使用情况
+func collectMemory(root SystemRoot, m *NodeMetrics) error {
+	status := memoryStatusEx{Length: uint32(unsafe.Sizeof(memoryStatusEx{}))}
+	ret, _, err := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status)))
+	if ret == 0 {
+		return fmt.Errorf("GlobalMemoryStatusEx 失败: %v", err)
+	}
+
+	m.MemoryTotal = int64(status.TotalPhys)
+	m.MemoryAvailable = int64(status.AvailPhys)
+	m.MemoryUsed = m.MemoryTotal - m.MemoryAvailable
+	m.MemoryUsage = usagePercent(m.MemoryUsed, m.MemoryTotal)
+
+	// 页面文件总量包含物理内存
+	m.SwapTotal = int64(status.TotalPageFile - status.TotalPhys)
+	m.SwapUsed = int64(status.TotalPageFile-status.AvailPageFile) - m.MemoryUsed
+	if m.SwapUsed < 0 {
+		m.SwapUsed = 0
+	}
+	return nil
+}
+
+// collectLoad Windows 没有系统负载概念，保持为 0
+func collectLoad(root SystemRoot, m *NodeMetrics) error {
+	return nil
+}
+
+// collectDiskUsage 统计所有本地固定磁盘的使用情况
+func collectDiskUsage(root SystemRoot) ([]DiskUsage, error) {
+	mask, _, err := procGetLogicalDrives.Call()
+	if mask == 0 {
+		return nil, fmt.Errorf("GetLogicalDrives 失败: %v", err)
+	}
+
+	var disks []DiskUsage
+	for i := 0; i < 26; i++ {
+		if mask&(1<<uint(i)) == 0 {
+			continue
+		}
+		drive := string(rune('A'+i)) + `:\`
+		path, _ := syscall.UTF16PtrFromString(drive)
+		if t, _, _ := procGetDriveTypeW.Call(uintptr(unsafe.Pointer(path))); t != driveFixed {
+			continue
+		}
+
+		var free, total, totalFree uint64
+		ret, _, _ := procGetDiskFreeSpaceExW.Call(
+			uintptr(unsafe.Pointer(path)),
+			uintptr(unsafe.Pointer(&free)),
+			uintptr(unsafe.Pointer(&total)),
+			uintptr(unsafe.Pointer(&totalFree)))
+		if ret == 0 || total == 0 {
+			continue
+		}
+
+		used := int64(total - totalFree)
+		disks = append(disks, DiskUsage{
+			Mount:  drive,
+			Device: drive,
+			Total:  int64(total),
+			Used:   used,
+			Free:   int64(free),
+			Usage:  usagePercent(used, used+int64(free)),
+		})
+	}
+	return disks, nil
+}
+
+// kernelCounterBits GetIfEntry2Ex 返回的计数均为 64 位
+func kernelCounterBits() int {
+	return 64
+}
+
+// readNetCounters 通过 GetIfEntry2Ex 读取各网卡的累计计数，忽略回环网卡
+func readNetCounters(root SystemRoot) (map[string]netCounters, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	counters := make(map[string]netCounters)
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		row := windows.MibIfRow2{InterfaceIndex: uint32(iface.Index)}
+		if err := windows.GetIfEntry2Ex(windows.MibIfEntryNormal, &row); err != nil {
+			continue
+		}
+		counters[iface.Name] = netCounters{
+			RxBytes: row.InOctets, RxPackets: row.InUcastPkts + row.InNUcastPkts, RxErrors: row.InErrors, RxDropped: row.InDiscards,
+			TxBytes: row.OutOctets, TxPackets: row.OutUcastPkts + row.OutNUcastPkts, TxErrors: row.OutErrors, TxDropped: row.OutDiscards,
+		}
+	}
+	return counters, nil
+}
+
+// readDiskCounters Windows 下暂不采集块设备 I/O
+func readDiskCounters(root SystemRoot) (map[string]diskCounters, error) {
+	return nil, nil
+}
+
+// readPressure Windows 没有 PSI
+func readPressure(root SystemRoot) []PressureStats {
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// NodeInfo 节点静态信息，登录时上报给服务端
+type NodeInfo struct {
+	Hostname      string          `json:"hostname"`
+	OSName        string          `json:"os_name"`    // 发行版名称，如 Ubuntu 22.04.4 LTS
+	OSVersion     string          `json:"os_version"` // 发行版版本号
+	KernelVersion string          `json:"kernel_version"`
+	Arch          string          `json:"arch"`
+	CPUModel      string          `json:"cpu_model"`
+	CPUCores      int             `json:"cpu_cores"`    // 逻辑核心数
+	TotalMemory   int64           `json:"total_memory"` // 字节
+	Interfaces    []InterfaceInfo `json:"interfaces"`
+	BootTime      time.Time       `json:"boot_time"`
+	Timezone      string          `json:"timezone"`
+	AgentVersion  string          `json:"agent_version"`
+}
+
+// InterfaceInfo 网卡信息
+type InterfaceInfo struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac"`
+	Addrs []string `json:"addrs"` // CIDR 格式的 IP 地址
+	Up    bool     `json:"up"`
+}
+
+// SystemRoot 系统信息的来源目录
+// 默认指向本机的 /proc、/sys、/etc，容器中运行时可指向挂载的宿主机目录，测试时可指向样例目录树
+type SystemRoot struct {
+	Proc string
+	Sys  string
+	Etc  string
+}
+
+// systemRootFromConfig 根据配置获取系统信息来源目录
+func systemRootFromConfig(c *AgentConfig) SystemRoot {
+	return SystemRoot{Proc: c.ProcRoot, Sys: c.SysRoot, Etc: c.EtcRoot}
+}
+
+func (r SystemRoot) proc(elem ...string) string {
+	return filepath.Join(append([]string{r.Proc}, elem...)...)
+}
+
+func (r SystemRoot) sys(elem ...string) string {
+	return filepath.Join(append([]string{r.Sys}, elem...)...)
+}
+
+func (r SystemRoot) etc(elem ...string) string {
+	return filepath.Join(append([]string{r.Etc}, elem...)...)
+}
+
+// collectNodeInfo 采集节点静态信息，单项采集失败时留空
+func collectNodeInfo(root SystemRoot) *NodeInfo {
+	info := &NodeInfo{
+		Arch:         runtime.GOARCH,
+		CPUCores:     runtime.NumCPU(),
+		AgentVersion: Version,
+	}
+
+	info.Hostname, _ = os.Hostname()
+	info.Timezone, _ = time.Now().Zone()
+	info.Interfaces = collectInterfaces()
+
+	// 平台相关信息覆盖上面的通用值
+	collectPlatformInfo(root, info)
+	return info
+}
+
+// collectInterfaces 获取除回环外的所有网卡及其地址
+func collectInterfaces() []InterfaceInfo {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var result []InterfaceInfo
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		info := InterfaceInfo{
+			Name: iface.Name,
+			MAC:  iface.HardwareAddr.String(),
+			Up:   iface.Flags&net.FlagUp != 0,
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				info.Addrs = append(info.Addrs, addr.String())
+			}
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// runInfoCommand 处理 info 命令，显示节点信息
+func runInfoCommand(args []string) int {
+	asJSON := false
+	for _, arg := range args {
+		switch arg {
+		case "--json", "-json":
+			asJSON = true
+		default:
+			fmt.Printf("未知参数: %s\n", arg)
+			return 1
+		}
+	}
+
+	loaded, err := loadAgentConfig(commandLineConfig)
+	if err != nil {
+		printConfigErrors(err)
+		return 1
+	}
+	info := collectNodeInfo(systemRootFromConfig(loaded.Config))
+
+	if asJSON {
+		data, _ := json.MarshalIndent(info, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	}
+
+	fmt.Println("节点信息:")
+	fmt.Println("==============")
+	fmt.Printf("   主机名: %s\n", info.Hostname)
+	fmt.Printf("   操作系统: %s\n", valueOrUnknown(info.OSName))
+	fmt.Printf("   内核版本: %s\n", valueOrUnknown(info.KernelVersion))
+	fmt.Printf("   架构: %s\n", info.Arch)
+	fmt.Printf("   CPU: %s (%d 核)\n", valueOrUnknown(info.CPUModel), info.CPUCores)
+	fmt.Printf("   内存: %s\n", formatBytes(info.TotalMemory))
+	if !info.BootTime.IsZero() {
+		fmt.Printf("   启动时间: %s (已运行 %s)\n", info.BootTime.Format("2006-01-02 15:04:05"), time.Since(info.BootTime).Truncate(time.Minute))
+	}
+	fmt.Printf("   时区: %s\n", valueOrUnknown(info.Timezone))
+	fmt.Printf("   代理版本: %s\n", info.AgentVersion)
+
+	fmt.Println("   网卡:")
+	for _, iface := range info.Interfaces {
+		state := "down"
+		if iface.Up {
+			state = "up"
+		}
+		fmt.Printf("     %-12s %-18s %-4s %s\n", iface.Name, iface.MAC, state, strings.Join(iface.Addrs, ", "))
+	}
+	return 0
+}
+
+// valueOrUnknown 空值显示为"未知"
+func valueOrUnknown(s string) string {
+	if s == "" {
+		return "未知"
+	}
+	return s
+}
+
+// formatBytes 以 KB/MB/GB 为单位格式化字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit && exp < 4; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTP"[exp])
+}
@@ -0,0 +1,170 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// collectPlatformInfo 从 procfs、sysfs 和 /etc 采集 Linux 节点信息
+func collectPlatformInfo(root SystemRoot, info *NodeInfo) {
+	if hostname := readTrimmedFile(root.proc("sys", "kernel", "hostname")); hostname != "" {
+		info.Hostname = hostname
+	}
+	info.KernelVersion = readTrimmedFile(root.proc("sys", "kernel", "osrelease"))
+
+	osRelease := readOSRelease(root)
+	info.OSName = osRelease["PRETTY_NAME"]
+	if info.OSName == "" {
+		info.OSName = strings.TrimSpace(osRelease["NAME"] + " " + osRelease["VERSION"])
+	}
+	info.OSVersion = osRelease["VERSION_ID"]
+
+	if model, cores := readCPUInfo(root); cores > 0 {
+		info.CPUModel = model
+		info.CPUCores = cores
+	}
+
+	if meminfo, err := readMemInfo(root); err == nil {
+		info.TotalMemory = meminfo["MemTotal"]
+	}
+
+	if btime := readBootTime(root); btime > 0 {
+		info.BootTime = time.Unix(btime, 0)
+	}
+
+	if tz := readTimezone(root); tz != "" {
+		info.Timezone = tz
+	}
+}
+
+// readOSRelease 解析 os-release 文件
+func readOSRelease(root SystemRoot) map[string]string {
+	values := make(map[string]string)
+	for _, path := range []string{root.etc("os-release"), filepath.Join(root.Etc, "..", "usr", "lib", "os-release")} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+			if !ok || strings.HasPrefix(key, "#") {
+				continue
+			}
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			} else {
+				value = strings.Trim(value, `"'`)
+			}
+			values[key] = value
+		}
+		f.Close()
+		break
+	}
+	return values
+}
+
+// readCPUInfo 从 /proc/cpuinfo 获取 CPU 型号和逻辑核心数
+// 不同架构的型号字段不同：x86 为 model name，ARM 为 Model 或 Hardware，MIPS 为 cpu model，RISC-V 为 uarch
+func readCPUInfo(root SystemRoot) (string, int) {
+	f, err := os.Open(root.proc("cpuinfo"))
+	if err != nil {
+		return "", 0
+	}
+	defer f.Close()
+
+	fields := make(map[string]string)
+	cores := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if key == "processor" {
+			cores++
+			continue
+		}
+		if _, exists := fields[key]; !exists && value != "" {
+			fields[key] = value
+		}
+	}
+
+	for _, key := range []string{"model name", "Model", "Hardware", "cpu model", "uarch", "isa"} {
+		if model := fields[key]; model != "" {
+			return model, cores
+		}
+	}
+	return "", cores
+}
+
+// readMemInfo 解析 /proc/meminfo，数值单位转换为字节
+func readMemInfo(root SystemRoot) (map[string]int64, error) {
+	f, err := os.Open(root.proc("meminfo"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		values[key] = n
+	}
+	return values, scanner.Err()
+}
+
+// readBootTime 从 /proc/stat 的 btime 获取系统启动时间（Unix 秒）
+func readBootTime(root SystemRoot) int64 {
+	f, err := os.Open(root.proc("stat"))
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "btime" {
+			btime, _ := strconv.ParseInt(fields[1], 10, 64)
+			return btime
+		}
+	}
+	return 0
+}
+
+// readTimezone 获取时区名称，优先使用 /etc/timezone，其次解析 /etc/localtime 链接
+func readTimezone(root SystemRoot) string {
+	if tz := readTrimmedFile(root.etc("timezone")); tz != "" {
+		return tz
+	}
+	if target, err := os.Readlink(root.etc("localtime")); err == nil {
+		if _, name, ok := strings.Cut(target, "zoneinfo/"); ok {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testdataRoot testdata 下的样例系统目录树
+var testdataRoot = SystemRoot{Proc: "testdata/proc", Sys: "testdata/sys", Etc: "testdata/etc"}
+
+func TestCollectPlatformInfo(t *testing.T) {
+	info := &NodeInfo{}
+	collectPlatformInfo(testdataRoot, info)
+
+	tests := []struct {
+		field     string
+		got, want interface{}
+	}{
+		{"Hostname", info.Hostname, "gw-test-01"},
+		{"KernelVersion", info.KernelVersion, "5.15.0-1049-raspi"},
+		{"OSName", info.OSName, "Ubuntu 22.04.4 LTS"},
+		{"OSVersion", info.OSVersion, "22.04"},
+		{"CPUModel", info.CPUModel, "Raspberry Pi 4 Model B Rev 1.4"},
+		{"CPUCores", info.CPUCores, 4},
+		{"TotalMemory", info.TotalMemory, int64(3884180 * 1024)},
+		{"BootTime", info.BootTime, time.Unix(1760000000, 0)},
+		{"Timezone", info.Timezone, "Asia/Shanghai"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.field, tt.got, tt.want)
+		}
+	}
+}
+
+func TestReadCPUInfoModelFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		cpuinfo string
+		model   string
+		cores   int
+	}{
+		{"x86", "processor\t: 0\nmodel name\t: Intel(R) Celeron(R) J4125 CPU @ 2.00GHz\n\nprocessor\t: 1\nmodel name\t: Intel(R) Celeron(R) J4125 CPU @ 2.00GHz\n",
+			"Intel(R) Celeron(R) J4125 CPU @ 2.00GHz", 2},
+		{"arm without model", "processor\t: 0\nBogoMIPS\t: 38.40\n\nHardware\t: Allwinner sun8i Family\n", "Allwinner sun8i Family", 1},
+		{"mips", "system type\t\t: MediaTek MT7621 ver:1 eco:3\nprocessor\t\t: 0\ncpu model\t\t: MIPS 1004Kc V2.15\n", "MIPS 1004Kc V2.15", 1},
+		{"riscv", "processor\t: 0\nhart\t\t: 0\nisa\t\t: rv64imafdc\nuarch\t\t: sifive,u74-mc\n", "sifive,u74-mc", 1},
+		{"empty", "", "", 0},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeTestFile(t, filepath.Join(dir, "cpuinfo"), []byte(tt.cpuinfo))
+		model, cores := readCPUInfo(SystemRoot{Proc: dir})
+		if model != tt.model || cores != tt.cores {
+			t.Errorf("%s: readCPUInfo = %q, %d, want %q, %d", tt.name, model, cores, tt.model, tt.cores)
+		}
+	}
+}
+
+func TestReadOSReleaseFallback(t *testing.T) {
+	// /etc/os-release 不存在时读取 /usr/lib/os-release
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "etc"), 0755)
+	os.MkdirAll(filepath.Join(dir, "usr", "lib"), 0755)
+	writeTestFile(t, filepath.Join(dir, "usr", "lib", "os-release"), []byte("NAME='Debian GNU/Linux'\nVERSION=\"12 (bookworm)\"\n"))
+
+	info := &NodeInfo{}
+	collectPlatformInfo(SystemRoot{Proc: filepath.Join(dir, "proc"), Etc: filepath.Join(dir, "etc")}, info)
+	if info.OSName != "Debian GNU/Linux 12 (bookworm)" {
+		t.Errorf("OSName = %q", info.OSName)
+	}
+}
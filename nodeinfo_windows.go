@@ -0,0 +1,58 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	procGlobalMemoryStatusEx = kernel32.NewProc("GlobalMemoryStatusEx")
+	procGetTickCount64       = kernel32.NewProc("GetTickCount64")
+)
+
+// memoryStatusEx 对应 Windows MEMORYSTATUSEX 结构
+type memoryStatusEx struct {
+	Length               uint32
+	MemoryLoad           uint32
+	TotalPhys            uint64
+	AvailPhys            uint64
+	TotalPageFile        uint64
+	AvailPageFile        uint64
+	TotalVirtual         uint64
+	AvailVirtual         uint64
+	AvailExtendedVirtual uint64
+}
+
+// collectPlatformInfo 从注册表和系统 API 采集 Windows 节点信息，root 在 Windows 下不使用
+func collectPlatformInfo(root SystemRoot, info *NodeInfo) {
+	if key, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, registry.QUERY_VALUE); err == nil {
+		info.OSName, _, _ = key.GetStringValue("ProductName")
+		info.OSVersion, _, _ = key.GetStringValue("DisplayVersion")
+		if build, _, err := key.GetStringValue("CurrentBuild"); err == nil {
+			info.KernelVersion = build
+			if ubr, _, err := key.GetIntegerValue("UBR"); err == nil {
+				info.KernelVersion = fmt.Sprintf("%s.%d", build, ubr)
+			}
+		}
+		key.Close()
+	}
+
+	if key, err := registry.OpenKey(registry.LOCAL_MACHINE, `HARDWARE\DESCRIPTION\System\CentralProcessor\0`, registry.QUERY_VALUE); err == nil {
+		info.CPUModel, _, _ = key.GetStringValue("ProcessorNameString")
+		key.Close()
+	}
+
+	status := memoryStatusEx{Length: uint32(unsafe.Sizeof(memoryStatusEx{}))}
+	if ret, _, _ := procGlobalMemoryStatusEx.Call(uintptr(unsafe.Pointer(&status))); ret != 0 {
+		info.TotalMemory = int64(status.TotalPhys)
+	}
+
+	if uptime, _, _ := procGetTickCount64.Call(); uptime != 0 {
+		info.BootTime = time.Now().Add(-time.Duration(uptime) * time.Millisecond).Truncate(time.Second)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// outboxDirName 离线队列目录，位于数据目录下，每条消息一个文件
+const outboxDirName = "outbox"
+
+// 离线消息类型
+const (
+	outboxReport = "report" // 状态报告
+	outboxEvent  = "event"  // 节点事件
+)
+
+// QueueItem 离线队列中的一条消息
+type QueueItem struct {
+	Seq     uint64          `json:"seq"`
+	Kind    string          `json:"kind"`
+	Time    time.Time       `json:"time"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// outboxEntry 队列索引，消息内容只在发送时读取
+type outboxEntry struct {
+	seq  uint64
+	size int64
+	time time.Time
+}
+
+// outbox 磁盘离线队列，服务端不可达时缓存待发送的报告和事件
+// 每条消息原子地写入一个以序号命名的文件，断电或崩溃后重新扫描目录即可恢复，按序号顺序重放；
+// 超出容量或保留时长时优先丢弃最旧的消息
+type outbox struct {
+	mu      sync.Mutex
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	entries []outboxEntry // 按序号排序
+	size    int64
+	nextSeq uint64
+}
+
+// openOutbox 打开离线队列，加载目录中已有的消息
+func openOutbox(dir string, maxSize int64, maxAge time.Duration) (*outbox, error) {
+	q := &outbox{dir: dir, maxSize: maxSize, maxAge: maxAge, nextSeq: 1}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return q, fmt.Errorf("创建离线队列目录失败: %v", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return q, fmt.Errorf("读取离线队列失败: %v", err)
+	}
+	for _, f := range files {
+		name := f.Name()
+		// 写入中断留下的临时文件
+		if strings.HasPrefix(name, ".") {
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, ".json"), 10, 64)
+		if err != nil || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		q.entries = append(q.entries, outboxEntry{seq: seq, size: info.Size(), time: info.ModTime()})
+		q.size += info.Size()
+	}
+	sort.Slice(q.entries, func(i, j int) bool { return q.entries[i].seq < q.entries[j].seq })
+	if n := len(q.entries); n > 0 {
+		q.nextSeq = q.entries[n-1].seq + 1
+	}
+	q.enforce(time.Now())
+	return q, nil
+}
+
+// itemPath 消息文件路径，序号补零保证文件名顺序与序号一致
+func (q *outbox) itemPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d.json", seq))
+}
+
+// Push 追加一条消息，返回因超出配额而丢弃的旧消息数
+func (q *outbox) Push(kind string, payload interface{}) (int, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	item := QueueItem{Seq: q.nextSeq, Kind: kind, Time: now, Payload: raw}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return 0, err
+	}
+	if err := writeStateFile(q.itemPath(item.Seq), data, 0600); err != nil {
+		return 0, fmt.Errorf("写入离线队列失败: %v", err)
+	}
+
+	q.nextSeq++
+	q.entries = append(q.entries, outboxEntry{seq: item.Seq, size: int64(len(data)), time: now})
+	q.size += int64(len(data))
+	return q.enforce(now), nil
+}
+
+// Peek 按顺序读取最旧的 n 条消息，无法解析的消息直接删除
+func (q *outbox) Peek(n int) []QueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var items []QueueItem
+	for i := 0; i < len(q.entries) && len(items) < n; {
+		e := q.entries[i]
+		var item QueueItem
+		data, err := os.ReadFile(q.itemPath(e.seq))
+		if err == nil {
+			err = json.Unmarshal(data, &item)
+		}
+		if err != nil {
+			q.removeAt(i)
+			continue
+		}
+		items = append(items, item)
+		i++
+	}
+	return items
+}
+
+// Remove 删除已发送的消息
+func (q *outbox) Remove(items []QueueItem) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	sent := make(map[uint64]bool, len(items))
+	for _, item := range items {
+		sent[item.Seq] = true
+	}
+	for i := 0; i < len(q.entries); {
+		if sent[q.entries[i].seq] {
+			q.removeAt(i)
+			continue
+		}
+		i++
+	}
+}
+
+// Len 队列中的消息数和占用空间
+func (q *outbox) Len() (int, int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries), q.size
+}
+
+// SetQuota 修改容量和保留时长，返回因此丢弃的消息数
+func (q *outbox) SetQuota(maxSize int64, maxAge time.Duration) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.maxSize, q.maxAge = maxSize, maxAge
+	return q.enforce(time.Now())
+}
+
+// enforce 从最旧的消息开始丢弃，直到满足容量和保留时长
+func (q *outbox) enforce(now time.Time) int {
+	dropped := 0
+	for len(q.entries) > 0 {
+		oldest := q.entries[0]
+		if q.size <= q.maxSize && now.Sub(oldest.time) <= q.maxAge {
+			break
+		}
+		q.removeAt(0)
+		dropped++
+	}
+	return dropped
+}
+
+// removeAt 删除第 i 条消息及其文件
+func (q *outbox) removeAt(i int) {
+	e := q.entries[i]
+	os.Remove(q.itemPath(e.seq))
+	q.size -= e.size
+	q.entries = append(q.entries[:i], q.entries[i+1:]...)
+}
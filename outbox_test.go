@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func pushEvents(t *testing.T, q *outbox, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, err := q.Push(outboxEvent, NodeEvent{Name: name}); err != nil {
+			t.Fatalf("Push(%s): %v", name, err)
+		}
+	}
+}
+
+func eventNames(t *testing.T, items []QueueItem) []string {
+	t.Helper()
+	var names []string
+	for _, item := range items {
+		var e NodeEvent
+		if err := json.Unmarshal(item.Payload, &e); err != nil {
+			t.Fatalf("decode payload: %v", err)
+		}
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestOutboxReplayInOrderAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	q, err := openOutbox(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("openOutbox: %v", err)
+	}
+	pushEvents(t, q, "a", "b", "c")
+
+	// 模拟写入过程中断电留下的临时文件
+	os.WriteFile(filepath.Join(dir, ".00000000000000000004.json.tmp123"), []byte(`{"seq":4`), 0600)
+
+	q, err = openOutbox(dir, 1024*1024, time.Hour)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	pushEvents(t, q, "d")
+
+	items := q.Peek(10)
+	if got := eventNames(t, items); len(got) != 4 || got[0] != "a" || got[3] != "d" {
+		t.Fatalf("replay order = %v, want [a b c d]", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".00000000000000000004.json.tmp123")); !os.IsNotExist(err) {
+		t.Fatal("leftover temp file was not cleaned up")
+	}
+
+	q.Remove(items[:2])
+	if got := eventNames(t, q.Peek(10)); len(got) != 2 || got[0] != "c" {
+		t.Fatalf("after Remove = %v, want [c d]", got)
+	}
+}
+
+func TestOutboxDropsOldestOverSizeQuota(t *testing.T) {
+	q, _ := openOutbox(t.TempDir(), 1024*1024, time.Hour)
+	pushEvents(t, q, "a")
+	_, itemSize := q.Len()
+
+	// 容量只够保留两条
+	q.SetQuota(itemSize*2+itemSize/2, time.Hour)
+	pushEvents(t, q, "b", "c", "d")
+
+	if got := eventNames(t, q.Peek(10)); len(got) != 2 || got[0] != "c" || got[1] != "d" {
+		t.Fatalf("after size quota = %v, want [c d]", got)
+	}
+}
+
+func TestOutboxDropsExpired(t *testing.T) {
+	dir := t.TempDir()
+	q, _ := openOutbox(dir, 1024*1024, time.Hour)
+	pushEvents(t, q, "old", "new")
+
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(q.itemPath(1), old, old)
+
+	q, _ = openOutbox(dir, 1024*1024, time.Hour)
+	if got := eventNames(t, q.Peek(10)); len(got) != 1 || got[0] != "new" {
+		t.Fatalf("after age quota = %v, want [new]", got)
+	}
+}
+
+func TestOutboxSkipsCorruptItems(t *testing.T) {
+	dir := t.TempDir()
+	q, _ := openOutbox(dir, 1024*1024, time.Hour)
+	pushEvents(t, q, "a", "b")
+	os.WriteFile(q.itemPath(1), []byte("{broken"), 0600)
+
+	if got := eventNames(t, q.Peek(10)); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("Peek = %v, want [b]", got)
+	}
+	if count, _ := q.Len(); count != 1 {
+		t.Fatalf("Len = %d, want 1", count)
+	}
+}
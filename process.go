@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProcessInfo 进程信息
+type ProcessInfo struct {
+	PID            int       `json:"pid"`
+	PPID           int       `json:"ppid"`
+	Name           string    `json:"name"`
+	Cmdline        string    `json:"cmdline"`
+	User           string    `json:"user"`
+	State          string    `json:"state"`
+	Threads        int       `json:"threads"`
+	StartTime      time.Time `json:"start_time"`
+	CPUPercent     float64   `json:"cpu_percent"` // 100 表示占满一个核心
+	RSS            int64     `json:"rss"`         // 常驻内存（字节）
+	MemoryPercent  float64   `json:"memory_percent"`
+	ReadBytesRate  float64   `json:"read_bytes_rate"` // 磁盘读写（字节/秒），需要 root 权限才能读取其他用户的进程
+	WriteBytesRate float64   `json:"write_bytes_rate"`
+}
+
+// ProcessSnapshot 按 CPU、内存、I/O 分别排序的进程排行
+type ProcessSnapshot struct {
+	Total    int           `json:"total"`
+	ByCPU    []ProcessInfo `json:"by_cpu"`
+	ByMemory []ProcessInfo `json:"by_memory"`
+	ByIO     []ProcessInfo `json:"by_io"`
+}
+
+// processSample 进程累计计数，用于计算两次采集之间的速率
+type processSample struct {
+	StartTicks uint64 // 进程启动时间，区分被复用的 PID
+	CPUTicks   uint64
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+// processCollector 进程采集器，保存上一次采集的累计值
+type processCollector struct {
+	root     SystemRoot
+	prev     map[int]processSample
+	prevTime time.Time
+	users    map[string]string // UID -> 用户名缓存
+}
+
+// newProcessCollector 创建进程采集器，并记录一次基准值
+func newProcessCollector(root SystemRoot) *processCollector {
+	c := &processCollector{root: root, users: make(map[string]string)}
+	c.collect()
+	return c
+}
+
+// collect 采集所有进程，返回进程列表与系统总内存
+func (c *processCollector) collect() ([]ProcessInfo, error) {
+	now := time.Now()
+	procs, samples, err := readProcesses(c.root, c.users)
+	if err != nil {
+		return nil, err
+	}
+
+	prev, elapsed := c.prev, now.Sub(c.prevTime).Seconds()
+	c.prev, c.prevTime = samples, now
+	if prev == nil || elapsed <= 0 {
+		return procs, nil
+	}
+
+	for i := range procs {
+		p := &procs[i]
+		cur := samples[p.PID]
+		old, ok := prev[p.PID]
+		if !ok || old.StartTicks != cur.StartTicks {
+			// 新进程，或 PID 已被其他进程复用
+			continue
+		}
+		p.CPUPercent = float64(counterDelta(cur.CPUTicks, old.CPUTicks)) / clockTicks / elapsed * 100
+		p.ReadBytesRate = float64(counterDelta(cur.ReadBytes, old.ReadBytes)) / elapsed
+		p.WriteBytesRate = float64(counterDelta(cur.WriteBytes, old.WriteBytes)) / elapsed
+	}
+	return procs, nil
+}
+
+// snapshot 采集进程并生成排行
+func (c *processCollector) snapshot(limit int) (*ProcessSnapshot, error) {
+	procs, err := c.collect()
+	if err != nil {
+		return nil, err
+	}
+	return rankProcesses(procs, limit), nil
+}
+
+// rankProcesses 分别按 CPU、常驻内存、磁盘读写取前 limit 个进程
+func rankProcesses(procs []ProcessInfo, limit int) *ProcessSnapshot {
+	top := func(less func(a, b *ProcessInfo) bool) []ProcessInfo {
+		sorted := make([]ProcessInfo, len(procs))
+		copy(sorted, procs)
+		sort.SliceStable(sorted, func(i, j int) bool { return less(&sorted[i], &sorted[j]) })
+		if len(sorted) > limit {
+			sorted = sorted[:limit]
+		}
+		return sorted
+	}
+
+	return &ProcessSnapshot{
+		Total:    len(procs),
+		ByCPU:    top(func(a, b *ProcessInfo) bool { return a.CPUPercent > b.CPUPercent }),
+		ByMemory: top(func(a, b *ProcessInfo) bool { return a.RSS > b.RSS }),
+		ByIO: top(func(a, b *ProcessInfo) bool {
+			return a.ReadBytesRate+a.WriteBytesRate > b.ReadBytesRate+b.WriteBytesRate
+		}),
+	}
+}
+
+// queryProcesses 采集一次进程排行，两次采样间隔 sample 用于计算 CPU 和 I/O 速率
+// 供本地 ps 命令和服务端下发的 ps 指令使用
+func queryProcesses(root SystemRoot, limit int, sample time.Duration) (*ProcessSnapshot, error) {
+	c := newProcessCollector(root)
+	time.Sleep(sample)
+	return c.snapshot(limit)
+}
+
+// ProcessList 按指定字段取排行，sortBy 为 cpu、memory 或 io
+func (s *ProcessSnapshot) ProcessList(sortBy string) ([]ProcessInfo, error) {
+	switch sortBy {
+	case "cpu", "":
+		return s.ByCPU, nil
+	case "memory", "mem", "rss":
+		return s.ByMemory, nil
+	case "io":
+		return s.ByIO, nil
+	default:
+		return nil, fmt.Errorf("不支持的排序字段: %s (可选 cpu、memory、io)", sortBy)
+	}
+}
+
+// runPsCommand 处理 ps 命令，显示资源占用最高的进程
+func runPsCommand(args []string) int {
+	sortBy, limit := "cpu", 10
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--sort", "-s":
+			if i+1 < len(args) {
+				i++
+				sortBy = args[i]
+			}
+		case "-n", "--top":
+			if i+1 < len(args) {
+				i++
+				fmt.Sscanf(args[i], "%d", &limit)
+			}
+		default:
+			fmt.Printf("未知参数: %s\n", args[i])
+			return 1
+		}
+	}
+	if limit <= 0 {
+		fmt.Println("❌ 进程数量必须大于 0")
+		return 1
+	}
+
+	loaded, err := loadAgentConfig(commandLineConfig)
+	if err != nil {
+		printConfigErrors(err)
+		return 1
+	}
+
+	snapshot, err := queryProcesses(systemRootFromConfig(loaded.Config), limit, time.Second)
+	if err != nil {
+		fmt.Printf("❌ 采集进程信息失败: %v\n", err)
+		return 1
+	}
+	procs, err := snapshot.ProcessList(sortBy)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("进程总数: %d，按 %s 排序前 %d 个:\n", snapshot.Total, sortBy, len(procs))
+	fmt.Printf("%7s %-10s %6s %10s %10s %10s %-19s %s\n", "PID", "USER", "CPU%", "RSS", "READ/s", "WRITE/s", "START", "COMMAND")
+	for _, p := range procs {
+		cmd := p.Cmdline
+		if cmd == "" {
+			cmd = "[" + p.Name + "]"
+		}
+		if r := []rune(cmd); len(r) > 80 {
+			cmd = string(r[:77]) + "..."
+		}
+		fmt.Printf("%7d %-10s %6.1f %10s %10s %10s %-19s %s\n", p.PID, truncateString(p.User, 10), p.CPUPercent,
+			formatBytes(p.RSS), formatBytes(int64(p.ReadBytesRate)), formatBytes(int64(p.WriteBytesRate)),
+			p.StartTime.Format("2006-01-02 15:04:05"), cmd)
+	}
+	return 0
+}
+
+// truncateString 截断超长字符串
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.TrimSpace(s[:n-1]) + "+"
+}
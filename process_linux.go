@@ -0,0 +1,145 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks /proc 中 CPU 时间的单位 (USER_HZ)，Linux 各架构上均为 100
+const clockTicks = 100
+
+// readProcesses 遍历 /proc/<pid> 读取进程信息和累计计数
+// 进程可能在读取过程中退出，读取失败的进程直接跳过
+func readProcesses(root SystemRoot, users map[string]string) ([]ProcessInfo, map[int]processSample, error) {
+	entries, err := os.ReadDir(root.Proc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var memTotal int64
+	if meminfo, err := readMemInfo(root); err == nil {
+		memTotal = meminfo["MemTotal"]
+	}
+	bootTime := readBootTime(root)
+
+	var procs []ProcessInfo
+	samples := make(map[int]processSample)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+
+		info, sample, ok := readProcess(root, pid, users)
+		if !ok {
+			continue
+		}
+		if bootTime > 0 {
+			info.StartTime = time.Unix(bootTime, 0).Add(time.Duration(sample.StartTicks) * time.Second / clockTicks)
+		}
+		info.MemoryPercent = usagePercent(info.RSS, memTotal)
+
+		procs = append(procs, info)
+		samples[pid] = sample
+	}
+	return procs, samples, nil
+}
+
+// readProcess 读取单个进程的 stat、status、io 和 cmdline
+func readProcess(root SystemRoot, pid int, users map[string]string) (ProcessInfo, processSample, bool) {
+	dir := strconv.Itoa(pid)
+	info := ProcessInfo{PID: pid}
+	var sample processSample
+
+	// stat 格式: pid (comm) state ppid ...，comm 中可能包含空格和括号，以最后一个 ')' 为界
+	data, err := os.ReadFile(root.proc(dir, "stat"))
+	if err != nil {
+		return info, sample, false
+	}
+	stat := string(data)
+	open, close := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+	if open < 0 || close < open {
+		return info, sample, false
+	}
+	info.Name = stat[open+1 : close]
+	fields := strings.Fields(stat[close+1:])
+	if len(fields) < 20 {
+		return info, sample, false
+	}
+	// fields[0] 为 state，对应 stat 的第 3 个字段
+	info.State = fields[0]
+	info.PPID, _ = strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	info.Threads, _ = strconv.Atoi(fields[17])
+	sample.StartTicks, _ = strconv.ParseUint(fields[19], 10, 64)
+	sample.CPUTicks = utime + stime
+
+	// status 提供 VmRSS 和 Uid
+	if f, err := os.Open(root.proc(dir, "status")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), ":")
+			if !ok {
+				continue
+			}
+			values := strings.Fields(value)
+			if len(values) == 0 {
+				continue
+			}
+			switch key {
+			case "VmRSS":
+				kb, _ := strconv.ParseInt(values[0], 10, 64)
+				info.RSS = kb * 1024
+			case "Uid":
+				info.User = lookupUserName(values[0], users)
+			}
+		}
+		f.Close()
+	}
+
+	// io 需要与进程同一用户或 root 权限
+	if f, err := os.Open(root.proc(dir, "io")); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), ":")
+			if !ok {
+				continue
+			}
+			n, _ := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+			switch key {
+			case "read_bytes":
+				sample.ReadBytes = n
+			case "write_bytes":
+				sample.WriteBytes = n
+			}
+		}
+		f.Close()
+	}
+
+	// cmdline 以 NUL 分隔参数，内核线程为空
+	if data, err := os.ReadFile(root.proc(dir, "cmdline")); err == nil {
+		info.Cmdline = strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+	}
+
+	return info, sample, true
+}
+
+// lookupUserName 将 UID 转换为用户名，查询结果缓存
+func lookupUserName(uid string, cache map[string]string) string {
+	if name, ok := cache[uid]; ok {
+		return name
+	}
+	name := uid
+	if u, err := user.LookupId(uid); err == nil {
+		name = u.Username
+	}
+	cache[uid] = name
+	return name
+}
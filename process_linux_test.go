@@ -0,0 +1,147 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReadProcesses(t *testing.T) {
+	// UID 预先放入缓存，结果不依赖本机的用户数据库
+	users := map[string]string{"0": "root", "1000": "pi"}
+	procs, samples, err := readProcesses(testdataRoot, users)
+	if err != nil {
+		t.Fatalf("readProcesses: %v", err)
+	}
+
+	// 999 的 stat 字段不全（进程正在退出）被跳过，非数字目录不是进程
+	bootTime := time.Unix(1760000000, 0)
+	want := map[int]ProcessInfo{
+		1: {PID: 1, Name: "systemd", Cmdline: "/sbin/init splash", User: "root", State: "S", Threads: 1,
+			StartTime: bootTime.Add(50 * time.Millisecond), RSS: 11520 * 1024},
+		// 进程名中的空格和括号以最后一个 ')' 为界
+		1234: {PID: 1234, PPID: 1, Name: "tmux: server (1)", Cmdline: "tmux new -s main", User: "pi", State: "S", Threads: 3,
+			StartTime: bootTime.Add(1200 * time.Second), RSS: 5120 * 1024},
+		// 内核线程没有 cmdline 和 VmRSS
+		42: {PID: 42, PPID: 2, Name: "kworker/0:1-events", User: "root", State: "I", Threads: 1,
+			StartTime: bootTime.Add(3 * time.Second)},
+	}
+	if len(procs) != len(want) {
+		t.Fatalf("procs = %+v", procs)
+	}
+	for _, p := range procs {
+		w := want[p.PID]
+		w.MemoryPercent = usagePercent(w.RSS, 3884180*1024)
+		if !p.StartTime.Equal(w.StartTime) {
+			t.Errorf("pid %d: start time = %v, want %v", p.PID, p.StartTime, w.StartTime)
+		}
+		p.StartTime, w.StartTime = time.Time{}, time.Time{}
+		if p != w {
+			t.Errorf("pid %d: info = %+v\nwant %+v", p.PID, p, w)
+		}
+	}
+
+	// io 文件不可读（如其他用户的进程）时读写计数为 0
+	wantSamples := map[int]processSample{
+		1:    {StartTicks: 5, CPUTicks: 3800, ReadBytes: 104857600, WriteBytes: 52428800},
+		1234: {StartTicks: 120000, CPUTicks: 300, ReadBytes: 4096, WriteBytes: 8192},
+		42:   {StartTicks: 300, CPUTicks: 12},
+	}
+	if fmt.Sprint(samples) != fmt.Sprint(wantSamples) {
+		t.Fatalf("samples = %+v\nwant %+v", samples, wantSamples)
+	}
+}
+
+// writeProcStat 写入 /proc/<pid>/stat 和 io，ticks 为累计 CPU 时间片，start 为启动时间
+func writeProcStat(t *testing.T, root SystemRoot, pid int, ticks, start, ioBytes uint64) {
+	t.Helper()
+	dir := root.proc(strconv.Itoa(pid))
+	os.MkdirAll(dir, 0755)
+	stat := fmt.Sprintf("%d (worker) R 1 %d %d 0 -1 0 0 0 0 0 %d 0 0 0 20 0 1 0 %d 0 0\n", pid, pid, pid, ticks, start)
+	writeTestFile(t, filepath.Join(dir, "stat"), []byte(stat))
+	writeTestFile(t, filepath.Join(dir, "io"), []byte(fmt.Sprintf("read_bytes: %d\nwrite_bytes: %d\n", ioBytes, ioBytes/2)))
+}
+
+func TestProcessCollectorRates(t *testing.T) {
+	root := SystemRoot{Proc: t.TempDir()}
+	os.MkdirAll(root.proc(), 0755)
+	c := &processCollector{root: root, users: make(map[string]string)}
+
+	tests := []struct {
+		name  string
+		procs map[int][3]uint64  // pid -> CPU 时间片、启动时间、读取字节数
+		want  map[int][3]float64 // pid -> CPU%、读、写速率
+	}{
+		{name: "baseline", procs: map[int][3]uint64{100: {1000, 50, 0}, 200: {10, 60, 0}}, want: map[int][3]float64{100: {}, 200: {}}},
+		{
+			// 1 秒内 100 个时间片即占满一个核心
+			name:  "busy",
+			procs: map[int][3]uint64{100: {1150, 50, 2048}, 200: {60, 60, 1024}},
+			want:  map[int][3]float64{100: {150, 2048, 1024}, 200: {50, 1024, 512}},
+		},
+		{
+			// PID 200 被新进程复用，300 是新进程，都只记录基准值
+			name:  "pid reused",
+			procs: map[int][3]uint64{100: {1150, 50, 2048}, 200: {5, 900, 0}, 300: {40, 910, 0}},
+			want:  map[int][3]float64{100: {0, 0, 0}, 200: {}, 300: {}},
+		},
+	}
+	for _, tt := range tests {
+		entries, _ := os.ReadDir(root.proc())
+		for _, e := range entries {
+			os.RemoveAll(root.proc(e.Name()))
+		}
+		for pid, p := range tt.procs {
+			writeProcStat(t, root, pid, p[0], p[1], p[2])
+		}
+		if c.prev != nil {
+			c.prevTime = time.Now().Add(-time.Second) // 增量按 1 秒计算速率
+		}
+
+		procs, err := c.collect()
+		if err != nil {
+			t.Fatalf("%s: collect: %v", tt.name, err)
+		}
+		if len(procs) != len(tt.want) {
+			t.Fatalf("%s: procs = %+v", tt.name, procs)
+		}
+		for _, p := range procs {
+			// 速率按实际经过的时间计算，允许 1% 的误差
+			got, want := [3]float64{p.CPUPercent, p.ReadBytesRate, p.WriteBytesRate}, tt.want[p.PID]
+			for i := range got {
+				if math.Abs(got[i]-want[i]) > want[i]*0.01 {
+					t.Errorf("%s: pid %d rates = %v, want %v", tt.name, p.PID, got, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestRankProcesses(t *testing.T) {
+	procs := []ProcessInfo{
+		{PID: 1, CPUPercent: 5, RSS: 300, ReadBytesRate: 10},
+		{PID: 2, CPUPercent: 50, RSS: 100, WriteBytesRate: 1000},
+		{PID: 3, CPUPercent: 20, RSS: 200},
+	}
+	snapshot := rankProcesses(procs, 2)
+	pids := func(list []ProcessInfo) string {
+		var s []int
+		for _, p := range list {
+			s = append(s, p.PID)
+		}
+		return fmt.Sprint(s)
+	}
+	if snapshot.Total != 3 || pids(snapshot.ByCPU) != "[2 3]" || pids(snapshot.ByMemory) != "[1 3]" || pids(snapshot.ByIO) != "[2 1]" {
+		t.Fatalf("snapshot: total %d, cpu %s, memory %s, io %s", snapshot.Total, pids(snapshot.ByCPU), pids(snapshot.ByMemory), pids(snapshot.ByIO))
+	}
+	if _, err := snapshot.ProcessList("threads"); err == nil {
+		t.Error("unsupported sort field accepted")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import "fmt"
+
+// clockTicks 与 Linux 保持一致的 CPU 时间单位
+const clockTicks = 100
+
+// readProcesses Windows 下暂不支持进程排行
+func readProcesses(root SystemRoot, users map[string]string) ([]ProcessInfo, map[int]processSample, error) {
+	return nil, nil, fmt.Errorf("当前平台暂不支持进程采集")
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxyDirect 配置为该值时不使用任何代理，也忽略 HTTPS_PROXY 等环境变量
+const proxyDirect = "direct"
+
+// parseProxyURL 解析代理地址，支持 http、https、socks5、socks5h，可在地址中携带用户名和密码
+func parseProxyURL(v string) (*url.URL, error) {
+	u, err := url.Parse(v)
+	if err != nil {
+		return nil, fmt.Errorf("代理地址格式错误: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("不支持的代理类型 %q，可选: http、https、socks5、socks5h", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("代理地址缺少主机名: %q", v)
+	}
+	return u, nil
+}
+
+// redactProxy 隐藏代理地址中的密码，用于日志和配置展示
+func redactProxy(v string) string {
+	if u, err := url.Parse(v); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return v
+}
+
+// proxySettings 出站代理设置，服务端连接以及其他访问外部的 HTTP 请求都通过它选择代理
+// 未配置 network.proxy 时使用 HTTPS_PROXY、HTTP_PROXY、NO_PROXY 环境变量；
+// 配置了代理地址时，NO_PROXY 中的主机以及本机地址仍然直连
+type proxySettings struct {
+	fixed   *url.URL // network.proxy 指定的代理，nil 表示使用环境变量
+	direct  bool     // network.proxy = "direct"
+	noProxy []string
+}
+
+// newProxySettings 根据配置创建代理设置
+func newProxySettings(c *AgentConfig) (*proxySettings, error) {
+	p := &proxySettings{}
+	switch c.Proxy {
+	case "":
+		return p, nil
+	case proxyDirect:
+		p.direct = true
+		return p, nil
+	}
+
+	fixed, err := parseProxyURL(c.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	p.fixed = fixed
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	p.noProxy = splitConfigList(strings.ToLower(noProxy))
+	return p, nil
+}
+
+// ProxyURL 返回访问目标地址使用的代理，nil 表示直连
+// p 为 nil 时按环境变量选择，与 net/http 的默认行为一致
+func (p *proxySettings) ProxyURL(target *url.URL) (*url.URL, error) {
+	switch {
+	case p == nil || p.fixed == nil && !p.direct:
+		// 环境变量按 http/https 选择代理，ws/wss 分别与之对应
+		u := *target
+		switch u.Scheme {
+		case "ws":
+			u.Scheme = "http"
+		case "wss":
+			u.Scheme = "https"
+		}
+		return http.ProxyFromEnvironment(&http.Request{URL: &u})
+	case p.direct:
+		return nil, nil
+	}
+
+	if p.bypass(target) {
+		return nil, nil
+	}
+	return p.fixed, nil
+}
+
+// Proxy 用于 http.Transport.Proxy
+func (p *proxySettings) Proxy(req *http.Request) (*url.URL, error) {
+	return p.ProxyURL(req.URL)
+}
+
+// bypass 检查目标地址是否直连：本机地址以及与 NO_PROXY 匹配的主机
+// NO_PROXY 每一项可以是 *、IP、CIDR、域名以及可选的端口，规则与 Go 标准库处理环境变量时相同
+func (p *proxySettings) bypass(target *url.URL) bool {
+	host := strings.ToLower(target.Hostname())
+	port := target.Port()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		return true
+	}
+
+	for _, entry := range p.noProxy {
+		if entry == "*" {
+			return true
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost, entryPort := entry, ""
+		if h, pt, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, pt
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+		entryHost = strings.Trim(entryHost, "[]")
+		if entryIP := net.ParseIP(entryHost); entryIP != nil {
+			if ip != nil && entryIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		// .example.com 只匹配子域名，example.com 同时匹配自身和子域名
+		entryHost = strings.TrimPrefix(entryHost, "*")
+		if strings.HasPrefix(entryHost, ".") {
+			if strings.HasSuffix(host, entryHost) {
+				return true
+			}
+		} else if host == entryHost || strings.HasSuffix(host, "."+entryHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// newHTTPTransport 创建使用代理设置和 TLS 配置的 HTTP 传输层
+// http.Transport 本身支持 http、https 代理（CONNECT 隧道）和 socks5 代理，代理认证信息取自代理地址
+func newHTTPTransport(tlsConfig *tls.Config, proxy *proxySettings) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.Proxy = proxy.Proxy
+	// http.Transport 自带的 SOCKS5 拨号总把域名交给代理，socks5 代理改由 dialProxy 在本机解析后建立隧道
+	if proxy != nil && proxy.fixed != nil && proxy.fixed.Scheme == "socks5" {
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return proxy.DialContext(&url.URL{Host: addr})(ctx, network, addr)
+		}
+	}
+	return transport
+}
+
+// DialContext 返回连接目标地址的拨号函数，按代理设置直连或经代理建立隧道
+// 用于 WebSocket 等不经过 http.Transport 的连接
+func (p *proxySettings) DialContext(target *url.URL) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		proxyURL, err := p.ProxyURL(target)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL == nil {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return dialProxy(ctx, proxyURL, addr)
+	}
+}
+
+// dialProxy 连接代理服务器并建立到 addr 的隧道
+func dialProxy(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	// socks5 由本机解析目标域名后把 IP 交给代理，socks5h 由代理解析
+	if proxyURL.Scheme == "socks5" {
+		resolved, err := resolveTargetAddr(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+		addr = resolved
+	}
+
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}[proxyURL.Scheme]
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("连接代理 %s 失败: %v", proxyAddr, err)
+	}
+
+	// 握手期间 ctx 取消或超时时中断读写
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("代理 %s TLS 握手失败: %v", proxyAddr, err)
+		}
+		conn = tlsConn
+	}
+
+	if proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h" {
+		err = socks5Connect(conn, proxyURL.User, addr)
+	} else {
+		err = httpConnect(conn, proxyURL.User, addr)
+	}
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("代理 %s: %v", proxyAddr, err)
+	}
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	return conn, nil
+}
+
+// lookupIP 解析域名，测试中替换以免依赖 DNS
+var lookupIP = net.DefaultResolver.LookupIP
+
+// resolveTargetAddr 在本机解析 addr 中的域名，优先使用 IPv4 地址
+func resolveTargetAddr(ctx context.Context, addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return addr, nil
+	}
+	ips, err := lookupIP(ctx, "ip", host)
+	if err != nil {
+		return "", fmt.Errorf("解析 %s 失败: %v", host, err)
+	}
+	ip := ips[0]
+	for _, candidate := range ips {
+		if candidate.To4() != nil {
+			ip = candidate
+			break
+		}
+	}
+	return net.JoinHostPort(ip.String(), port), nil
+}
+
+// httpConnect 通过 HTTP CONNECT 建立隧道，代理地址携带用户名时使用 Basic 认证
+func httpConnect(conn net.Conn, user *url.Userinfo, addr string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		password, _ := user.Password()
+		credential := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credential)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// 隧道建立前服务端不会发送数据，丢弃读缓冲是安全的
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		return fmt.Errorf("代理认证失败: %s", resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("代理拒绝连接 %s: %s", addr, resp.Status)
+	}
+	return nil
+}
+
+// SOCKS5 协议常量 (RFC 1928, RFC 1929)
+const (
+	socks5Version      = 5
+	socks5NoAuth       = 0
+	socks5PasswordAuth = 2
+	socks5NoAcceptable = 0xff
+	socks5CmdConnect   = 1
+	socks5AddrIPv4     = 1
+	socks5AddrDomain   = 3
+	socks5AddrIPv6     = 4
+)
+
+// socks5Connect 通过 SOCKS5 代理建立隧道，addr 为域名时交给代理解析
+func socks5Connect(conn net.Conn, user *url.Userinfo, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("无效的端口: %s", portStr)
+	}
+
+	methods := []byte{socks5NoAuth}
+	if user != nil {
+		methods = []byte{socks5NoAuth, socks5PasswordAuth}
+	}
+	if _, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("不是 SOCKS5 代理 (版本 %d)", reply[0])
+	}
+
+	switch reply[1] {
+	case socks5NoAuth:
+	case socks5PasswordAuth:
+		if user == nil {
+			return fmt.Errorf("SOCKS5 代理要求用户名和密码")
+		}
+		password, _ := user.Password()
+		if len(user.Username()) > 255 || len(password) > 255 {
+			return fmt.Errorf("SOCKS5 用户名或密码过长")
+		}
+		auth := []byte{1, byte(len(user.Username()))}
+		auth = append(auth, user.Username()...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return fmt.Errorf("SOCKS5 代理认证失败")
+		}
+	case socks5NoAcceptable:
+		return fmt.Errorf("SOCKS5 代理不接受任何认证方式")
+	default:
+		return fmt.Errorf("SOCKS5 代理选择了不支持的认证方式 %d", reply[1])
+	}
+
+	req := []byte{socks5Version, socks5CmdConnect, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(append(req, socks5AddrIPv4), ip4...)
+		} else {
+			req = append(append(req, socks5AddrIPv6), ip...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("主机名过长: %s", host)
+		}
+		req = append(req, socks5AddrDomain, byte(len(host)))
+		req = append(req, host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	// 响应: VER REP RSV ATYP BND.ADDR BND.PORT
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("SOCKS5 代理拒绝连接 %s: %s", addr, socks5ReplyText(head[1]))
+	}
+	var skip int
+	switch head[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(conn, size); err != nil {
+			return err
+		}
+		skip = int(size[0])
+	default:
+		return fmt.Errorf("SOCKS5 响应地址类型无效 %d", head[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// socks5ReplyText SOCKS5 错误码说明
+func socks5ReplyText(code byte) string {
+	texts := map[byte]string{
+		1: "代理服务器故障",
+		2: "规则不允许连接",
+		3: "网络不可达",
+		4: "主机不可达",
+		5: "连接被拒绝",
+		6: "TTL 过期",
+		7: "不支持的命令",
+		8: "不支持的地址类型",
+	}
+	if text, ok := texts[code]; ok {
+		return text
+	}
+	return fmt.Sprintf("错误码 %d", code)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SensorStats 温度、风扇、降频和电源传感器信息
+type SensorStats struct {
+	Temperatures  []TemperatureSensor `json:"temperatures,omitempty"`
+	Fans          []FanSensor         `json:"fans,omitempty"`
+	Cooling       []CoolingDevice     `json:"cooling,omitempty"`
+	PowerSupplies []PowerSupply       `json:"power_supplies,omitempty"`
+
+	// CPU 当前频率与最高频率（MHz），为所有频率策略的平均值，不支持时为 0
+	CPUFreqMHz    float64 `json:"cpu_freq_mhz,omitempty"`
+	CPUMaxFreqMHz float64 `json:"cpu_max_freq_mhz,omitempty"`
+
+	// 本周期内发生的 CPU 过热降频次数，来自 thermal_throttle 计数器
+	ThrottleEvents uint64 `json:"throttle_events"`
+
+	// throttleCount 降频计数器累计值，用于计算周期内的增量
+	throttleCount    uint64
+	hasThrottleCount bool
+}
+
+// TemperatureSensor 温度传感器（摄氏度），阈值未知时为 0
+type TemperatureSensor struct {
+	Source   string  `json:"source"` // thermal 或 hwmon
+	Chip     string  `json:"chip"`
+	Label    string  `json:"label"`
+	Celsius  float64 `json:"celsius"`
+	High     float64 `json:"high,omitempty"`
+	Critical float64 `json:"critical,omitempty"`
+}
+
+// FanSensor 风扇转速
+type FanSensor struct {
+	Chip  string  `json:"chip"`
+	Label string  `json:"label"`
+	RPM   float64 `json:"rpm"`
+}
+
+// CoolingDevice 散热设备，对无风扇设备通常是 CPU 降频 (cpufreq)
+// CurState 大于 0 表示正在介入降温
+type CoolingDevice struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	CurState int    `json:"cur_state"`
+	MaxState int    `json:"max_state"`
+}
+
+// PowerSupply 电源状态，包括电池、UPS 和外部供电
+type PowerSupply struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`             // Battery、UPS、Mains、USB 等
+	Status   string  `json:"status,omitempty"` // Charging、Discharging、Full 等
+	Online   bool    `json:"online"`
+	Capacity int     `json:"capacity"` // 剩余电量百分比，未知时为 -1
+	Voltage  float64 `json:"voltage,omitempty"`
+	Power    float64 `json:"power,omitempty"` // 瓦
+}
+
+// collectSensors 采集传感器信息，并根据累计计数计算本周期的降频次数
+func (c *MetricsCollector) collectSensors(m *NodeMetrics) {
+	sensors := readSensors(c.root)
+	if sensors == nil {
+		return
+	}
+
+	prev, hasPrev := c.prevThrottle, c.hasThrottle
+	c.prevThrottle, c.hasThrottle = sensors.throttleCount, sensors.hasThrottleCount
+	if hasPrev && sensors.hasThrottleCount {
+		sensors.ThrottleEvents = counterDelta(sensors.throttleCount, prev)
+	}
+	m.Sensors = sensors
+}
+
+// MaxTemperature 获取温度最高的传感器
+func (s *SensorStats) MaxTemperature() *TemperatureSensor {
+	var max *TemperatureSensor
+	for i := range s.Temperatures {
+		if max == nil || s.Temperatures[i].Celsius > max.Celsius {
+			max = &s.Temperatures[i]
+		}
+	}
+	return max
+}
+
+// Overheated 返回达到告警阈值的温度传感器
+func (s *SensorStats) Overheated() []TemperatureSensor {
+	var hot []TemperatureSensor
+	for _, t := range s.Temperatures {
+		if (t.High > 0 && t.Celsius >= t.High) || (t.Critical > 0 && t.Celsius >= t.Critical) {
+			hot = append(hot, t)
+		}
+	}
+	return hot
+}
+
+// Throttling 检查本周期是否发生降频，或有散热设备正在限制 CPU 频率
+func (s *SensorStats) Throttling() bool {
+	if s.ThrottleEvents > 0 {
+		return true
+	}
+	for _, d := range s.Cooling {
+		if d.CurState > 0 && isCPUCoolingDevice(d.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCPUCoolingDevice 判断散热设备是否通过降低 CPU 频率或插入空闲实现降温
+func isCPUCoolingDevice(kind string) bool {
+	kind = strings.ToLower(kind)
+	return strings.HasPrefix(kind, "cpufreq") || strings.HasPrefix(kind, "thermal-cpufreq") ||
+		strings.HasPrefix(kind, "processor") || strings.Contains(kind, "idle")
+}
+
+// Battery 获取第一个电池或 UPS，没有时返回 nil
+func (s *SensorStats) Battery() *PowerSupply {
+	for i := range s.PowerSupplies {
+		if t := s.PowerSupplies[i].Type; t == "Battery" || t == "UPS" {
+			return &s.PowerSupplies[i]
+		}
+	}
+	return nil
+}
+
+// Summary 生成传感器摘要，没有可用传感器时为空
+func (s *SensorStats) Summary() string {
+	var parts []string
+	if t := s.MaxTemperature(); t != nil {
+		parts = append(parts, fmt.Sprintf("温度=%.1f°C (%s)", t.Celsius, t.Label))
+	}
+	if s.Throttling() {
+		parts = append(parts, "降频中")
+	}
+	if b := s.Battery(); b != nil && b.Capacity >= 0 {
+		parts = append(parts, fmt.Sprintf("电量=%d%% (%s)", b.Capacity, valueOrUnknown(b.Status)))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,268 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// readSensors 从 sysfs 读取温度、风扇、散热设备、CPU 频率和电源信息
+// 没有任何可用传感器时返回 nil
+func readSensors(root SystemRoot) *SensorStats {
+	s := &SensorStats{}
+	s.Temperatures = append(readThermalZones(root), readHwmonTemperatures(root)...)
+	s.Fans = readHwmonFans(root)
+	s.Cooling = readCoolingDevices(root)
+	s.PowerSupplies = readPowerSupplies(root)
+	s.CPUFreqMHz, s.CPUMaxFreqMHz = readCPUFrequency(root)
+	s.throttleCount, s.hasThrottleCount = readThrottleCount(root)
+
+	if len(s.Temperatures) == 0 && len(s.Fans) == 0 && len(s.Cooling) == 0 &&
+		len(s.PowerSupplies) == 0 && s.CPUFreqMHz == 0 && !s.hasThrottleCount {
+		return nil
+	}
+	return s
+}
+
+// readSysfsString 读取 sysfs 属性并去掉首尾空白，失败时返回空字符串
+func readSysfsString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readSysfsInt 读取整数类型的 sysfs 属性
+func readSysfsInt(path string) (int64, bool) {
+	v, err := strconv.ParseInt(readSysfsString(path), 10, 64)
+	return v, err == nil
+}
+
+// globSorted 按自然顺序返回匹配的路径，保证 thermal_zone10 排在 thermal_zone9 之后
+func globSorted(pattern string) []string {
+	paths, _ := filepath.Glob(pattern)
+	sort.Slice(paths, func(i, j int) bool {
+		if len(paths[i]) != len(paths[j]) {
+			return len(paths[i]) < len(paths[j])
+		}
+		return paths[i] < paths[j]
+	})
+	return paths
+}
+
+// readThermalZones 读取 /sys/class/thermal/thermal_zone*，温度单位为毫摄氏度
+// 告警阈值取自 trip point: hot/passive 作为高温阈值，critical 作为临界阈值
+func readThermalZones(root SystemRoot) []TemperatureSensor {
+	var sensors []TemperatureSensor
+	for _, dir := range globSorted(root.sys("class", "thermal", "thermal_zone*")) {
+		temp, ok := readSysfsInt(filepath.Join(dir, "temp"))
+		if !ok {
+			continue
+		}
+		sensor := TemperatureSensor{
+			Source:  "thermal",
+			Chip:    filepath.Base(dir),
+			Label:   readSysfsString(filepath.Join(dir, "type")),
+			Celsius: float64(temp) / 1000,
+		}
+		if sensor.Label == "" {
+			sensor.Label = sensor.Chip
+		}
+
+		types, _ := filepath.Glob(filepath.Join(dir, "trip_point_*_type"))
+		for _, typePath := range types {
+			tripTemp, ok := readSysfsInt(strings.TrimSuffix(typePath, "_type") + "_temp")
+			if !ok || tripTemp <= 0 {
+				continue
+			}
+			celsius := float64(tripTemp) / 1000
+			switch readSysfsString(typePath) {
+			case "critical":
+				sensor.Critical = celsius
+			case "hot", "passive":
+				if sensor.High == 0 || celsius < sensor.High {
+					sensor.High = celsius
+				}
+			}
+		}
+		sensors = append(sensors, sensor)
+	}
+	return sensors
+}
+
+// hwmonDirs 返回所有 hwmon 设备目录
+// 较旧的驱动把传感器属性放在 device 子目录下
+func hwmonDirs(root SystemRoot) []string {
+	var dirs []string
+	for _, dir := range globSorted(root.sys("class", "hwmon", "hwmon*")) {
+		if matches, _ := filepath.Glob(filepath.Join(dir, "*_input")); len(matches) == 0 {
+			if matches, _ := filepath.Glob(filepath.Join(dir, "device", "*_input")); len(matches) > 0 {
+				dir = filepath.Join(dir, "device")
+			}
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// hwmonChipName 获取 hwmon 芯片名称
+func hwmonChipName(dir string) string {
+	if name := readSysfsString(filepath.Join(dir, "name")); name != "" {
+		return name
+	}
+	if name := readSysfsString(filepath.Join(filepath.Dir(dir), "name")); name != "" {
+		return name
+	}
+	return filepath.Base(dir)
+}
+
+// hwmonLabel 读取传感器标签，没有标签时使用通道名称（如 temp1）
+func hwmonLabel(dir, channel string) string {
+	if label := readSysfsString(filepath.Join(dir, channel+"_label")); label != "" {
+		return label
+	}
+	return channel
+}
+
+// readHwmonTemperatures 读取 hwmon 温度传感器 temp*_input，单位为毫摄氏度
+func readHwmonTemperatures(root SystemRoot) []TemperatureSensor {
+	var sensors []TemperatureSensor
+	for _, dir := range hwmonDirs(root) {
+		chip := hwmonChipName(dir)
+		for _, input := range globSorted(filepath.Join(dir, "temp*_input")) {
+			temp, ok := readSysfsInt(input)
+			if !ok {
+				continue
+			}
+			channel := strings.TrimSuffix(filepath.Base(input), "_input")
+			sensor := TemperatureSensor{
+				Source:  "hwmon",
+				Chip:    chip,
+				Label:   hwmonLabel(dir, channel),
+				Celsius: float64(temp) / 1000,
+			}
+			if v, ok := readSysfsInt(filepath.Join(dir, channel+"_max")); ok && v > 0 {
+				sensor.High = float64(v) / 1000
+			}
+			if v, ok := readSysfsInt(filepath.Join(dir, channel+"_crit")); ok && v > 0 {
+				sensor.Critical = float64(v) / 1000
+			}
+			sensors = append(sensors, sensor)
+		}
+	}
+	return sensors
+}
+
+// readHwmonFans 读取 hwmon 风扇转速 fan*_input，单位为 RPM
+func readHwmonFans(root SystemRoot) []FanSensor {
+	var fans []FanSensor
+	for _, dir := range hwmonDirs(root) {
+		chip := hwmonChipName(dir)
+		for _, input := range globSorted(filepath.Join(dir, "fan*_input")) {
+			rpm, ok := readSysfsInt(input)
+			if !ok {
+				continue
+			}
+			channel := strings.TrimSuffix(filepath.Base(input), "_input")
+			fans = append(fans, FanSensor{Chip: chip, Label: hwmonLabel(dir, channel), RPM: float64(rpm)})
+		}
+	}
+	return fans
+}
+
+// readCoolingDevices 读取 /sys/class/thermal/cooling_device*
+func readCoolingDevices(root SystemRoot) []CoolingDevice {
+	var devices []CoolingDevice
+	for _, dir := range globSorted(root.sys("class", "thermal", "cooling_device*")) {
+		cur, ok := readSysfsInt(filepath.Join(dir, "cur_state"))
+		if !ok {
+			continue
+		}
+		max, _ := readSysfsInt(filepath.Join(dir, "max_state"))
+		devices = append(devices, CoolingDevice{
+			Name:     filepath.Base(dir),
+			Type:     readSysfsString(filepath.Join(dir, "type")),
+			CurState: int(cur),
+			MaxState: int(max),
+		})
+	}
+	return devices
+}
+
+// readCPUFrequency 读取 cpufreq 各策略的当前频率和最高频率，单位为 kHz，返回 MHz 平均值
+func readCPUFrequency(root SystemRoot) (cur, max float64) {
+	var n int
+	for _, dir := range globSorted(root.sys("devices", "system", "cpu", "cpufreq", "policy*")) {
+		c, ok1 := readSysfsInt(filepath.Join(dir, "scaling_cur_freq"))
+		m, ok2 := readSysfsInt(filepath.Join(dir, "cpuinfo_max_freq"))
+		if !ok1 || !ok2 {
+			continue
+		}
+		cur += float64(c) / 1000
+		max += float64(m) / 1000
+		n++
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return cur / float64(n), max / float64(n)
+}
+
+// readThrottleCount 汇总 x86 CPU 的过热降频计数
+// 不支持 thermal_throttle 的平台（如 ARM）返回 false
+func readThrottleCount(root SystemRoot) (uint64, bool) {
+	var total uint64
+	found := false
+	for _, dir := range globSorted(root.sys("devices", "system", "cpu", "cpu*", "thermal_throttle")) {
+		for _, name := range []string{"core_throttle_count", "package_throttle_count"} {
+			if v, ok := readSysfsInt(filepath.Join(dir, name)); ok && v >= 0 {
+				total += uint64(v)
+				found = true
+			}
+		}
+	}
+	return total, found
+}
+
+// readPowerSupplies 读取 /sys/class/power_supply
+// scope 为 Device 的是鼠标、键盘等外设的电池，忽略
+func readPowerSupplies(root SystemRoot) []PowerSupply {
+	var supplies []PowerSupply
+	for _, dir := range globSorted(root.sys("class", "power_supply", "*")) {
+		kind := readSysfsString(filepath.Join(dir, "type"))
+		if kind == "" || readSysfsString(filepath.Join(dir, "scope")) == "Device" {
+			continue
+		}
+
+		supply := PowerSupply{
+			Name:     filepath.Base(dir),
+			Type:     kind,
+			Status:   readSysfsString(filepath.Join(dir, "status")),
+			Capacity: -1,
+		}
+		if online, ok := readSysfsInt(filepath.Join(dir, "online")); ok {
+			supply.Online = online != 0
+		} else {
+			// 电池没有 online 属性，在位即视为可用
+			present, ok := readSysfsInt(filepath.Join(dir, "present"))
+			supply.Online = !ok || present != 0
+		}
+		if capacity, ok := readSysfsInt(filepath.Join(dir, "capacity")); ok {
+			supply.Capacity = int(capacity)
+		}
+		// voltage_now 单位为 µV，power_now 单位为 µW
+		if v, ok := readSysfsInt(filepath.Join(dir, "voltage_now")); ok {
+			supply.Voltage = float64(v) / 1e6
+		}
+		if v, ok := readSysfsInt(filepath.Join(dir, "power_now")); ok {
+			supply.Power = float64(v) / 1e6
+		}
+		supplies = append(supplies, supply)
+	}
+	return supplies
+}
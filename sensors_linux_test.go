@@ -0,0 +1,62 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReadSensors(t *testing.T) {
+	s := readSensors(testdataRoot)
+	if s == nil {
+		t.Fatal("readSensors returned nil")
+	}
+
+	// thermal_zone1 没有 temp，跳过；thermal_zone10 排在 thermal_zone2 之后，没有 type 时以目录名为标签；
+	// hwmon1 的属性在 device 子目录下，芯片名称取自上级目录
+	wantTemps := []TemperatureSensor{
+		{Source: "thermal", Chip: "thermal_zone0", Label: "cpu-thermal", Celsius: 61.235, High: 80, Critical: 90},
+		{Source: "thermal", Chip: "thermal_zone2", Label: "gpu-thermal", Celsius: 55},
+		{Source: "thermal", Chip: "thermal_zone10", Label: "thermal_zone10", Celsius: 40.5},
+		{Source: "hwmon", Chip: "nct6775", Label: "SYSTIN", Celsius: 45, High: 80, Critical: 100},
+		{Source: "hwmon", Chip: "nct6775", Label: "temp2", Celsius: 52.5},
+		{Source: "hwmon", Chip: "legacy", Label: "temp1", Celsius: 38},
+	}
+	if fmt.Sprint(s.Temperatures) != fmt.Sprint(wantTemps) {
+		t.Errorf("Temperatures =\n%+v\nwant\n%+v", s.Temperatures, wantTemps)
+	}
+
+	wantFans := []FanSensor{{Chip: "nct6775", Label: "CPU Fan", RPM: 1200}, {Chip: "nct6775", Label: "fan2", RPM: 0}}
+	if fmt.Sprint(s.Fans) != fmt.Sprint(wantFans) {
+		t.Errorf("Fans = %+v, want %+v", s.Fans, wantFans)
+	}
+	if len(s.Cooling) != 1 || s.Cooling[0] != (CoolingDevice{Name: "cooling_device0", Type: "cpufreq-cpu0", CurState: 2, MaxState: 4}) {
+		t.Errorf("Cooling = %+v", s.Cooling)
+	}
+
+	// 外设电池 (scope=Device) 忽略
+	wantSupplies := []PowerSupply{
+		{Name: "AC", Type: "Mains", Online: true, Capacity: -1},
+		{Name: "BAT0", Type: "Battery", Status: "Discharging", Online: true, Capacity: 76, Voltage: 12.1, Power: 5.5},
+	}
+	if fmt.Sprint(s.PowerSupplies) != fmt.Sprint(wantSupplies) {
+		t.Errorf("PowerSupplies = %+v, want %+v", s.PowerSupplies, wantSupplies)
+	}
+
+	if s.CPUFreqMHz != 1050 || s.CPUMaxFreqMHz != 2100 {
+		t.Errorf("CPU frequency = %v/%v MHz, want 1050/2100", s.CPUFreqMHz, s.CPUMaxFreqMHz)
+	}
+	if !s.hasThrottleCount || s.throttleCount != 6 {
+		t.Errorf("throttle count = %d (%v), want 6", s.throttleCount, s.hasThrottleCount)
+	}
+	if hot := s.MaxTemperature(); hot == nil || hot.Label != "cpu-thermal" {
+		t.Errorf("MaxTemperature = %+v", hot)
+	}
+}
+
+func TestReadSensorsEmpty(t *testing.T) {
+	if s := readSensors(SystemRoot{Sys: t.TempDir()}); s != nil {
+		t.Errorf("readSensors on empty sysfs = %+v, want nil", s)
+	}
+}
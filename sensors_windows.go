@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+// readSensors Windows 下传感器需要通过 WMI 或厂商驱动读取，暂不支持
+func readSensors(root SystemRoot) *SensorStats {
+	return nil
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnauthorized 令牌无效或已过期，需要重新登录
+var ErrUnauthorized = errors.New("未登录或令牌已过期")
+
+// ApiError 服务端返回的业务错误
+type ApiError struct {
+	Action  string
+	Code    int
+	Message string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("%s 失败 (错误码 %d): %s", e.Action, e.Code, e.Message)
+}
+
+// apiResponse 星尘接口的统一响应格式，code 为 0 表示成功
+type apiResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// LoginRequest 节点登录请求
+type LoginRequest struct {
+	Code        string         `json:"code"` // 节点编码，即节点ID
+	ProductCode string         `json:"productCode"`
+	ClonedFrom  string         `json:"clonedFrom,omitempty"` // 克隆设备的原节点ID
+	Node        *LoginNodeInfo `json:"node"`
+}
+
+// LoginNodeInfo 登录时上报的节点信息，字段与星尘 NodeInfo 对应
+type LoginNodeInfo struct {
+	MachineName    string    `json:"machineName"`
+	NodeName       string    `json:"nodeName"`
+	Region         string    `json:"region"`
+	OSName         string    `json:"osName"`
+	OSVersion      string    `json:"osVersion"`
+	KernelVersion  string    `json:"kernelVersion"`
+	Architecture   string    `json:"architecture"`
+	Processor      string    `json:"processor"`
+	ProcessorCount int       `json:"processorCount"`
+	Memory         int64     `json:"memory"`
+	IP             string    `json:"ip"`
+	Macs           string    `json:"macs"`
+	Uptime         int64     `json:"uptime"` // 秒
+	TimeZone       string    `json:"timeZone"`
+	Version        string    `json:"version"`
+	Time           time.Time `json:"time"`
+}
+
+// LoginResponse 节点登录响应，服务端可能为新节点分配编码
+// 节点密钥只通过注册（enroll）下发，登录响应不再携带
+type LoginResponse struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	Token      string `json:"token"`
+	Expire     int    `json:"expire"`     // 令牌有效期（秒）
+	ServerTime int64  `json:"serverTime"` // Unix 毫秒
+
+	SecretRotate int64 `json:"secretRotate"` // 服务端要求的节点密钥轮换时间，Unix 毫秒，0 表示不轮换
+}
+
+// EnrollRequest 使用一次性注册码换取节点密钥
+type EnrollRequest struct {
+	EnrollCode  string         `json:"enrollCode"` // 注册码，短时间内有效且只能使用一次
+	Code        string         `json:"code"`       // 节点编码，即节点ID
+	ProductCode string         `json:"productCode"`
+	Node        *LoginNodeInfo `json:"node"`
+}
+
+// EnrollResponse 注册响应
+type EnrollResponse struct {
+	Secret       string `json:"secret"`
+	SecretRotate int64  `json:"secretRotate"` // 首次轮换时间，Unix 毫秒
+}
+
+// RotateSecretRequest 提交新的节点密钥，服务端确认后旧密钥失效
+type RotateSecretRequest struct {
+	Secret string `json:"secret"`
+}
+
+// RotateSecretResponse 轮换响应
+type RotateSecretResponse struct {
+	SecretRotate int64 `json:"secretRotate"` // 下次轮换时间，Unix 毫秒
+}
+
+// PingRequest 心跳请求，携带最新的指标快照和报告周期聚合
+type PingRequest struct {
+	CPURate            float64           `json:"cpuRate"` // 0~1
+	AvailableMemory    int64             `json:"availableMemory"`
+	AvailableFreeSpace int64             `json:"availableFreeSpace"`
+	Temperature        float64           `json:"temperature,omitempty"`
+	Battery            float64           `json:"battery,omitempty"` // 0~1
+	UplinkSpeed        int64             `json:"uplinkSpeed"`       // 字节/秒
+	DownlinkSpeed      int64             `json:"downlinkSpeed"`
+	ProcessCount       int               `json:"processCount,omitempty"`
+	Uptime             int64             `json:"uptime"`
+	Time               int64             `json:"time"`  // 本地时间，Unix 毫秒
+	Delay              int64             `json:"delay"` // 上一次心跳的往返耗时（毫秒）
+	Metrics            *NodeMetrics      `json:"metrics,omitempty"`
+	Aggregate          *MetricsAggregate `json:"aggregate,omitempty"`
+}
+
+// PingResponse 心跳响应，附带服务端排队等待下发的指令
+type PingResponse struct {
+	Time       int64           `json:"time"`       // 原样返回请求中的时间，用于计算往返耗时
+	ServerTime int64           `json:"serverTime"` // Unix 毫秒
+	Period     int             `json:"period"`     // 服务端建议的心跳间隔（秒），0 表示不调整
+	Token      string          `json:"token"`      // 令牌即将过期时服务端下发的新令牌
+	Commands   []ServerCommand `json:"commands"`
+
+	SecretRotate int64 `json:"secretRotate"` // 同 LoginResponse.SecretRotate，服务端可随时调整轮换计划
+}
+
+// ServerCommand 服务端下发的指令
+type ServerCommand struct {
+	ID       int64  `json:"id"`
+	Command  string `json:"command"`
+	Argument string `json:"argument"`
+	Expire   int64  `json:"expire"` // 过期时间，Unix 毫秒，0 表示不过期
+	TraceID  string `json:"traceId"`
+
+	// 服务端签名，节点注册后必须携带，见 VerifyCommand
+	Timestamp int64  `json:"timestamp"` // Unix 毫秒
+	Nonce     string `json:"nonce"`
+	Signature string `json:"signature"`
+}
+
+// CommandStatus 指令执行状态，与星尘 CommandStatus 对应
+type CommandStatus int
+
+const (
+	CommandReady     CommandStatus = 0 // 就绪
+	CommandHandling  CommandStatus = 1 // 处理中
+	CommandSucceeded CommandStatus = 2 // 已完成
+	CommandCancelled CommandStatus = 3 // 取消
+	CommandFailed    CommandStatus = 4 // 错误
+)
+
+// CommandReply 指令执行结果
+type CommandReply struct {
+	ID     int64         `json:"id"`
+	Status CommandStatus `json:"status"`
+	Data   string        `json:"data"`
+}
+
+// NodeEvent 节点事件，如过热告警、配置变更
+type NodeEvent struct {
+	Time   int64  `json:"time"` // Unix 毫秒
+	Type   string `json:"type"` // info、alert、error
+	Name   string `json:"name"`
+	Remark string `json:"remark"`
+}
+
+// StarClient 星尘节点协议客户端，每个请求都有独立的超时
+type StarClient struct {
+	baseURL string
+	http    *http.Client
+	tls     *tls.Config // 同时用于 WebSocket 指令通道
+	proxy   *proxySettings
+
+	mu     sync.RWMutex
+	token  string
+	nodeID string
+	secret string // 节点密钥，非空时对每个请求签名
+}
+
+// NewStarClient 创建星尘客户端，baseURL 形如 https://star.newlifex.com:443
+// tlsConfig 为 nil 时使用系统默认的证书校验，proxy 为 nil 时按环境变量选择代理
+func NewStarClient(baseURL string, timeout time.Duration, tlsConfig *tls.Config, proxy *proxySettings) *StarClient {
+	return &StarClient{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: timeout, Transport: newHTTPTransport(tlsConfig, proxy)},
+		tls:     tlsConfig,
+		proxy:   proxy,
+	}
+}
+
+// serverBaseURL 组合服务端地址和端口，端口为协议默认端口或地址中已指定端口时保持原样
+func serverBaseURL(c *AgentConfig) string {
+	u, err := url.Parse(c.ServerURL)
+	if err != nil || u.Port() != "" {
+		return strings.TrimRight(c.ServerURL, "/")
+	}
+	if (u.Scheme == "https" && c.ServerPort != 443) || (u.Scheme == "http" && c.ServerPort != 80) {
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(c.ServerPort))
+	}
+	return strings.TrimRight(u.String(), "/")
+}
+
+// Close 关闭空闲的 HTTP 连接
+func (c *StarClient) Close() {
+	c.http.CloseIdleConnections()
+}
+
+// Token 获取当前令牌
+func (c *StarClient) Token() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.token
+}
+
+// setToken 更新令牌
+func (c *StarClient) setToken(token string) {
+	c.mu.Lock()
+	c.token = token
+	c.mu.Unlock()
+}
+
+// Secret 获取签名使用的节点编码和节点密钥
+func (c *StarClient) Secret() (nodeID, secret string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nodeID, c.secret
+}
+
+// SetSecret 设置签名使用的节点密钥，secret 为空时不签名
+func (c *StarClient) SetSecret(nodeID, secret string) {
+	c.mu.Lock()
+	c.nodeID, c.secret = nodeID, secret
+	c.mu.Unlock()
+}
+
+// sign 使用节点密钥为请求签名，未设置节点密钥时不做处理
+func (c *StarClient) sign(header http.Header, method, path string, body []byte) error {
+	nodeID, secret := c.Secret()
+	if secret == "" {
+		return nil
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().UnixMilli()
+	header.Set(headerNodeCode, nodeID)
+	header.Set(headerTimestamp, strconv.FormatInt(timestamp, 10))
+	header.Set(headerNonce, nonce)
+	header.Set(headerSignature, signPayload(secret, canonicalPayload(method, path, body, timestamp, nonce)))
+	return nil
+}
+
+// Login 节点登录，成功后保存令牌用于后续请求
+func (c *StarClient) Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error) {
+	var resp LoginResponse
+	if err := c.invoke(ctx, http.MethodPost, "Node/Login", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Token == "" {
+		return nil, fmt.Errorf("登录响应缺少令牌")
+	}
+	c.setToken(resp.Token)
+	return &resp, nil
+}
+
+// Enroll 使用注册码换取节点密钥，不需要登录
+func (c *StarClient) Enroll(ctx context.Context, req *EnrollRequest) (*EnrollResponse, error) {
+	var resp EnrollResponse
+	if err := c.invoke(ctx, http.MethodPost, "Node/Enroll", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// RotateSecret 提交新的节点密钥
+func (c *StarClient) RotateSecret(ctx context.Context, req *RotateSecretRequest) (*RotateSecretResponse, error) {
+	var resp RotateSecretResponse
+	if err := c.invoke(ctx, http.MethodPost, "Node/RotateSecret", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Ping 发送心跳，服务端下发新令牌时自动替换
+func (c *StarClient) Ping(ctx context.Context, req *PingRequest) (*PingResponse, error) {
+	var resp PingResponse
+	if err := c.invoke(ctx, http.MethodPost, "Node/Ping", req, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Token != "" {
+		c.setToken(resp.Token)
+	}
+	return &resp, nil
+}
+
+// CommandReply 上报指令执行结果
+func (c *StarClient) CommandReply(ctx context.Context, reply *CommandReply) error {
+	return c.invoke(ctx, http.MethodPost, "Node/CommandReply", reply, nil)
+}
+
+// PostEvents 上报节点事件
+func (c *StarClient) PostEvents(ctx context.Context, events []NodeEvent) error {
+	return c.invoke(ctx, http.MethodPost, "Node/PostEvents", events, nil)
+}
+
+// PostReports 补报离线期间的状态报告，每一项为当时生成的 PingRequest，按时间顺序排列
+// 与 Ping 不同，补报不会刷新节点在线状态，也不会下发指令
+func (c *StarClient) PostReports(ctx context.Context, reports []json.RawMessage) error {
+	return c.invoke(ctx, http.MethodPost, "Node/PostReports", reports, nil)
+}
+
+// Probe 探测服务端是否可用：能完成 TLS 握手并返回非 5xx 响应即视为可用，不需要登录
+func (c *StarClient) Probe(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", AppName+"/"+Version)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Logout 节点注销，无论成功与否都清除本地令牌
+func (c *StarClient) Logout(ctx context.Context, reason string) error {
+	if c.Token() == "" {
+		return nil
+	}
+	err := c.invoke(ctx, http.MethodGet, "Node/Logout?reason="+url.QueryEscape(reason), nil, nil)
+	c.setToken("")
+	return err
+}
+
+// invoke 调用星尘接口并解析统一响应，result 为 nil 时忽略返回数据
+func (c *StarClient) invoke(ctx context.Context, method, action string, body, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("序列化 %s 请求失败: %v", action, err)
+		}
+		payload = data
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/"+action, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if err := c.sign(req.Header, method, req.URL.RequestURI(), payload); err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", AppName+"/"+Version)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := c.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求 %s 失败: %v", action, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10*1024*1024))
+	if err != nil {
+		return fmt.Errorf("读取 %s 响应失败: %v", action, err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return ErrUnauthorized
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("请求 %s 失败: HTTP %d %s", action, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var envelope apiResponse
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("解析 %s 响应失败: %v", action, err)
+	}
+	switch envelope.Code {
+	case 0:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	default:
+		return &ApiError{Action: action, Code: envelope.Code, Message: envelope.Message}
+	}
+
+	if result == nil || len(envelope.Data) == 0 || string(envelope.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Data, result); err != nil {
+		return fmt.Errorf("解析 %s 响应数据失败: %v", action, err)
+	}
+	return nil
+}
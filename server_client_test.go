@@ -0,0 +1,522 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// starStandIn 模拟星尘服务端的节点接口
+type starStandIn struct {
+	mu       sync.Mutex
+	token    string
+	logins   []LoginRequest
+	pings    []PingRequest
+	replies  []CommandReply
+	reports  []PingRequest // 补报的离线状态报告
+	events   []NodeEvent
+	pending  []ServerCommand // 下一次心跳下发的指令
+	logouts  int
+	delay    time.Duration // 每个请求的处理延迟
+	failCode int           // 非 0 时所有接口返回该业务错误码
+	badCPU   float64       // 非 0 时拒绝包含该 CPU 使用率的状态报告批次
+
+	enrollCode string   // 有效的注册码，使用一次后失效
+	secret     string   // 非空时登录必须使用该节点密钥签名
+	rotateAt   int64    // 登录和心跳响应中的轮换时间
+	rotations  []string // 节点提交的新密钥
+	signed     bool     // 要求请求使用 secret 签名
+	badSigns   int      // 签名校验失败的请求数
+
+	notify chan *websocket.Conn // 建立的指令通道
+	silent bool                 // 指令通道不读取数据，模拟半开连接（不回复 pong）
+}
+
+func newStarStandIn(t *testing.T) (*starStandIn, *httptest.Server) {
+	s := &starStandIn{token: "token-1", notify: make(chan *websocket.Conn, 1)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/Node/Login", s.handle(false, func(r *http.Request) interface{} {
+		var req LoginRequest
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		s.logins = append(s.logins, req)
+		if s.secret != "" && !s.checkSignature(r, body) {
+			return &ApiError{Code: 401, Message: "节点密钥错误"}
+		}
+		return LoginResponse{Code: req.Code, Name: req.Node.NodeName, Token: s.token, Expire: 7200, SecretRotate: s.rotateAt}
+	}))
+	mux.HandleFunc("/Node/Enroll", s.handle(false, func(r *http.Request) interface{} {
+		var req EnrollRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.EnrollCode == "" || req.EnrollCode != s.enrollCode {
+			return &ApiError{Code: 500, Message: "注册码无效"}
+		}
+		s.enrollCode = ""
+		s.secret = "secret-" + req.Code
+		return EnrollResponse{Secret: s.secret, SecretRotate: s.rotateAt}
+	}))
+	mux.HandleFunc("/Node/RotateSecret", s.handle(true, func(r *http.Request) interface{} {
+		var req RotateSecretRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		s.rotations = append(s.rotations, req.Secret)
+		s.secret = req.Secret
+		s.rotateAt = time.Now().Add(30 * 24 * time.Hour).UnixMilli()
+		return RotateSecretResponse{SecretRotate: s.rotateAt}
+	}))
+	mux.HandleFunc("/Node/Ping", s.handle(true, func(r *http.Request) interface{} {
+		var req PingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		s.pings = append(s.pings, req)
+		resp := PingResponse{Time: req.Time, ServerTime: time.Now().UnixMilli(), Commands: s.pending, SecretRotate: s.rotateAt}
+		s.pending = nil
+		return resp
+	}))
+	mux.HandleFunc("/Node/CommandReply", s.handle(true, func(r *http.Request) interface{} {
+		var reply CommandReply
+		json.NewDecoder(r.Body).Decode(&reply)
+		s.replies = append(s.replies, reply)
+		return nil
+	}))
+	mux.HandleFunc("/Node/PostReports", s.handle(true, func(r *http.Request) interface{} {
+		var reports []PingRequest
+		json.NewDecoder(r.Body).Decode(&reports)
+		for _, report := range reports {
+			if s.badCPU != 0 && report.CPURate == s.badCPU {
+				return &ApiError{Code: 500, Message: "报告数据无效"}
+			}
+		}
+		s.reports = append(s.reports, reports...)
+		return nil
+	}))
+	mux.HandleFunc("/Node/PostEvents", s.handle(true, func(r *http.Request) interface{} {
+		var events []NodeEvent
+		json.NewDecoder(r.Body).Decode(&events)
+		s.events = append(s.events, events...)
+		return nil
+	}))
+	mux.HandleFunc("/Node/Logout", s.handle(true, func(r *http.Request) interface{} {
+		s.logouts++
+		return nil
+	}))
+
+	mux.HandleFunc("/node/notify", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		token, silent := s.token, s.silent
+		badSign := s.signed && !s.checkSignature(r, nil)
+		s.mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer "+token || badSign {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		if !silent {
+			// 读取数据才会自动回复 pong
+			go func() {
+				for {
+					if _, _, err := conn.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+		s.notify <- conn
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+// handle 包装接口处理函数：校验令牌并输出统一响应，处理函数返回 *ApiError 时输出业务错误
+func (s *starStandIn) handle(auth bool, fn func(r *http.Request) interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		delay, failCode := s.delay, s.failCode
+		s.mu.Unlock()
+		time.Sleep(delay)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if auth && r.Header.Get("Authorization") != "Bearer "+s.token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if s.signed && r.URL.Path != "/Node/Enroll" && !s.checkSignature(r, body) {
+			s.badSigns++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if failCode != 0 {
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": failCode, "message": "服务端错误"})
+			return
+		}
+		data := fn(r)
+		if apiErr, ok := data.(*ApiError); ok {
+			json.NewEncoder(w).Encode(map[string]interface{}{"code": apiErr.Code, "message": apiErr.Message})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "data": data})
+	}
+}
+
+// checkSignature 按节点密钥校验请求签名
+func (s *starStandIn) checkSignature(r *http.Request, body []byte) bool {
+	timestamp, _ := strconv.ParseInt(r.Header.Get(headerTimestamp), 10, 64)
+	payload := canonicalPayload(r.Method, r.URL.RequestURI(), body, timestamp, r.Header.Get(headerNonce))
+	return s.secret != "" && r.Header.Get(headerSignature) == signPayload(s.secret, payload)
+}
+
+func TestStarClientLoginPingLogout(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	standIn.pending = []ServerCommand{{ID: 7, Command: "ps", Argument: `{"sort":"memory"}`}}
+	client := NewStarClient(server.URL, time.Second, nil, nil)
+	ctx := context.Background()
+
+	resp, err := client.Login(ctx, &LoginRequest{
+		Code:        "node-1",
+		ProductCode: ProductCode,
+		ClonedFrom:  "node-0",
+		Node:        &LoginNodeInfo{NodeName: "gw-01", ProcessorCount: 4},
+	})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if resp.Token != "token-1" || client.Token() != "token-1" {
+		t.Fatalf("token = %q/%q, want token-1", resp.Token, client.Token())
+	}
+	if got := standIn.logins[0]; got.Code != "node-1" || got.ClonedFrom != "node-0" || got.Node.ProcessorCount != 4 {
+		t.Fatalf("login request = %+v", got)
+	}
+
+	ping, err := client.Ping(ctx, &PingRequest{CPURate: 0.25, Time: 42})
+	if err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if ping.Time != 42 || len(ping.Commands) != 1 || ping.Commands[0].Command != "ps" {
+		t.Fatalf("ping response = %+v", ping)
+	}
+	if standIn.pings[0].CPURate != 0.25 {
+		t.Fatalf("ping cpuRate = %v, want 0.25", standIn.pings[0].CPURate)
+	}
+
+	if err := client.CommandReply(ctx, &CommandReply{ID: 7, Status: CommandSucceeded, Data: "ok"}); err != nil {
+		t.Fatalf("CommandReply: %v", err)
+	}
+	if len(standIn.replies) != 1 || standIn.replies[0].ID != 7 {
+		t.Fatalf("replies = %+v", standIn.replies)
+	}
+
+	if err := client.Logout(ctx, "test"); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if standIn.logouts != 1 || client.Token() != "" {
+		t.Fatalf("logouts = %d, token = %q", standIn.logouts, client.Token())
+	}
+}
+
+func TestStarClientUnauthorized(t *testing.T) {
+	_, server := newStarStandIn(t)
+	client := NewStarClient(server.URL, time.Second, nil, nil)
+
+	_, err := client.Ping(context.Background(), &PingRequest{})
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Ping without login: err = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestStarClientApiError(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	standIn.failCode = 500
+	client := NewStarClient(server.URL, time.Second, nil, nil)
+
+	_, err := client.Login(context.Background(), &LoginRequest{Code: "node-1", Node: &LoginNodeInfo{}})
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) || apiErr.Code != 500 {
+		t.Fatalf("Login: err = %v, want ApiError 500", err)
+	}
+}
+
+func TestStarClientTimeout(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	standIn.delay = 200 * time.Millisecond
+	client := NewStarClient(server.URL, 50*time.Millisecond, nil, nil)
+
+	start := time.Now()
+	if _, err := client.Login(context.Background(), &LoginRequest{Code: "node-1", Node: &LoginNodeInfo{}}); err == nil {
+		t.Fatal("Login: expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("Login took %v, timeout not applied", elapsed)
+	}
+}
+
+func TestServerBaseURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		port int
+		want string
+	}{
+		{"https://star.newlifex.com", 443, "https://star.newlifex.com"},
+		{"https://star.newlifex.com/", 6600, "https://star.newlifex.com:6600"},
+		{"http://10.0.0.1", 80, "http://10.0.0.1"},
+		{"http://10.0.0.1:6600", 443, "http://10.0.0.1:6600"},
+	}
+	for _, tt := range tests {
+		if got := serverBaseURL(&AgentConfig{ServerURL: tt.url, ServerPort: tt.port}); got != tt.want {
+			t.Errorf("serverBaseURL(%q, %d) = %q, want %q", tt.url, tt.port, got, tt.want)
+		}
+	}
+}
+
+// newTestAgentService 创建连接到模拟服务端的代理服务，不加载配置文件也不写日志文件
+func newTestAgentService(t *testing.T, serverURL string) *AgentService {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	config := getDefaultConfig()
+	config.ServerURL = serverURL
+	config.NodeID = "node-test"
+	config.ServerTimeout = time.Second
+
+	dataDir := t.TempDir()
+	config.DataDir = dataDir
+	history, _ := openMetricsHistory(dataDir, time.Hour)
+	t.Cleanup(history.Close)
+	outbox, _ := openOutbox(filepath.Join(dataDir, outboxDirName), 1024*1024, time.Hour)
+
+	return &AgentService{
+		ctx:          ctx,
+		cancel:       cancel,
+		config:       config,
+		logger:       log.New(io.Discard, "", 0),
+		logLevel:     LogLevelError,
+		nodeInfo:     &NodeInfo{Hostname: "test", CPUCores: 2},
+		stats:        newAgentStats(),
+		conn:         newConnectionTracker(""),
+		endpoints:    newEndpointSelector(""),
+		nonces:       newNonceCache("", maxNonces),
+		history:      history,
+		commandQueue: make(chan ServerCommand, 64),
+		commandSlots: make(chan struct{}, maxConcurrentCommands),
+		connLost:     make(chan struct{}, 1),
+		serverReset:  make(chan struct{}, 1),
+		outbox:       outbox,
+		flushNow:     make(chan struct{}, 1),
+		alerts:       make(map[string]bool),
+	}
+}
+
+func TestAgentServiceSession(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	standIn.pending = []ServerCommand{{ID: 9, Command: "ps", Argument: `{"limit":1}`}}
+	a := newTestAgentService(t, server.URL)
+
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("connectToServer: %v", err)
+	}
+	if standIn.logins[0].Code != "node-test" || standIn.logins[0].Node.MachineName != "test" {
+		t.Fatalf("login request = %+v", standIn.logins[0])
+	}
+
+	metrics := &NodeMetrics{Time: time.Now(), CPUUsage: 50, MemoryAvailable: 1024}
+	a.metricsMu.Lock()
+	a.latestMetrics = metrics
+	a.metricsMu.Unlock()
+	a.history.Add(sampleFromMetrics(metrics))
+
+	a.reportNodeStatus(time.Now().Add(-time.Minute))
+	if len(standIn.pings) != 1 || standIn.pings[0].CPURate != 0.5 || standIn.pings[0].Aggregate == nil {
+		t.Fatalf("pings = %+v", standIn.pings)
+	}
+
+	// 心跳中收到的指令进入队列，执行后回复结果（未注册节点只执行只读指令）
+	a.handleCommand(<-a.commandQueue)
+	if len(standIn.replies) != 2 || standIn.replies[1].ID != 9 || standIn.replies[1].Status != CommandSucceeded {
+		t.Fatalf("replies = %+v", standIn.replies)
+	}
+
+	// 令牌失效时心跳失败，通知重新登录
+	standIn.mu.Lock()
+	standIn.token = "token-2"
+	standIn.mu.Unlock()
+	a.reportNodeStatus(time.Now())
+	select {
+	case <-a.connLost:
+	default:
+		t.Fatal("expected connLost after unauthorized ping")
+	}
+
+	// 服务停止时注销登录
+	standIn.mu.Lock()
+	standIn.token = "token-1"
+	standIn.mu.Unlock()
+	a.cancel()
+	a.handleServerCommands(newBackoff(time.Millisecond, time.Second))
+	if standIn.logouts != 1 {
+		t.Fatalf("logouts = %d, want 1", standIn.logouts)
+	}
+}
+
+// setShortHeartbeat 缩短指令通道心跳参数，测试结束后恢复
+func setShortHeartbeat(t *testing.T) {
+	ping, pong := wsPingInterval, wsPongWait
+	wsPingInterval, wsPongWait = 50*time.Millisecond, 300*time.Millisecond
+	t.Cleanup(func() { wsPingInterval, wsPongWait = ping, pong })
+}
+
+func TestCommandChannelDeliversCommands(t *testing.T) {
+	setShortHeartbeat(t)
+	standIn, server := newStarStandIn(t)
+	a := newTestAgentService(t, server.URL)
+	connectRegistered(t, standIn, a)
+
+	done := make(chan struct{})
+	go func() {
+		a.handleServerCommands(newBackoff(time.Millisecond, time.Second))
+		close(done)
+	}()
+	conn := <-standIn.notify
+
+	// 经过多个心跳周期后连接仍然保持
+	time.Sleep(500 * time.Millisecond)
+	if err := conn.WriteJSON(signTestCommand(ServerCommand{ID: 11, Command: "unknown"})); err != nil {
+		t.Fatalf("push command: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		standIn.mu.Lock()
+		n := len(standIn.replies)
+		standIn.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("command pushed over channel was not answered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	a.cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handleServerCommands did not return after cancel")
+	}
+	if standIn.logouts != 1 {
+		t.Fatalf("logouts = %d, want 1", standIn.logouts)
+	}
+}
+
+func TestCommandChannelDetectsHalfOpen(t *testing.T) {
+	setShortHeartbeat(t)
+	standIn, server := newStarStandIn(t)
+	standIn.silent = true
+	a := newTestAgentService(t, server.URL)
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("connectToServer: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.handleServerCommands(newBackoff(time.Millisecond, time.Second))
+		close(done)
+	}()
+	<-standIn.notify
+
+	// 对端不再回复 pong，超过 wsPongWait 后应断开并返回
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("half-open connection was not detected")
+	}
+}
+
+func TestOfflineReportsReplayedInOrder(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	a := newTestAgentService(t, server.URL)
+
+	// 未连接时的报告和事件写入离线队列
+	for i := 1; i <= 3; i++ {
+		a.metricsMu.Lock()
+		a.latestMetrics = &NodeMetrics{Time: time.Now(), CPUUsage: float64(i * 10)}
+		a.metricsMu.Unlock()
+		a.reportNodeStatus(time.Now())
+	}
+	a.recordEvent(eventAlert, "overheat", "cpu 90°C")
+	if count, _ := a.outbox.Len(); count != 4 {
+		t.Fatalf("outbox length = %d, want 4", count)
+	}
+
+	// 重新连接后，下一次报告成功即按顺序补报
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("connectToServer: %v", err)
+	}
+	a.reportNodeStatus(time.Now())
+
+	if len(standIn.reports) != 3 {
+		t.Fatalf("replayed reports = %d, want 3", len(standIn.reports))
+	}
+	for i, r := range standIn.reports {
+		if want := float64(i+1) / 10; r.CPURate != want {
+			t.Fatalf("report %d cpuRate = %v, want %v", i, r.CPURate, want)
+		}
+	}
+	if len(standIn.events) != 1 || standIn.events[0].Name != "overheat" {
+		t.Fatalf("replayed events = %+v", standIn.events)
+	}
+	if count, _ := a.outbox.Len(); count != 0 {
+		t.Fatalf("outbox length after replay = %d, want 0", count)
+	}
+}
+
+func TestOfflineReportRejectedByServer(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	standIn.badCPU = 0.2
+	a := newTestAgentService(t, server.URL)
+
+	for i := 1; i <= 3; i++ {
+		a.queueOutbox(outboxReport, &PingRequest{CPURate: float64(i) / 10})
+	}
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("connectToServer: %v", err)
+	}
+
+	// 服务端拒绝整批时逐条重发，只丢弃被拒绝的报告，其余报告按顺序补报，不再反复重试
+	a.flushOutbox(a.client)
+	if len(standIn.reports) != 2 || standIn.reports[0].CPURate != 0.1 || standIn.reports[1].CPURate != 0.3 {
+		t.Fatalf("replayed reports = %+v", standIn.reports)
+	}
+	if len(standIn.events) != 1 || standIn.events[0].Name != "outbox_rejected" || standIn.events[0].Type != eventAlert {
+		t.Fatalf("events = %+v", standIn.events)
+	}
+	if count, _ := a.outbox.Len(); count != 0 {
+		t.Fatalf("outbox length after replay = %d, want 0", count)
+	}
+
+	// 网络错误等可重试的失败保留消息
+	a.queueOutbox(outboxReport, &PingRequest{CPURate: 0.4})
+	server.Close()
+	a.flushOutbox(a.client)
+	if count, _ := a.outbox.Len(); count != 1 {
+		t.Fatalf("outbox length after network error = %d, want 1", count)
+	}
+}
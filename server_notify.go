@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 指令通道的心跳参数
+// 每隔 wsPingInterval 发送一次 ping，超过 wsPongWait 没有收到任何数据（包括 pong）即判定连接已失效，
+// 可以发现 NAT 超时、对端断电等不会触发 TCP 断开的半开连接
+var (
+	wsPingInterval = 20 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsWriteWait    = 10 * time.Second
+)
+
+// notifyDialError 登录成功但指令通道建立失败，与登录失败一样计入服务端地址的可用性，
+// 避免服务端只有 HTTP 接口可用时一直停留在该地址上
+type notifyDialError struct {
+	err error
+}
+
+func (e *notifyDialError) Error() string {
+	return e.err.Error()
+}
+
+// notifyURL 指令通道地址，http/https 分别对应 ws/wss
+func (c *StarClient) notifyURL() string {
+	u := c.baseURL + "/node/notify"
+	if rest, ok := strings.CutPrefix(u, "https://"); ok {
+		return "wss://" + rest
+	}
+	if rest, ok := strings.CutPrefix(u, "http://"); ok {
+		return "ws://" + rest
+	}
+	return u
+}
+
+// DialNotify 建立 WebSocket 指令通道，使用登录令牌认证
+func (c *StarClient) DialNotify(ctx context.Context) (*websocket.Conn, error) {
+	target, err := url.Parse(c.notifyURL())
+	if err != nil {
+		return nil, fmt.Errorf("指令通道地址无效: %v", err)
+	}
+	dialer := websocket.Dialer{
+		NetDialContext:   c.proxy.DialContext(target),
+		HandshakeTimeout: c.http.Timeout,
+		TLSClientConfig:  c.tls,
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.Token())
+	header.Set("User-Agent", AppName+"/"+Version)
+	if err := c.sign(header, http.MethodGet, target.RequestURI(), nil); err != nil {
+		return nil, err
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, c.notifyURL(), header)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+			return nil, ErrUnauthorized
+		}
+		if resp != nil {
+			return nil, fmt.Errorf("建立指令通道失败: HTTP %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("建立指令通道失败: %v", err)
+	}
+	return conn, nil
+}
+
+// readCommands 持续读取指令通道中的消息，直到连接断开
+// 每收到一条消息或 pong 都会延长读取期限，超时未收到任何数据时 ReadMessage 返回错误
+func readCommands(conn *websocket.Conn, handle func(cmd ServerCommand), invalid func(data []byte)) error {
+	conn.SetReadLimit(1024 * 1024)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		if kind != websocket.TextMessage {
+			continue
+		}
+
+		var cmd ServerCommand
+		if err := json.Unmarshal(data, &cmd); err != nil || cmd.Command == "" {
+			invalid(data)
+			continue
+		}
+		handle(cmd)
+	}
+}
+
+// handleServerCommands 通过 WebSocket 指令通道接收服务端指令，心跳响应中的指令同样在这里执行
+// 服务停止或服务端配置变更时注销登录并返回 nil；通道断开或心跳失败时返回原因，由 runServerConnection 重新登录
+// 指令通道建立后重置退避计数
+func (a *AgentService) handleServerCommands(retry *backoff) error {
+	client := a.getClient()
+	if client == nil {
+		return fmt.Errorf("尚未登录")
+	}
+
+	conn, err := client.DialNotify(a.ctx)
+	if err != nil {
+		if a.ctx.Err() != nil {
+			a.logout("服务停止")
+			return nil
+		}
+		// 本次会话不再使用，注销后再切换地址或重试
+		a.logout("指令通道建立失败")
+		return &notifyDialError{err: err}
+	}
+	defer conn.Close()
+
+	a.endpointConnected()
+	a.conn.set(StateConnected, "")
+	a.stats.setComponent(componentServer, true)
+	retry.Reset()
+	notifyReset(a.flushNow)
+	a.logger.Printf("👂 指令通道已建立，开始监听服务端指令...")
+
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- readCommands(conn, a.enqueueCommand, func(data []byte) {
+			a.logWarn("⚠️ 忽略无法识别的指令消息: %s", truncateString(string(data), 200))
+		})
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	// 连接在低优先级地址上时定期探测更高优先级的地址
+	var probe <-chan time.Time
+	if index, _ := a.endpoints.Current(); index > 0 {
+		ticker := time.NewTicker(a.getConfig().ServerProbeInterval)
+		defer ticker.Stop()
+		probe = ticker.C
+	}
+
+	// closeChannel 主动关闭指令通道并等待读取协程退出
+	closeChannel := func() {
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteWait))
+		conn.Close()
+		<-readErr
+	}
+
+	for {
+		select {
+		case <-a.ctx.Done():
+			closeChannel()
+			// 等待执行中的指令回复取消结果后再注销
+			a.commandWG.Wait()
+			a.logout("服务停止")
+			return nil
+		case <-a.serverReset:
+			// 服务端配置已变更，断开后由 runServerConnection 重新连接
+			a.logger.Printf("🔗 服务端配置已变更，重新连接")
+			closeChannel()
+			a.logout("配置变更")
+			return nil
+		case <-a.connLost:
+			closeChannel()
+			return fmt.Errorf("会话已失效")
+		case err := <-readErr:
+			return fmt.Errorf("指令通道已断开: %v", err)
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				conn.Close()
+				<-readErr
+				return fmt.Errorf("指令通道心跳发送失败: %v", err)
+			}
+		case <-probe:
+			if endpoint := a.probePreferredEndpoint(); endpoint != "" {
+				a.logInfo("🔀 优先级更高的服务端 %s 已恢复，切换回去", endpoint)
+				closeChannel()
+				a.logout("切换服务端")
+				a.endpoints.SwitchTo(endpoint)
+				return nil
+			}
+		case cmd := <-a.commandQueue:
+			a.dispatchCommand(cmd)
+		}
+	}
+}
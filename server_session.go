@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ProductCode 登录时上报的产品编码
+const ProductCode = "GoAgent"
+
+// connectToServer 登录服务端，成功后保存客户端用于心跳和指令回复
+func (a *AgentService) connectToServer() error {
+	config := a.getConfig()
+	a.endpoints.Update(serverEndpoints(config))
+	_, baseURL := a.endpoints.Current()
+	a.logger.Printf("🔗 正在连接服务端 %s...", baseURL)
+	a.conn.set(StateConnecting, baseURL)
+
+	client, err := a.newStarClient(config, baseURL)
+	if err != nil {
+		return err
+	}
+	if target, err := url.Parse(baseURL); err == nil {
+		if proxyURL, _ := client.proxy.ProxyURL(target); proxyURL != nil {
+			a.logInfo("🔗 通过代理 %s 连接服务端", proxyURL.Redacted())
+		}
+	}
+	a.conn.set(StateAuthenticating, baseURL)
+	creds := a.loadNodeCredentials(config)
+	a.credMu.Lock()
+	a.credentials = creds
+	a.credMu.Unlock()
+
+	// 登录请求使用节点密钥签名证明持有密钥，密钥本身不发送
+	req := a.loginRequest(config)
+	if creds != nil {
+		client.SetSecret(config.NodeID, creds.Secret)
+	}
+	resp, err := client.Login(a.ctx, req)
+	if errors.Is(err, ErrUnauthorized) && creds != nil && creds.PendingSecret != "" {
+		// 上一次轮换提交后没有收到确认，服务端可能已经接受了新密钥
+		client.SetSecret(config.NodeID, creds.PendingSecret)
+		if resp, err = client.Login(a.ctx, req); err == nil {
+			a.logInfo("🔑 服务端已接受上一次轮换的节点密钥")
+			a.credMu.Lock()
+			creds.Secret, creds.PendingSecret = creds.PendingSecret, ""
+			creds.IssuedAt = time.Now()
+			if err := saveCredentials(config.DataDir, creds); err != nil {
+				a.logWarn("⚠️ 保存节点密钥失败: %v", err)
+			}
+			a.credMu.Unlock()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Code != "" && resp.Code != config.NodeID {
+		a.logWarn("⚠️ 服务端返回的节点编码 %s 与本地节点ID %s 不一致", resp.Code, config.NodeID)
+	}
+	if resp.Name != "" {
+		a.logInfo("🔗 服务端节点名称: %s", resp.Name)
+	}
+	if creds != nil && resp.ServerTime > 0 {
+		if offset := time.Since(time.UnixMilli(resp.ServerTime)); offset > config.ServerClockSkew || offset < -config.ServerClockSkew {
+			a.logWarn("⚠️ 本机时间与服务端相差 %v，超出 server.clock_skew，服务端指令将被拒绝，请校准时间", offset.Round(time.Second))
+		}
+	}
+	a.checkSecretRotation(client, resp.SecretRotate)
+
+	// 丢弃上一次会话遗留的断线通知
+	select {
+	case <-a.connLost:
+	default:
+	}
+	a.setClient(client)
+	return nil
+}
+
+// newServerClient 按配置中的 TLS 和代理设置创建服务端客户端，logf 输出证书重新加载等日志，可为 nil
+func newServerClient(config *AgentConfig, baseURL string, logf func(format string, v ...interface{})) (*StarClient, error) {
+	settings, err := newServerTLS(config, logf)
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := newProxySettings(config)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的服务端地址 %s: %v", baseURL, err)
+	}
+	return NewStarClient(baseURL, config.ServerTimeout, settings.Config(u.Hostname()), proxy), nil
+}
+
+// newStarClient 创建服务端客户端，日志写入代理日志
+func (a *AgentService) newStarClient(config *AgentConfig, baseURL string) (*StarClient, error) {
+	return newServerClient(config, baseURL, a.logInfo)
+}
+
+// logout 注销登录，使用独立的超时，避免服务停止时请求被立即取消
+func (a *AgentService) logout(reason string) {
+	client := a.getClient()
+	if client == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.getConfig().ServerTimeout)
+	defer cancel()
+	if err := client.Logout(ctx, reason); err != nil {
+		a.logWarn("⚠️ 注销登录失败: %v", err)
+		return
+	}
+	a.logger.Printf("🔗 已从服务端注销 (%s)", reason)
+}
+
+// sendPing 发送心跳，把响应中的指令放入待执行队列
+func (a *AgentService) sendPing(client *StarClient, req *PingRequest) error {
+	a.serverMu.RLock()
+	req.Delay = a.pingDelay.Milliseconds()
+	a.serverMu.RUnlock()
+
+	start := time.Now()
+	resp, err := client.Ping(a.ctx, req)
+	if err != nil {
+		return err
+	}
+
+	a.serverMu.Lock()
+	a.pingDelay = time.Since(start)
+	a.serverMu.Unlock()
+
+	for _, cmd := range resp.Commands {
+		a.enqueueCommand(cmd)
+	}
+	a.checkSecretRotation(client, resp.SecretRotate)
+	return nil
+}
+
+// enqueueCommand 将指令放入待执行队列，队列已满时丢弃
+func (a *AgentService) enqueueCommand(cmd ServerCommand) {
+	select {
+	case a.commandQueue <- cmd:
+	default:
+		a.logWarn("⚠️ 待执行指令过多，丢弃指令 %s [%d]", cmd.Command, cmd.ID)
+	}
+}
+
+// getClient 获取已登录的服务端客户端，未连接时返回 nil
+func (a *AgentService) getClient() *StarClient {
+	a.serverMu.RLock()
+	defer a.serverMu.RUnlock()
+	return a.client
+}
+
+// setClient 设置已登录的服务端客户端
+func (a *AgentService) setClient(client *StarClient) {
+	a.serverMu.Lock()
+	old := a.client
+	a.client = client
+	a.serverMu.Unlock()
+
+	// 每个客户端有独立的连接池，替换后关闭旧客户端的空闲连接
+	if old != nil && old != client {
+		old.Close()
+	}
+}
+
+// loginRequest 构造登录请求
+func (a *AgentService) loginRequest(config *AgentConfig) *LoginRequest {
+	req := &LoginRequest{
+		Code:        config.NodeID,
+		ProductCode: ProductCode,
+		Node:        buildLoginNodeInfo(a.nodeInfo, config),
+	}
+	if a.identity != nil {
+		req.ClonedFrom = a.identity.ClonedFrom
+	}
+	return req
+}
+
+// buildLoginNodeInfo 将节点信息转换为登录上报格式
+func buildLoginNodeInfo(info *NodeInfo, config *AgentConfig) *LoginNodeInfo {
+	node := &LoginNodeInfo{
+		NodeName: config.NodeName,
+		Region:   config.NodeRegion,
+		Version:  Version,
+		Time:     time.Now(),
+	}
+	if info == nil {
+		return node
+	}
+
+	node.MachineName = info.Hostname
+	node.OSName = info.OSName
+	node.OSVersion = info.OSVersion
+	node.KernelVersion = info.KernelVersion
+	node.Architecture = info.Arch
+	node.Processor = info.CPUModel
+	node.ProcessorCount = info.CPUCores
+	node.Memory = info.TotalMemory
+	node.TimeZone = info.Timezone
+	if !info.BootTime.IsZero() {
+		node.Uptime = int64(time.Since(info.BootTime).Seconds())
+	}
+
+	var ips, macs []string
+	for _, iface := range info.Interfaces {
+		if iface.MAC != "" {
+			macs = append(macs, iface.MAC)
+		}
+		for _, addr := range iface.Addrs {
+			if ip, _, err := net.ParseCIDR(addr); err == nil && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() {
+				ips = append(ips, ip.String())
+			}
+		}
+	}
+	node.IP = strings.Join(ips, ",")
+	node.Macs = strings.Join(macs, ",")
+	return node
+}
+
+// buildPingRequest 根据指标快照构造心跳请求
+func buildPingRequest(m *NodeMetrics, aggregate *MetricsAggregate, info *NodeInfo) *PingRequest {
+	req := &PingRequest{
+		CPURate:         m.CPUUsage / 100,
+		AvailableMemory: m.MemoryAvailable,
+		Time:            time.Now().UnixMilli(),
+		Metrics:         m,
+		Aggregate:       aggregate,
+	}
+	if d := m.MaxDiskUsage(); d != nil {
+		req.AvailableFreeSpace = d.Free
+	}
+	for _, n := range m.Network {
+		req.DownlinkSpeed += int64(n.RxBytesRate)
+		req.UplinkSpeed += int64(n.TxBytesRate)
+	}
+	if m.Sensors != nil {
+		if t := m.Sensors.MaxTemperature(); t != nil {
+			req.Temperature = t.Celsius
+		}
+		if b := m.Sensors.Battery(); b != nil && b.Capacity >= 0 {
+			req.Battery = float64(b.Capacity) / 100
+		}
+	}
+	if m.Processes != nil {
+		req.ProcessCount = m.Processes.Total
+	}
+	if info != nil && !info.BootTime.IsZero() {
+		req.Uptime = int64(time.Since(info.BootTime).Seconds())
+	}
+	return req
+}
+
+// outboxBatchSize 每次补报的最大消息数
+const outboxBatchSize = 50
+
+// queueOutbox 将未能发送的报告或事件写入离线队列
+func (a *AgentService) queueOutbox(kind string, payload interface{}) {
+	dropped, err := a.outbox.Push(kind, payload)
+	if err != nil {
+		a.logWarn("⚠️ %v", err)
+		return
+	}
+	if dropped > 0 {
+		a.logWarn("⚠️ 离线队列已满，丢弃最旧的 %d 条消息", dropped)
+	}
+}
+
+// flushOutbox 按顺序补报离线队列中的消息，连续的同类消息合并为一个请求
+// 网络错误等可重试的失败保留剩余消息，等待下一次重试；
+// 服务端拒绝（业务错误）时逐条重发找出被拒绝的消息并丢弃，避免一条消息阻塞整个队列
+func (a *AgentService) flushOutbox(client *StarClient) {
+	sent, single := 0, false
+	defer func() {
+		if sent > 0 {
+			count, size := a.outbox.Len()
+			a.logInfo("📤 已补报 %d 条离线消息，队列剩余 %d 条 (%s)", sent, count, formatBytes(size))
+		}
+	}()
+
+	for a.ctx.Err() == nil {
+		items := a.outbox.Peek(outboxBatchSize)
+		if len(items) == 0 {
+			return
+		}
+
+		batch := items[:1]
+		for !single && len(batch) < len(items) && items[len(batch)].Kind == items[0].Kind {
+			batch = items[:len(batch)+1]
+		}
+		err := a.postOutboxBatch(client, batch)
+		var apiErr *ApiError
+		switch {
+		case err == nil:
+			sent += len(batch)
+		case !errors.As(err, &apiErr):
+			a.logWarn("⚠️ 补报离线消息失败: %v", err)
+			return
+		case len(batch) > 1:
+			single = true
+			continue
+		default:
+			a.rejectOutboxItem(batch[0], apiErr)
+		}
+		a.outbox.Remove(batch)
+	}
+}
+
+// rejectOutboxItem 丢弃被服务端拒绝的离线消息并记录事件
+// 被拒绝的是事件时只记录日志，避免新事件再次被拒绝而循环产生事件
+func (a *AgentService) rejectOutboxItem(item QueueItem, err *ApiError) {
+	a.logWarn("⚠️ 服务端拒绝离线消息 (%s, %s)，已丢弃: %v", item.Kind, item.Time.Format(time.DateTime), err)
+	if item.Kind != outboxEvent {
+		a.recordEvent(eventAlert, "outbox_rejected", fmt.Sprintf("%s: %v", item.Kind, err))
+	}
+}
+
+// postOutboxBatch 发送一批同类离线消息
+func (a *AgentService) postOutboxBatch(client *StarClient, batch []QueueItem) error {
+	switch batch[0].Kind {
+	case outboxReport:
+		reports := make([]json.RawMessage, len(batch))
+		for i, item := range batch {
+			reports[i] = item.Payload
+		}
+		return client.PostReports(a.ctx, reports)
+	case outboxEvent:
+		var events []NodeEvent
+		for _, item := range batch {
+			var e NodeEvent
+			if json.Unmarshal(item.Payload, &e) == nil {
+				events = append(events, e)
+			}
+		}
+		return client.PostEvents(a.ctx, events)
+	default:
+		// 未知类型（如新版本写入后回退到旧版本），直接丢弃
+		return nil
+	}
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+)
+
+// isRunningAsService 检查是否由 systemd 托管运行
+// systemd 会为每次启动的服务单元设置 INVOCATION_ID 环境变量
+func isRunningAsService() bool {
+	return os.Getenv("INVOCATION_ID") != ""
+}
+
+// runAsWindowsService 在 Linux 下由 systemd 托管时直接运行代理服务
+// systemd 负责进程生命周期，信号处理由 startAgentService 完成
+func runAsWindowsService(name string, isDebug bool) {
+	startAgentService()
+}
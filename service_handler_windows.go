@@ -38,7 +38,14 @@ func (m *windowsService) Execute(args []string, r <-chan svc.ChangeRequest, chan
 	elog.Info(1, "服务正在启动")
 
 	// 创建代理服务实例
-	m.agent = NewAgentService()
+	agent, err := NewAgentService()
+	if err != nil {
+		// 配置有误时停止服务，不使用默认配置连接默认服务端
+		elog.Error(1, fmt.Sprintf("加载配置失败，服务未启动: %v", err))
+		changes <- svc.Status{State: svc.Stopped}
+		return true, 1
+	}
+	m.agent = agent
 	m.ctx, m.cancel = context.WithCancel(context.Background())
 
 	// 在 goroutine 中启动代理服务
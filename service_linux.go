@@ -8,14 +8,28 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
 const (
 	serviceName = ServiceName
 	serviceFile = "/etc/systemd/system/dhagent.service"
+	configDir   = "/etc/goagent"
+	dataDir     = "/var/lib/goagent"
+	envFile     = configDir + "/goagent.env"
 )
 
+// systemConfigDir 获取系统配置目录
+func systemConfigDir() string {
+	return configDir
+}
+
+// systemDataDir 获取默认数据目录
+func systemDataDir() string {
+	return dataDir
+}
+
 func installLinuxService() error {
 	exePath, err := os.Executable()
 	if err != nil {
@@ -28,6 +42,9 @@ func installLinuxService() error {
 		return fmt.Errorf("获取绝对路径失败: %v", err)
 	}
 
+	// 安装时指定的配置参数写入启动命令，GOAGENT_* 环境变量可放在 EnvironmentFile 中
+	execStart := quoteSystemdArgs(append([]string{absPath}, commandLineConfig.Args()...))
+
 	// 创建 systemd 服务文件内容
 	serviceContent := fmt.Sprintf(`[Unit]
 Description=%s
@@ -36,7 +53,9 @@ After=network.target
 [Service]
 Type=simple
 User=root
+EnvironmentFile=-%s
 ExecStart=%s
+ExecReload=/bin/kill -HUP $MAINPID
 Restart=always
 RestartSec=5
 StandardOutput=journal
@@ -44,7 +63,7 @@ StandardError=journal
 
 [Install]
 WantedBy=multi-user.target
-`, ServiceDisplayName, absPath)
+`, ServiceDisplayName, envFile, execStart)
 
 	// 写入服务文件
 	if err := os.WriteFile(serviceFile, []byte(serviceContent), 0644); err != nil {
@@ -66,6 +85,20 @@ WantedBy=multi-user.target
 	return nil
 }
 
+// quoteSystemdArgs 拼接 ExecStart 命令行，包含空白或引号的参数加双引号
+// systemd 会展开 % 说明符和 $ 环境变量，需转义为 %% 和 $$ 才能原样传给程序
+func quoteSystemdArgs(args []string) string {
+	escaper := strings.NewReplacer("%", "%%", "$", "$$")
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'\\") {
+			arg = strconv.Quote(arg)
+		}
+		quoted = append(quoted, escaper.Replace(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
 func uninstallLinuxService() error {
 	// 停止服务
 	stopCmd := exec.Command("systemctl", "stop", serviceName)
@@ -0,0 +1,25 @@
+//go:build linux
+
+package main
+
+import "testing"
+
+func TestQuoteSystemdArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"/usr/local/bin/goagent", "run"}, want: `/usr/local/bin/goagent run`},
+		{args: []string{"/opt/go agent/goagent", "--config", ""}, want: `"/opt/go agent/goagent" --config ""`},
+		{args: []string{"--server-url", `http://a/"b"`}, want: `--server-url "http://a/\"b\""`},
+		// systemd 展开 % 说明符和 $ 环境变量，须转义后原样传给程序
+		{args: []string{"--log-file", "/var/log/%H.log"}, want: `--log-file /var/log/%%H.log`},
+		{args: []string{"--server-url", "$SERVER"}, want: `--server-url $$SERVER`},
+		{args: []string{"--log-file", "/var/log/a b/$HOST-100%.log"}, want: `--log-file "/var/log/a b/$$HOST-100%%.log"`},
+	}
+	for _, tt := range tests {
+		if got := quoteSystemdArgs(tt.args); got != tt.want {
+			t.Errorf("quoteSystemdArgs(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
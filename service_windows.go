@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 )
 
 const (
@@ -15,6 +16,20 @@ const (
 	serviceDescription = ServiceDescription
 )
 
+// systemConfigDir 获取系统配置目录 (%PROGRAMDATA%\GoAgent)
+func systemConfigDir() string {
+	programData := os.Getenv("PROGRAMDATA")
+	if programData == "" {
+		programData = `C:\ProgramData`
+	}
+	return filepath.Join(programData, "GoAgent")
+}
+
+// systemDataDir 获取默认数据目录 (%PROGRAMDATA%\GoAgent\data)
+func systemDataDir() string {
+	return filepath.Join(systemConfigDir(), "data")
+}
+
 func installWindowsService() error {
 	exePath, err := os.Executable()
 	if err != nil {
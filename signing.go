@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 请求签名使用的 HTTP 头
+// 签名内容为 方法、路径（含查询参数）、请求体 SHA-256、时间戳（Unix 毫秒）和随机数，以换行连接，
+// 使用节点密钥计算 HMAC-SHA256 后按 Base64 编码
+const (
+	headerNodeCode  = "X-Node-Code"
+	headerTimestamp = "X-Timestamp"
+	headerNonce     = "X-Nonce"
+	headerSignature = "X-Signature"
+)
+
+// commandSignMethod 服务端指令签名内容中的方法名，指令名称作为路径
+const commandSignMethod = "COMMAND"
+
+// maxNonces 随机数缓存的容量，正常情况下时间窗口内的指令远少于该数量
+const maxNonces = 10000
+
+// nonceFileName 已使用随机数的记录文件，重启后继续拒绝重放的指令
+const nonceFileName = "nonces.json"
+
+// errNoSecret 节点尚未注册，没有节点密钥，无法校验指令签名
+var errNoSecret = errors.New("节点未注册，无法校验指令签名")
+
+// canonicalPayload 组合签名内容
+func canonicalPayload(method, path string, body []byte, timestamp int64, nonce string) string {
+	sum := sha256.Sum256(body)
+	return strings.Join([]string{method, path, hex.EncodeToString(sum[:]), strconv.FormatInt(timestamp, 10), nonce}, "\n")
+}
+
+// signPayload 使用节点密钥计算签名
+func signPayload(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newNonce 生成 128 位随机数
+func newNonce() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %v", err)
+	}
+	return hex.EncodeToString(nonce), nil
+}
+
+// commandPayload 服务端指令的签名内容，请求体为 指令ID、参数和过期时间
+func commandPayload(cmd *ServerCommand) string {
+	body := fmt.Sprintf("%d\n%s\n%d", cmd.ID, cmd.Argument, cmd.Expire)
+	return canonicalPayload(commandSignMethod, cmd.Command, []byte(body), cmd.Timestamp, cmd.Nonce)
+}
+
+// nonceCache 记录时间窗口内已使用的随机数，用于拒绝重放的指令
+// 时间戳超出窗口的指令本身就会被拒绝，因此记录只需保留到时间戳加上允许偏差为止。
+// 记录保存在数据目录中，服务重启后同样能识别重放
+type nonceCache struct {
+	mu     sync.Mutex
+	path   string // 为空时只保存在内存中
+	max    int
+	seen   map[string]time.Time // 随机数 -> 记录失效时间
+	loaded bool
+	lostAt time.Time // 记录文件损坏无法读取的时间，为零表示记录完整
+}
+
+// newNonceCache 创建随机数缓存，path 为记录文件
+func newNonceCache(path string, max int) *nonceCache {
+	return &nonceCache{path: path, max: max, seen: make(map[string]time.Time)}
+}
+
+// load 首次使用时读取记录文件，丢弃已失效的记录
+func (n *nonceCache) load(now time.Time) {
+	n.loaded = true
+	if n.path == "" {
+		return
+	}
+	data, err := os.ReadFile(n.path)
+	if os.IsNotExist(err) {
+		return
+	}
+	var saved map[string]int64
+	if err == nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	if err != nil {
+		n.lostAt = now
+		return
+	}
+	for nonce, until := range saved {
+		if expire := time.UnixMilli(until); now.Before(expire) {
+			n.seen[nonce] = expire
+		}
+	}
+}
+
+// save 写入未失效的记录
+func (n *nonceCache) save(now time.Time) error {
+	if n.path == "" {
+		return nil
+	}
+	saved := make(map[string]int64, len(n.seen))
+	for nonce, until := range n.seen {
+		if now.Before(until) {
+			saved[nonce] = until.UnixMilli()
+		}
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return writeStateFile(n.path, data, 0600)
+}
+
+// Add 记录签名时间为 signed 的指令的随机数，随机数已使用过时返回错误
+// 缓存已满且没有可清理的记录时拒绝新的随机数，宁可拒绝指令也不放过重放。
+// 记录文件损坏时无法判断之前接受过哪些指令，读取后的 skew 时间内拒绝所有指令，届时之前签名的指令都已过期
+func (n *nonceCache) Add(nonce string, signed time.Time, skew time.Duration, now time.Time) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if !n.loaded {
+		n.load(now)
+	}
+	if !n.lostAt.IsZero() && now.Before(n.lostAt.Add(skew)) {
+		return fmt.Errorf("随机数记录 %s 已损坏，%s 前拒绝指令", n.path, n.lostAt.Add(skew).Format("15:04:05"))
+	}
+	if until, ok := n.seen[nonce]; ok && now.Before(until) {
+		return fmt.Errorf("随机数 %s 已使用过，疑似重放", nonce)
+	}
+	if len(n.seen) >= n.max {
+		for k, until := range n.seen {
+			if !now.Before(until) {
+				delete(n.seen, k)
+			}
+		}
+		if len(n.seen) >= n.max {
+			return fmt.Errorf("随机数缓存已满 (%d)", n.max)
+		}
+	}
+	n.seen[nonce] = signed.Add(skew)
+	if err := n.save(now); err != nil {
+		return fmt.Errorf("保存随机数记录失败: %v", err)
+	}
+	return nil
+}
+
+// VerifyCommand 校验服务端指令的签名、时间戳和随机数
+// 未设置节点密钥（节点尚未注册）时返回 errNoSecret
+func (c *StarClient) VerifyCommand(cmd *ServerCommand, nonces *nonceCache, skew time.Duration) error {
+	_, secret := c.Secret()
+	if secret == "" {
+		return errNoSecret
+	}
+	if cmd.Signature == "" || cmd.Nonce == "" || cmd.Timestamp <= 0 {
+		return fmt.Errorf("指令缺少签名")
+	}
+
+	expected := signPayload(secret, commandPayload(cmd))
+	if !hmac.Equal([]byte(expected), []byte(cmd.Signature)) {
+		return fmt.Errorf("签名不匹配")
+	}
+
+	now := time.Now()
+	signed := time.UnixMilli(cmd.Timestamp)
+	if offset := now.Sub(signed); offset > skew || offset < -skew {
+		return fmt.Errorf("签名时间 %s 与本机时间相差 %v，超出允许的偏差 %v",
+			signed.Format("2006-01-02 15:04:05"), offset.Round(time.Second), skew)
+	}
+	return nonces.Add(cmd.Nonce, signed, skew, now)
+}
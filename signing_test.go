@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signCommand 模拟服务端为指令签名
+func signCommand(secret string, cmd ServerCommand, at time.Time, nonce string) ServerCommand {
+	cmd.Timestamp, cmd.Nonce = at.UnixMilli(), nonce
+	cmd.Signature = signPayload(secret, commandPayload(&cmd))
+	return cmd
+}
+
+func TestSignedRequests(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	standIn.secret, standIn.signed = "secret-1", true
+	a := newTestAgentService(t, server.URL)
+	saveCredentials(a.getConfig().DataDir, &NodeCredentials{NodeID: "node-test", Secret: "secret-1", IssuedAt: time.Now()})
+
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("connectToServer: %v", err)
+	}
+	a.metricsMu.Lock()
+	a.latestMetrics = &NodeMetrics{Time: time.Now()}
+	a.metricsMu.Unlock()
+	a.reportNodeStatus(time.Now())
+	if len(standIn.pings) != 1 {
+		t.Fatalf("pings = %d, want 1", len(standIn.pings))
+	}
+	conn, err := a.getClient().DialNotify(context.Background())
+	if err != nil {
+		t.Fatalf("DialNotify: %v", err)
+	}
+	conn.Close()
+	(<-standIn.notify).Close()
+	if standIn.badSigns != 0 {
+		t.Fatalf("bad signatures = %d", standIn.badSigns)
+	}
+
+	// 密钥不对或未签名的请求被拒绝
+	client := NewStarClient(server.URL, time.Second, nil, nil)
+	client.SetSecret("node-test", "secret-2")
+	if _, err := client.Login(context.Background(), &LoginRequest{Code: "node-test", Node: &LoginNodeInfo{}}); err != ErrUnauthorized {
+		t.Fatalf("login signed with wrong secret: err = %v", err)
+	}
+	client.SetSecret("", "")
+	if _, err := client.Login(context.Background(), &LoginRequest{Code: "node-test", Node: &LoginNodeInfo{}}); err != ErrUnauthorized {
+		t.Fatalf("unsigned login: err = %v", err)
+	}
+}
+
+func TestVerifyCommand(t *testing.T) {
+	client := NewStarClient("http://star.test", time.Second, nil, nil)
+	nonces := newNonceCache("", maxNonces)
+	skew := 5 * time.Minute
+	cmd := ServerCommand{ID: 1, Command: "restart", Argument: `{"delay":1}`}
+
+	// 未注册的节点无法校验，由调用方决定是否执行
+	if err := client.VerifyCommand(&cmd, nonces, skew); !errors.Is(err, errNoSecret) {
+		t.Fatalf("command without secret: err = %v, want errNoSecret", err)
+	}
+
+	client.SetSecret("node-test", "secret-1")
+	signed := signCommand("secret-1", cmd, time.Now().Add(-time.Minute), "n1")
+	if err := client.VerifyCommand(&signed, nonces, skew); err != nil {
+		t.Fatalf("signed command: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cmd  ServerCommand
+		want string
+	}{
+		{"replay", signed, "重放"},
+		{"unsigned", cmd, "缺少签名"},
+		{"wrong secret", signCommand("secret-2", cmd, time.Now(), "n2"), "签名不匹配"},
+		{"too old", signCommand("secret-1", cmd, time.Now().Add(-10*time.Minute), "n3"), "超出允许的偏差"},
+		{"too new", signCommand("secret-1", cmd, time.Now().Add(10*time.Minute), "n4"), "超出允许的偏差"},
+	}
+	for _, tt := range tests {
+		if err := client.VerifyCommand(&tt.cmd, nonces, skew); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	// 篡改参数后签名失效
+	tampered := signCommand("secret-1", cmd, time.Now(), "n5")
+	tampered.Argument = `{"delay":0}`
+	if err := client.VerifyCommand(&tampered, nonces, skew); err == nil {
+		t.Error("tampered argument passed verification")
+	}
+}
+
+func TestNonceCacheExpiry(t *testing.T) {
+	nonces := newNonceCache("", 2)
+	now := time.Now()
+	nonces.Add("a", now, time.Minute, now)
+	nonces.Add("b", now, time.Hour, now)
+	if err := nonces.Add("c", now, time.Hour, now); err == nil {
+		t.Fatal("full cache accepted a new nonce")
+	}
+	// a 过期后腾出空间
+	later := now.Add(2 * time.Minute)
+	if err := nonces.Add("c", later, time.Hour, later); err != nil {
+		t.Fatalf("add after expiry: %v", err)
+	}
+	if err := nonces.Add("b", later, time.Hour, later); err == nil {
+		t.Fatal("replayed nonce accepted")
+	}
+}
+
+func TestNonceCachePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), nonceFileName)
+	now := time.Now()
+	skew := 5 * time.Minute
+	nonces := newNonceCache(path, maxNonces)
+	if err := nonces.Add("a", now, skew, now); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	nonces.Add("b", now.Add(-10*time.Minute), skew, now) // 已失效，不保存
+
+	// 重启后仍拒绝重放
+	restarted := newNonceCache(path, maxNonces)
+	if err := restarted.Add("a", now, skew, now.Add(time.Second)); err == nil {
+		t.Fatal("nonce replayed after restart")
+	}
+	if err := restarted.Add("b", now, skew, now.Add(time.Second)); err != nil {
+		t.Fatalf("expired record kept: %v", err)
+	}
+
+	// 记录损坏时，一个偏差窗口内拒绝所有指令
+	writeTestFile(t, path, []byte("{broken"))
+	restarted = newNonceCache(path, maxNonces)
+	if err := restarted.Add("c", now, skew, now); err == nil || !strings.Contains(err.Error(), "已损坏") {
+		t.Fatalf("command accepted with lost nonce records: err = %v", err)
+	}
+	later := now.Add(skew + time.Second)
+	if err := restarted.Add("c", later, skew, later); err != nil {
+		t.Fatalf("command after skew window: %v", err)
+	}
+}
+
+func TestRejectedCommandNotReplied(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	standIn.secret = "secret-1"
+	a := newTestAgentService(t, server.URL)
+	saveCredentials(a.getConfig().DataDir, &NodeCredentials{NodeID: "node-test", Secret: "secret-1", IssuedAt: time.Now()})
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("connectToServer: %v", err)
+	}
+
+	cmd := signCommand("secret-1", ServerCommand{ID: 7, Command: "ps", Argument: `{"limit":1}`}, time.Now(), "n1")
+	a.handleCommand(cmd)
+	a.handleCommand(cmd)
+	a.handleCommand(ServerCommand{ID: 8, Command: "ps", Argument: `{"limit":1}`})
+	for _, reply := range standIn.replies {
+		if reply.ID != 7 {
+			t.Fatalf("replies = %+v, want only the first signed command", standIn.replies)
+		}
+	}
+	if len(standIn.replies) != 2 {
+		t.Fatalf("replies = %+v, want ack and result of the first signed command", standIn.replies)
+	}
+}
+
+func TestUnregisteredNodeCommands(t *testing.T) {
+	standIn, server := newStarStandIn(t)
+	a := newTestAgentService(t, server.URL)
+	if err := a.connectToServer(); err != nil {
+		t.Fatalf("connectToServer: %v", err)
+	}
+
+	// 没有节点密钥时只执行只读指令，其他指令无法校验签名，直接拒绝
+	a.handleCommand(ServerCommand{ID: 1, Command: "rotate_secret"})
+	a.handleCommand(ServerCommand{ID: 2, Command: "exec", Argument: `{"program":"id"}`})
+	a.handleCommand(ServerCommand{ID: 3, Command: "ps", Argument: `{"limit":1}`})
+	// 不支持的指令不执行，无需签名也回复结果
+	a.handleCommand(ServerCommand{ID: 4, Command: "reboot"})
+	for _, reply := range standIn.replies {
+		if reply.ID != 3 && reply.ID != 4 {
+			t.Fatalf("replies = %+v, want only ps and reboot", standIn.replies)
+		}
+	}
+	if len(standIn.replies) != 3 || !replyResult(t, standIn.replies[1]).Success {
+		t.Fatalf("replies = %+v", standIn.replies)
+	}
+	if result := replyResult(t, standIn.replies[2]); result.Success || result.Code != codeUnsupported {
+		t.Fatalf("unsupported command result = %+v", result)
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tlsVersions 支持配置的最低 TLS 版本
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// parseTLSVersion 解析最低 TLS 版本，如 1.2
+func parseTLSVersion(v string) (uint16, error) {
+	version, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(v), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("不支持的 TLS 版本 %q，可选值: 1.0, 1.1, 1.2, 1.3", v)
+	}
+	return version, nil
+}
+
+// parseSPKIPins 解析证书公钥指纹列表
+// 每一项为证书 SubjectPublicKeyInfo 的 SHA-256 摘要的 Base64 编码，可带 sha256/ 前缀
+func parseSPKIPins(pins []string) ([][]byte, error) {
+	var hashes [][]byte
+	for _, pin := range pins {
+		encoded := strings.TrimPrefix(pin, "sha256/")
+		hash, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("无效的公钥指纹 %q，应为 SHA-256 摘要的 Base64 编码", pin)
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// splitConfigList 拆分逗号分隔的配置值，忽略空项
+func splitConfigList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// spkiPin 计算证书的公钥指纹，格式与 server.pins 相同
+func spkiPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// fileStamp 文件的修改时间和大小，用于判断证书文件是否已轮换
+type fileStamp struct {
+	ModTime time.Time
+	Size    int64
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{ModTime: info.ModTime(), Size: info.Size()}, nil
+}
+
+// serverTLS 服务端连接的 TLS 设置
+// CA 证书和客户端证书在每次 TLS 握手前检查是否有变更，轮换后无需重启即可生效；
+// 新文件无法加载时（如证书和私钥只替换了一个）继续使用上一次加载成功的证书
+type serverTLS struct {
+	caFile     string
+	certFile   string
+	keyFile    string
+	pins       [][]byte
+	minVersion uint16
+	logf       func(format string, v ...interface{}) // 证书重新加载时的日志输出
+
+	mu        sync.Mutex
+	caStamp   fileStamp
+	roots     *x509.CertPool
+	certStamp [2]fileStamp
+	cert      *tls.Certificate
+}
+
+// newServerTLS 根据配置创建 TLS 设置并加载证书文件
+func newServerTLS(c *AgentConfig, logf func(format string, v ...interface{})) (*serverTLS, error) {
+	minVersion, err := parseTLSVersion(c.ServerTLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	pins, err := parseSPKIPins(c.ServerPins)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &serverTLS{
+		caFile:     c.ServerCAFile,
+		certFile:   c.ServerCertFile,
+		keyFile:    c.ServerKeyFile,
+		pins:       pins,
+		minVersion: minVersion,
+		logf:       logf,
+	}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Config 生成连接 host 时用于 HTTP 和 WebSocket 的 TLS 配置
+// host 为服务端地址中的主机名或 IP，证书按它校验，不依赖握手中的 SNI（连接 IP 时不发送 SNI）
+func (t *serverTLS) Config(host string) *tls.Config {
+	config := &tls.Config{
+		ServerName: host,
+		MinVersion: t.minVersion,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			return t.verifyConnection(cs, host)
+		},
+	}
+	if t.caFile != "" {
+		// 跳过内置校验，由 verifyConnection 使用可重新加载的 CA 证书校验证书链和主机名
+		config.InsecureSkipVerify = true
+	}
+	if t.certFile != "" {
+		config.GetClientCertificate = t.clientCertificate
+	}
+	return config
+}
+
+// reload 检查证书文件，有变更时重新加载
+func (t *serverTLS) reload() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.caFile != "" {
+		stamp, err := statFile(t.caFile)
+		if err != nil {
+			return fmt.Errorf("读取 CA 证书失败: %v", err)
+		}
+		if t.roots == nil || stamp != t.caStamp {
+			data, err := os.ReadFile(t.caFile)
+			if err != nil {
+				return fmt.Errorf("读取 CA 证书失败: %v", err)
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(data) {
+				return fmt.Errorf("CA 证书文件 %s 中没有有效的 PEM 证书", t.caFile)
+			}
+			if t.roots != nil {
+				t.log("🔐 CA 证书已更新，重新加载: %s", t.caFile)
+			}
+			t.roots, t.caStamp = roots, stamp
+		}
+	}
+
+	if t.certFile != "" {
+		certStamp, err := statFile(t.certFile)
+		if err != nil {
+			return fmt.Errorf("读取客户端证书失败: %v", err)
+		}
+		keyStamp, err := statFile(t.keyFile)
+		if err != nil {
+			return fmt.Errorf("读取客户端私钥失败: %v", err)
+		}
+		stamp := [2]fileStamp{certStamp, keyStamp}
+		if t.cert == nil || stamp != t.certStamp {
+			cert, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+			if err != nil {
+				return fmt.Errorf("加载客户端证书失败: %v", err)
+			}
+			if t.cert != nil {
+				t.log("🔐 客户端证书已更新，重新加载: %s", t.certFile)
+			}
+			t.cert, t.certStamp = &cert, stamp
+		}
+	}
+	return nil
+}
+
+func (t *serverTLS) log(format string, v ...interface{}) {
+	if t.logf != nil {
+		t.logf(format, v...)
+	}
+}
+
+// current 获取最新的 CA 证书和客户端证书，重新加载失败时沿用已加载的证书
+func (t *serverTLS) current() (*x509.CertPool, *tls.Certificate, error) {
+	err := t.reload()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil && (t.caFile != "" && t.roots == nil || t.certFile != "" && t.cert == nil) {
+		return nil, nil, err
+	}
+	if err != nil {
+		t.log("⚠️ %v，继续使用之前的证书", err)
+	}
+	return t.roots, t.cert, nil
+}
+
+// clientCertificate 双向认证时提供客户端证书
+func (t *serverTLS) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_, cert, err := t.current()
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+// verifyConnection 校验服务端证书
+// 配置了 CA 证书时只信任该 CA 签发的、与 host 匹配的证书；配置了公钥指纹时，证书链中至少一个证书的公钥必须匹配
+func (t *serverTLS) verifyConnection(cs tls.ConnectionState, host string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return fmt.Errorf("服务端未提供证书")
+	}
+
+	chains := cs.VerifiedChains
+	if t.caFile != "" {
+		if host == "" {
+			host = cs.ServerName
+		}
+		if host == "" {
+			return fmt.Errorf("未知的服务端主机名，无法校验证书")
+		}
+		roots, _, err := t.current()
+		if err != nil {
+			return err
+		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			DNSName:       host, // IP 地址按证书中的 IP SAN 校验
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		chains, err = cs.PeerCertificates[0].Verify(opts)
+		if err != nil {
+			return fmt.Errorf("服务端证书校验失败: %v", err)
+		}
+	}
+
+	if len(t.pins) == 0 {
+		return nil
+	}
+	for _, chain := range chains {
+		for _, cert := range chain {
+			hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, pin := range t.pins {
+				if string(hash[:]) == string(pin) {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("服务端证书公钥与配置的指纹不匹配 (服务端证书: %s)", spkiPin(cs.PeerCertificates[0]))
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCA 测试用的证书颁发机构
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var testSerial int64
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testSerial++
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(testSerial),
+		Subject:               pkix.Name{CommonName: "GoAgent Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发证书，返回 PEM 格式的证书和私钥，证书对 127.0.0.1 有效
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	return ca.issueFor(t, cn, usage, "127.0.0.1")
+}
+
+// issueFor 签发对指定主机名或 IP 有效的证书
+func (ca *testCA) issueFor(t *testing.T, cn string, usage x509.ExtKeyUsage, hosts ...string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	testSerial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(testSerial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("issue %s: %v", cn, err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// newTLSStandIn 启动由 ca 签发证书的 HTTPS 星尘服务端，记录每次请求的客户端证书名称
+func newTLSStandIn(t *testing.T, ca *testCA, configure func(*tls.Config)) (*httptest.Server, func() []string) {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, "star.test", x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("server key pair: %v", err)
+	}
+
+	var mu sync.Mutex
+	var clients []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if len(r.TLS.PeerCertificates) > 0 {
+			clients = append(clients, r.TLS.PeerCertificates[0].Subject.CommonName)
+		}
+		mu.Unlock()
+		w.Write([]byte(`{"code":0,"data":{"token":"token-1"}}`))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // 握手失败是预期的
+	if configure != nil {
+		configure(server.TLS)
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), clients...)
+	}
+}
+
+// tlsLogin 使用配置中的 TLS 设置登录
+func tlsLogin(t *testing.T, config *AgentConfig, url string) error {
+	t.Helper()
+	client, err := newServerClient(config, url, t.Logf)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	_, err = client.Login(context.Background(), &LoginRequest{Code: "node-1", Node: &LoginNodeInfo{}})
+	return err
+}
+
+func TestServerTLSCustomCA(t *testing.T) {
+	ca := newTestCA(t)
+	server, _ := newTLSStandIn(t, ca, nil)
+
+	config := getDefaultConfig()
+	if err := tlsLogin(t, config, server.URL); err == nil {
+		t.Fatal("login with system roots succeeded against private CA")
+	}
+
+	config.ServerCAFile = filepath.Join(t.TempDir(), "ca.pem")
+	writeTestFile(t, config.ServerCAFile, ca.pem)
+	if err := tlsLogin(t, config, server.URL); err != nil {
+		t.Fatalf("login with custom CA: %v", err)
+	}
+
+	// 其他 CA 签发的证书不被信任
+	writeTestFile(t, config.ServerCAFile, newTestCA(t).pem)
+	if err := tlsLogin(t, config, server.URL); err == nil || !strings.Contains(err.Error(), "证书校验失败") {
+		t.Fatalf("login with wrong CA: err = %v", err)
+	}
+}
+
+func TestServerTLSHostMismatch(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issueFor(t, "star.test", x509.ExtKeyUsageServerAuth, "star.test", "10.0.0.1")
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("server key pair: %v", err)
+	}
+	server, _ := newTLSStandIn(t, ca, func(c *tls.Config) { c.Certificates = []tls.Certificate{cert} })
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "https://"))
+
+	config := getDefaultConfig()
+	config.ServerCAFile = filepath.Join(t.TempDir(), "ca.pem")
+	writeTestFile(t, config.ServerCAFile, ca.pem)
+
+	// 证书由受信任的 CA 签发，但主机名和 IP 都不匹配；连接 IP 时没有 SNI，同样必须校验
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		if err := tlsLogin(t, config, "https://"+net.JoinHostPort(host, port)); err == nil {
+			t.Errorf("login to %s with certificate for star.test,10.0.0.1 succeeded", host)
+		}
+	}
+
+	certPEM, keyPEM = ca.issueFor(t, "star.test", x509.ExtKeyUsageServerAuth, "localhost", "127.0.0.1")
+	cert, _ = tls.X509KeyPair(certPEM, keyPEM)
+	server, _ = newTLSStandIn(t, ca, func(c *tls.Config) { c.Certificates = []tls.Certificate{cert} })
+	_, port, _ = net.SplitHostPort(strings.TrimPrefix(server.URL, "https://"))
+	for _, host := range []string{"127.0.0.1", "localhost"} {
+		if err := tlsLogin(t, config, "https://"+net.JoinHostPort(host, port)); err != nil {
+			t.Errorf("login to %s: %v", host, err)
+		}
+	}
+}
+
+func TestServerTLSPinning(t *testing.T) {
+	ca := newTestCA(t)
+	server, _ := newTLSStandIn(t, ca, nil)
+
+	config := getDefaultConfig()
+	config.ServerCAFile = filepath.Join(t.TempDir(), "ca.pem")
+	writeTestFile(t, config.ServerCAFile, ca.pem)
+
+	config.ServerPins = []string{spkiPin(newTestCA(t).cert)}
+	if err := tlsLogin(t, config, server.URL); err == nil || !strings.Contains(err.Error(), "指纹不匹配") {
+		t.Fatalf("login with wrong pin: err = %v", err)
+	}
+
+	// 固定 CA 公钥时，该 CA 签发的任何服务端证书都可以通过
+	config.ServerPins = []string{"sha256/AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=", spkiPin(ca.cert)}
+	if err := tlsLogin(t, config, server.URL); err != nil {
+		t.Fatalf("login with CA pin: %v", err)
+	}
+
+	leaf := server.Certificate()
+	config.ServerPins = []string{spkiPin(leaf)}
+	if err := tlsLogin(t, config, server.URL); err != nil {
+		t.Fatalf("login with leaf pin: %v", err)
+	}
+}
+
+func TestServerTLSClientCertificateRotation(t *testing.T) {
+	ca := newTestCA(t)
+	server, clients := newTLSStandIn(t, ca, func(c *tls.Config) {
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+		c.ClientCAs = x509.NewCertPool()
+		c.ClientCAs.AddCert(ca.cert)
+	})
+
+	dir := t.TempDir()
+	config := getDefaultConfig()
+	config.ServerCAFile = filepath.Join(dir, "ca.pem")
+	config.ServerCertFile = filepath.Join(dir, "client.pem")
+	config.ServerKeyFile = filepath.Join(dir, "client.key")
+	writeTestFile(t, config.ServerCAFile, ca.pem)
+
+	if err := tlsLogin(t, getDefaultConfig(), server.URL); err == nil {
+		t.Fatal("login without client certificate succeeded")
+	}
+
+	certPEM, keyPEM := ca.issue(t, "node-1", x509.ExtKeyUsageClientAuth)
+	writeTestFile(t, config.ServerCertFile, certPEM)
+	writeTestFile(t, config.ServerKeyFile, keyPEM)
+
+	client, err := newServerClient(config, server.URL, t.Logf)
+	if err != nil {
+		t.Fatalf("newServerClient: %v", err)
+	}
+	defer client.Close()
+	login := func() error {
+		client.Close() // 强制重新握手
+		_, err := client.Login(context.Background(), &LoginRequest{Code: "node-1", Node: &LoginNodeInfo{}})
+		return err
+	}
+	if err := login(); err != nil {
+		t.Fatalf("login with client certificate: %v", err)
+	}
+
+	// 证书轮换：只替换了证书、私钥尚未更新时继续使用旧证书
+	rotatedCert, rotatedKey := ca.issue(t, "node-1-rotated", x509.ExtKeyUsageClientAuth)
+	writeTestFile(t, config.ServerCertFile, rotatedCert)
+	if err := login(); err != nil {
+		t.Fatalf("login during rotation: %v", err)
+	}
+	writeTestFile(t, config.ServerKeyFile, rotatedKey)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(config.ServerKeyFile, later, later)
+	if err := login(); err != nil {
+		t.Fatalf("login after rotation: %v", err)
+	}
+
+	got := clients()
+	if len(got) != 3 || got[0] != "node-1" || got[1] != "node-1" || got[2] != "node-1-rotated" {
+		t.Fatalf("client certificates = %v, want [node-1 node-1 node-1-rotated]", got)
+	}
+}
+
+func TestServerTLSMinVersion(t *testing.T) {
+	ca := newTestCA(t)
+	server, _ := newTLSStandIn(t, ca, func(c *tls.Config) { c.MaxVersion = tls.VersionTLS12 })
+
+	config := getDefaultConfig()
+	config.ServerCAFile = filepath.Join(t.TempDir(), "ca.pem")
+	writeTestFile(t, config.ServerCAFile, ca.pem)
+	if err := tlsLogin(t, config, server.URL); err != nil {
+		t.Fatalf("login with TLS 1.2: %v", err)
+	}
+
+	config.ServerTLSMinVersion = "1.3"
+	if err := tlsLogin(t, config, server.URL); err == nil {
+		t.Fatal("login succeeded below minimum TLS version")
+	}
+}
+
+func TestServerTLSConfigValidation(t *testing.T) {
+	config := getDefaultConfig()
+	config.ServerCertFile = "client.pem"
+	config.ServerPins = []string{"sha256/not-base64"}
+	config.ServerTLSMinVersion = "1.4"
+
+	keys := map[string]bool{}
+	for _, problem := range validateAgentConfig(config) {
+		keys[problem.Key] = true
+	}
+	for _, key := range []string{"server.cert_file", "server.pins", "server.tls_min_version"} {
+		if !keys[key] {
+			t.Errorf("expected validation problem for %s, got %v", key, keys)
+		}
+	}
+}